@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/handlers"
+)
+
+// reconcile verifies users.total_points against the point ledger, then
+// recomputes schools.student_count and schools.total_points from users, and
+// reports any drift it finds.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report drift without fixing it")
+	flag.Parse()
+
+	// Load configuration
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Sessions and adjustments from before the ledger existed
+	if !*dryRun {
+		created, err := handlers.BackfillPointLedger()
+		if err != nil {
+			log.Fatalf("Failed to backfill point ledger: %v", err)
+		}
+		if created > 0 {
+			fmt.Printf("Backfilled %d ledger entries\n", created)
+		}
+	}
+
+	userDrifts, err := handlers.ReconcilePointLedger(*dryRun)
+	if err != nil {
+		log.Fatalf("Failed to reconcile point ledger: %v", err)
+	}
+	for _, d := range userDrifts {
+		fmt.Printf("%s (%s): total_points %d -> %d\n",
+			d.Email, d.UserID, d.StoredTotalPoints, d.LedgerTotalPoints)
+	}
+
+	schoolDrifts, err := handlers.ReconcileSchools(*dryRun)
+	if err != nil {
+		log.Fatalf("Failed to reconcile schools: %v", err)
+	}
+	for _, d := range schoolDrifts {
+		fmt.Printf("%s (%s): student_count %d -> %d, total_points %d -> %d\n",
+			d.SchoolName, d.SchoolID,
+			d.StoredStudentCount, d.ActualStudentCount,
+			d.StoredTotalPoints, d.ActualTotalPoints)
+	}
+
+	if len(userDrifts) == 0 && len(schoolDrifts) == 0 {
+		fmt.Println("All users and schools are consistent")
+		return
+	}
+
+	if *dryRun {
+		fmt.Printf("Found %d drifted users and %d drifted schools (dry run, nothing changed)\n", len(userDrifts), len(schoolDrifts))
+		// Non-zero exit so the dry run can be used as a check in scripts
+		os.Exit(1)
+	}
+	fmt.Printf("Fixed %d drifted users and %d drifted schools\n", len(userDrifts), len(schoolDrifts))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/handlers"
+	"github.com/yourusername/tomato-backend/internal/models"
+)
+
+const usage = `Usage:
+  schools alias <school> <alias>    Add an alias for a school
+  schools domain <school> <domain>  Add an email domain for a school (SSO)
+  schools merge <source> <target>   Merge source school into target
+
+<school>, <source> and <target> may be a school ID, name or alias.`
+
+// schools manages the school directory: aliases, email domains and merging
+// duplicates
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// Load configuration
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	switch os.Args[1] {
+	case "alias":
+		school := mustFindSchool(os.Args[2])
+		alias, err := handlers.AddSchoolAlias(database.DB, school.ID, os.Args[3])
+		if err != nil {
+			log.Fatalf("Failed to add alias: %v", err)
+		}
+		fmt.Printf("Added alias %q for %s (%s)\n", alias.Name, school.Name, school.ID)
+
+	case "domain":
+		school := mustFindSchool(os.Args[2])
+		domain, err := handlers.AddSchoolDomain(database.DB, school.ID, os.Args[3])
+		if err != nil {
+			log.Fatalf("Failed to add domain: %v", err)
+		}
+		fmt.Printf("Added domain %q for %s (%s)\n", domain.Domain, school.Name, school.ID)
+
+	case "merge":
+		source := mustFindSchool(os.Args[2])
+		target := mustFindSchool(os.Args[3])
+		merged, err := handlers.MergeSchools(database.DB, source.ID, target.ID)
+		if err != nil {
+			log.Fatalf("Failed to merge schools: %v", err)
+		}
+		fmt.Printf("Merged %s into %s: %d students, %d points\n",
+			source.Name, merged.Name, merged.StudentCount, merged.TotalPoints)
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func mustFindSchool(ref string) *models.School {
+	school, err := handlers.FindSchool(database.DB, ref)
+	if err != nil {
+		log.Fatalf("School %q not found: %v", ref, err)
+	}
+	return school
+}
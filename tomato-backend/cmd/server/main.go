@@ -2,14 +2,19 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/tomato-backend/internal/config"
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/handlers"
+	"github.com/yourusername/tomato-backend/internal/mailer"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/oidc"
+	"github.com/yourusername/tomato-backend/internal/outbox"
+	"github.com/yourusername/tomato-backend/internal/utils"
 )
 
 func main() {
@@ -24,6 +29,14 @@ func main() {
 	}
 	defer database.Close()
 
+	// Users that existed before email verification was introduced are
+	// treated as verified so they keep counting towards their school
+	grandfatherVerification := !database.DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	// Plans and todos completed before completion times were recorded count
+	// as completed when they were last updated
+	backfillCompletedAt := !database.DB.Migrator().HasColumn(&models.StudyPlan{}, "CompletedAt")
+
 	// Auto migrate database
 	if err := database.AutoMigrate(
 		&models.School{},
@@ -32,22 +45,88 @@ func main() {
 		&models.StudyPlan{},
 		&models.FocusSession{},
 		&models.Todo{},
+		&models.SchoolAlias{},
+		&models.IdempotencyKey{},
+		&models.AdminAuditLog{},
+		&models.PointTransaction{},
+		&models.UserToken{},
+		&models.LoginThrottle{},
+		&models.SchoolDomain{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.AuthSession{},
+		&models.UserAchievement{},
+		&models.Season{},
+		&models.SeasonStanding{},
+		&models.StudyGroup{},
+		&models.StudyGroupMember{},
+		&models.OutboxEvent{},
+		&models.OutboxDelivery{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.PersonalAccessToken{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	if grandfatherVerification {
+		if err := database.DB.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatalf("Failed to mark existing users as verified: %v", err)
+		}
+	}
+
+	if backfillCompletedAt {
+		for _, table := range []string{"study_plans", "todos"} {
+			if err := database.DB.Exec("UPDATE " + table + " SET completed_at = updated_at WHERE completed AND completed_at IS NULL").Error; err != nil {
+				log.Fatalf("Failed to backfill completion times of %s: %v", table, err)
+			}
+		}
+	}
+
+	// Archive seasons that ended while the server was down and start the
+	// current ones
+	if _, err := handlers.RotateSeasons(time.Now()); err != nil {
+		log.Printf("Failed to rotate seasons: %v", err)
+	}
+
+	// Token signing keys
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	// Email delivery
+	if err := mailer.Init(config.AppConfig.Mail); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	// Single sign-on providers
+	oidc.Init(config.AppConfig.OIDC)
+
+	// Background maintenance jobs
+	go runMaintenance()
+
+	// Live focus rooms
+	handlers.StartFocusRooms()
+
+	// Domain event delivery
+	handlers.StartOutbox()
+
+	// Outgoing webhooks
+	handlers.StartWebhookSender()
+
 	// Initialize Gin router
 	if config.AppConfig.Server.Env == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.Logger(), gin.Recovery())
 
 	// CORS middleware
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     config.AppConfig.CORS.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.IdempotencyKeyHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.IdempotentReplayedHeader},
 		AllowCredentials: true,
 	}))
 
@@ -59,6 +138,9 @@ func main() {
 		})
 	})
 
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
@@ -69,33 +151,56 @@ func main() {
 			auth.POST("/login", handlers.Login)
 			auth.POST("/refresh", handlers.RefreshToken)
 			auth.POST("/logout", middleware.AuthMiddleware(), handlers.Logout)
+			auth.GET("/sessions", middleware.AuthMiddleware(), handlers.ListSessions)
+			auth.DELETE("/sessions/:id", middleware.AuthMiddleware(), handlers.RevokeSession)
+			auth.POST("/stream-ticket", middleware.AuthMiddleware(), handlers.CreateStreamTicket)
+			auth.POST("/verify-email", handlers.VerifyEmail)
+			auth.POST("/verify-email/resend", middleware.AuthMiddleware(), handlers.ResendVerificationEmail)
+			auth.POST("/password/forgot", handlers.ForgotPassword)
+			auth.POST("/password/reset", handlers.ResetPassword)
+			auth.GET("/oidc/providers", handlers.ListOIDCProviders)
+			auth.GET("/oidc/:provider/login", handlers.StartOIDCLogin)
+			auth.POST("/oidc/:provider/callback", handlers.OIDCCallback)
 		}
 
+		// School directory (public, used for registration autocomplete)
+		v1.GET("/schools", handlers.SearchSchools)
+
 		// Protected routes
 		// User routes
 		users := v1.Group("/users")
-		users.Use(middleware.AuthMiddleware())
+		users.Use(middleware.AuthMiddleware(), middleware.Idempotency())
 		{
-			// TODO: Add user handlers
-			// users.GET("/me", handlers.GetMe)
-			// users.PUT("/me", handlers.UpdateMe)
+			users.GET("/me", handlers.GetMe)
+			users.PUT("/me", handlers.UpdateMe)
+			users.PUT("/me/password", middleware.WithholdIdempotentResponse(), handlers.ChangePassword)
+			// TODO: Add user stats handler
 			// users.GET("/me/stats", handlers.GetMyStats)
+			users.GET("/me/points", handlers.GetMyPointHistory)
+			users.GET("/me/achievements", handlers.GetMyAchievements)
+			users.GET("/me/export", handlers.ExportMyData)
+			users.POST("/me/deletion", handlers.RequestAccountDeletion)
+			users.DELETE("/me/deletion", handlers.CancelAccountDeletion)
+			users.GET("/me/tokens", handlers.ListAccessTokens)
+			users.POST("/me/tokens", middleware.WithholdIdempotentResponse(), handlers.CreateAccessToken)
+			users.DELETE("/me/tokens/:id", handlers.RevokeAccessToken)
 		}
 
 		// Course routes
 		courses := v1.Group("/courses")
-		courses.Use(middleware.AuthMiddleware())
+		courses.Use(middleware.AuthMiddleware(), middleware.Idempotency())
 		{
 			courses.GET("", handlers.GetCourses)
 			courses.POST("", handlers.CreateCourse)
 			courses.GET("/:id", handlers.GetCourse)
 			courses.PUT("/:id", handlers.UpdateCourse)
 			courses.DELETE("/:id", handlers.DeleteCourse)
+			courses.POST("/:id/restore", handlers.RestoreCourse)
 		}
 
 		// Study plan routes
 		plans := v1.Group("/plans")
-		plans.Use(middleware.AuthMiddleware())
+		plans.Use(middleware.AuthMiddleware(), middleware.Idempotency())
 		{
 			plans.GET("", handlers.GetPlans)
 			plans.POST("", handlers.CreatePlan)
@@ -103,11 +208,12 @@ func main() {
 			plans.PUT("/:id", handlers.UpdatePlan)
 			plans.DELETE("/:id", handlers.DeletePlan)
 			plans.PATCH("/:id/complete", handlers.TogglePlanComplete)
+			plans.POST("/:id/restore", handlers.RestorePlan)
 		}
 
 		// Focus session routes
 		sessions := v1.Group("/sessions")
-		sessions.Use(middleware.AuthMiddleware())
+		sessions.Use(middleware.AuthMiddleware(), middleware.Idempotency())
 		{
 			sessions.GET("", handlers.GetSessions)
 			sessions.POST("", handlers.CreateSession)
@@ -116,7 +222,7 @@ func main() {
 
 		// Todo routes
 		todos := v1.Group("/todos")
-		todos.Use(middleware.AuthMiddleware())
+		todos.Use(middleware.AuthMiddleware(), middleware.Idempotency())
 		{
 			todos.GET("", handlers.GetTodos)
 			todos.POST("", handlers.CreateTodo)
@@ -124,6 +230,37 @@ func main() {
 			todos.PUT("/:id", handlers.UpdateTodo)
 			todos.DELETE("/:id", handlers.DeleteTodo)
 			todos.PATCH("/:id/complete", handlers.ToggleTodoComplete)
+			todos.POST("/:id/restore", handlers.RestoreTodo)
+		}
+
+		// Trash routes
+		trash := v1.Group("/trash")
+		trash.Use(middleware.AuthMiddleware())
+		{
+			trash.GET("", handlers.GetTrash)
+		}
+
+		// Admin routes
+		admin := v1.Group("/admin")
+		admin.Use(
+			middleware.AuthMiddleware(),
+			middleware.RequireRole(models.RoleSchoolAdmin, models.RoleAdmin),
+			middleware.Idempotency(),
+		)
+		{
+			admin.GET("/users", handlers.AdminListUsers)
+			admin.GET("/users/:id", handlers.AdminGetUser)
+			admin.POST("/users/:id/points", handlers.AdminAdjustPoints)
+			admin.POST("/point-transactions/:id/reverse", handlers.AdminReversePoints)
+			admin.PUT("/users/:id/role", handlers.AdminChangeRole)
+			admin.POST("/users/:id/ban", handlers.AdminBanUser)
+			admin.DELETE("/users/:id/ban", handlers.AdminUnbanUser)
+			admin.PUT("/schools/:id", handlers.AdminUpdateSchool)
+			admin.POST("/schools/:id/aliases", handlers.AdminAddSchoolAlias)
+			admin.POST("/schools/:id/domains", handlers.AdminAddSchoolDomain)
+			admin.POST("/schools/merge", handlers.AdminMergeSchools)
+			admin.POST("/seasons", handlers.AdminCreateSeason)
+			admin.GET("/audit-logs", handlers.AdminGetAuditLogs)
 		}
 
 		// Leaderboard routes
@@ -136,6 +273,50 @@ func main() {
 			// leaderboard.GET("/me", handlers.GetMyRanking)
 		}
 
+		// Season routes
+		seasons := v1.Group("/seasons")
+		seasons.Use(middleware.AuthMiddleware())
+		{
+			seasons.GET("", handlers.ListSeasons)
+			seasons.GET("/current", handlers.GetCurrentSeason)
+			seasons.GET("/:id", handlers.GetSeason)
+		}
+
+		// Study group routes
+		groups := v1.Group("/groups")
+		groups.Use(middleware.AuthMiddleware(), middleware.Idempotency())
+		{
+			groups.GET("", handlers.GetMyGroups)
+			groups.POST("", handlers.CreateGroup)
+			groups.POST("/join", handlers.JoinGroup)
+			groups.GET("/:id", handlers.GetGroup)
+			groups.PUT("/:id", handlers.UpdateGroup)
+			groups.DELETE("/:id", handlers.DeleteGroup)
+			groups.POST("/:id/leave", handlers.LeaveGroup)
+			groups.DELETE("/:id/members/:userId", handlers.RemoveGroupMember)
+			groups.POST("/:id/invite-code", handlers.RegenerateInviteCode)
+			groups.GET("/:id/leaderboard", handlers.GetGroupLeaderboard)
+			groups.GET("/:id/activity", handlers.GetGroupActivity)
+			groups.GET("/:id/room", handlers.JoinFocusRoom)
+		}
+
+		// Outgoing webhook routes
+		webhooks := v1.Group("/webhooks")
+		webhooks.Use(middleware.AuthMiddleware(), middleware.Idempotency())
+		{
+			webhooks.GET("", handlers.GetWebhooks)
+			webhooks.POST("", middleware.WithholdIdempotentResponse(), handlers.CreateWebhook)
+			webhooks.GET("/:id", handlers.GetWebhook)
+			webhooks.PUT("/:id", handlers.UpdateWebhook)
+			webhooks.DELETE("/:id", handlers.DeleteWebhook)
+			webhooks.POST("/:id/secret", middleware.WithholdIdempotentResponse(), handlers.RotateWebhookSecret)
+			webhooks.POST("/:id/ping", handlers.PingWebhook)
+			webhooks.GET("/:id/deliveries", handlers.GetWebhookDeliveries)
+		}
+
+		// Real-time event stream (Server-Sent Events)
+		v1.GET("/events", middleware.AuthMiddleware(), handlers.StreamEvents)
+
 		// Friend routes
 		friends := v1.Group("/friends")
 		friends.Use(middleware.AuthMiddleware())
@@ -157,3 +338,59 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// runMaintenance periodically purges expired data
+func runMaintenance() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := middleware.CleanupExpiredIdempotencyKeys(); err != nil {
+			log.Printf("Failed to clean up idempotency keys: %v", err)
+		}
+
+		if purged, err := handlers.PurgeTrash(config.AppConfig.Trash.RetentionDays); err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d items from trash", purged)
+		}
+
+		if deleted, err := handlers.PurgeDeletedAccounts(); err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d accounts after grace period", deleted)
+		}
+
+		if _, err := handlers.CleanupExpiredUserTokens(); err != nil {
+			log.Printf("Failed to clean up expired tokens: %v", err)
+		}
+
+		if _, err := handlers.CleanupLoginThrottles(); err != nil {
+			log.Printf("Failed to clean up login throttles: %v", err)
+		}
+
+		if _, err := handlers.CleanupExpiredOIDCStates(); err != nil {
+			log.Printf("Failed to clean up OIDC login states: %v", err)
+		}
+
+		if _, err := handlers.CleanupAuthSessions(); err != nil {
+			log.Printf("Failed to clean up login sessions: %v", err)
+		}
+
+		if purged, err := outbox.Purge(config.AppConfig.Outbox.RetentionDays); err != nil {
+			log.Printf("Failed to purge outbox events: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d delivered outbox events", purged)
+		}
+
+		if _, err := handlers.CleanupWebhookDeliveries(); err != nil {
+			log.Printf("Failed to clean up webhook deliveries: %v", err)
+		}
+
+		if finalized, err := handlers.RotateSeasons(time.Now()); err != nil {
+			log.Printf("Failed to rotate seasons: %v", err)
+		} else if finalized > 0 {
+			log.Printf("Finalized %d seasons", finalized)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+)
+
+const usage = `Usage:
+  users role <email> <role>   Set a user's role (student, school_admin, admin)
+
+Use this to grant the first admin; afterwards roles can be managed through
+PUT /api/v1/admin/users/:id/role.`
+
+// users manages user accounts from the command line
+func main() {
+	if len(os.Args) != 4 || os.Args[1] != "role" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	role := models.UserRole(os.Args[3])
+	if !role.IsValid() {
+		fmt.Fprintf(os.Stderr, "Unknown role %q\n\n%s\n", os.Args[3], usage)
+		os.Exit(2)
+	}
+
+	// Load configuration
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	result := database.DB.Model(&models.User{}).Where("email = ?", os.Args[2]).Update("role", role)
+	if result.Error != nil {
+		log.Fatalf("Failed to update role: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Fatalf("User %q not found", os.Args[2])
+	}
+	fmt.Printf("Set role of %s to %s\n", os.Args[2], role)
+}
@@ -11,11 +11,23 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	CORS     CORSConfig
-	Points   PointsConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	JWT         JWTConfig
+	CORS        CORSConfig
+	Points      PointsConfig
+	Levels      LevelConfig
+	Seasons     SeasonConfig
+	Idempotency IdempotencyConfig
+	Trash       TrashConfig
+	Outbox      OutboxConfig
+	Webhooks    WebhookConfig
+	Stats       StatsConfig
+	Account     AccountConfig
+	Mail        MailConfig
+	Password    PasswordPolicyConfig
+	Login       LoginThrottleConfig
+	OIDC        OIDCConfig
 }
 
 type ServerConfig struct {
@@ -33,9 +45,17 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
+	// Secret signs HS256 tokens when no signing key file is set. With a key
+	// file it is only used to accept HS256 tokens issued before the switch.
 	Secret            string
 	Expiration        time.Duration
 	RefreshExpiration time.Duration
+	// SigningKeyFile is a PEM private key (RSA, Ed25519 or ECDSA) used to
+	// sign tokens with RS256, EdDSA or ES256
+	SigningKeyFile string
+	// VerificationKeyFiles are PEM keys of retired signing keys whose tokens
+	// are still accepted during a rotation
+	VerificationKeyFiles []string
 }
 
 type CORSConfig struct {
@@ -47,6 +67,124 @@ type PointsConfig struct {
 	StreakBonusEnabled  bool
 }
 
+// LevelConfig defines the leveling curve. Reaching level 2 takes BasePoints
+// and every further level takes Growth times as many points as the previous
+// one, up to MaxLevel.
+type LevelConfig struct {
+	BasePoints int
+	Growth     float64
+	MaxLevel   int
+}
+
+// SeasonConfig lists the kinds of season (weekly, monthly) that are started
+// automatically at every boundary
+type SeasonConfig struct {
+	Kinds []string
+}
+
+type IdempotencyConfig struct {
+	TTL   time.Duration
+	Lease time.Duration
+}
+
+type TrashConfig struct {
+	RetentionDays int
+}
+
+// OutboxConfig controls delivery of domain events from the outbox
+type OutboxConfig struct {
+	PollInterval time.Duration
+	// MaxAttempts is how many times a failing subscriber is retried before
+	// the event is given up on
+	MaxAttempts int
+	// RetentionDays is how long delivered events are kept
+	RetentionDays int
+}
+
+// WebhookConfig controls delivery to user-registered webhooks. A failed
+// delivery is retried with exponential backoff up to MaxAttempts times; a
+// webhook whose attempts fail DisableAfterFailures times in a row is disabled.
+type WebhookConfig struct {
+	Timeout              time.Duration
+	MaxAttempts          int
+	DisableAfterFailures int
+	MaxPerUser           int
+	// AllowPrivateNetworks lets webhooks reach loopback and private
+	// addresses. Only for development.
+	AllowPrivateNetworks bool
+	// RetentionDays is how long the delivery history is kept
+	RetentionDays int
+}
+
+// StatsConfig controls focus statistics
+type StatsConfig struct {
+	// Timezone is the IANA time zone hour-of-day and weekday statistics are
+	// computed in when the client doesn't pass one
+	Timezone string
+}
+
+type AccountConfig struct {
+	DeletionGraceDays    int
+	EmailVerificationTTL time.Duration
+	PasswordResetTTL     time.Duration
+	// RecentLoginWindow is how recently users without a password must have
+	// logged in to confirm sensitive actions
+	RecentLoginWindow time.Duration
+	// FrontendURL is used to build links in emails
+	FrontendURL string
+}
+
+type MailConfig struct {
+	Driver       string // smtp, file, log
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string
+}
+
+type PasswordPolicyConfig struct {
+	MinLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols
+	// a password must mix
+	MinClasses  int
+	BlockCommon bool
+}
+
+// LoginThrottleConfig controls lockout after repeated failed logins. Once
+// MaxAttempts failures pile up within Window, the account (or IP) is locked
+// for BaseLockout, doubling with every further failure up to MaxLockout.
+type LoginThrottleConfig struct {
+	MaxAttempts   int
+	IPMaxAttempts int
+	Window        time.Duration
+	BaseLockout   time.Duration
+	MaxLockout    time.Duration
+}
+
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+	// StateTTL is how long a login may take between redirect and callback
+	StateTTL time.Duration
+}
+
+// OIDCProviderConfig configures one OpenID Connect provider, e.g. Google or a
+// school's SSO. Loaded from OIDC_<NAME>_* variables for every name listed in
+// OIDC_PROVIDERS.
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AllowedDomains restricts sign-in to these email domains. Empty allows any.
+	AllowedDomains []string
+	// AssignSchool sets the school of new users from their email domain
+	AssignSchool bool
+}
+
 var AppConfig *Config
 
 // Load loads configuration from environment variables
@@ -66,6 +204,34 @@ func Load() error {
 		jwtRefreshExpiration = 168 * time.Hour
 	}
 
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		idempotencyTTL = 24 * time.Hour
+	}
+
+	idempotencyLease, err := time.ParseDuration(getEnv("IDEMPOTENCY_LEASE", "1m"))
+	if err != nil {
+		idempotencyLease = time.Minute
+	}
+
+	emailVerificationTTL, err := time.ParseDuration(getEnv("EMAIL_VERIFICATION_TTL", "24h"))
+	if err != nil {
+		emailVerificationTTL = 24 * time.Hour
+	}
+
+	passwordResetTTL, err := time.ParseDuration(getEnv("PASSWORD_RESET_TTL", "1h"))
+	if err != nil {
+		passwordResetTTL = time.Hour
+	}
+
+	statsTimezone := getEnv("STATS_TIMEZONE", "Asia/Taipei")
+	if _, err := time.LoadLocation(statsTimezone); err != nil {
+		log.Printf("Invalid STATS_TIMEZONE %q, using UTC", statsTimezone)
+		statsTimezone = "UTC"
+	}
+
+	frontendURL := strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/")
+
 	AppConfig = &Config{
 		Server: ServerConfig{
 			Port: getEnv("PORT", "8080"),
@@ -80,9 +246,11 @@ func Load() error {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:            getEnv("JWT_SECRET", ""),
-			Expiration:        jwtExpiration,
-			RefreshExpiration: jwtRefreshExpiration,
+			Secret:               getEnv("JWT_SECRET", ""),
+			Expiration:           jwtExpiration,
+			RefreshExpiration:    jwtRefreshExpiration,
+			SigningKeyFile:       getEnv("JWT_SIGNING_KEY_FILE", ""),
+			VerificationKeyFiles: getEnvAsList("JWT_VERIFICATION_KEY_FILES", ""),
 		},
 		CORS: CORSConfig{
 			AllowedOrigins: strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:3000"), ","),
@@ -91,11 +259,74 @@ func Load() error {
 			BasePointsPerMinute: getEnvAsInt("BASE_POINTS_PER_MINUTE", 10),
 			StreakBonusEnabled:  getEnvAsBool("STREAK_BONUS_ENABLED", true),
 		},
+		Levels: LevelConfig{
+			BasePoints: getEnvAsInt("LEVEL_BASE_POINTS", 500),
+			Growth:     getEnvAsFloat("LEVEL_GROWTH", 1.2),
+			MaxLevel:   getEnvAsInt("LEVEL_MAX", 100),
+		},
+		Seasons: SeasonConfig{
+			Kinds: getEnvAsList("SEASON_KINDS", "weekly,monthly"),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:   idempotencyTTL,
+			Lease: idempotencyLease,
+		},
+		Trash: TrashConfig{
+			RetentionDays: getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		},
+		Outbox: OutboxConfig{
+			PollInterval:  getEnvAsDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			MaxAttempts:   getEnvAsInt("OUTBOX_MAX_ATTEMPTS", 10),
+			RetentionDays: getEnvAsInt("OUTBOX_RETENTION_DAYS", 7),
+		},
+		Webhooks: WebhookConfig{
+			Timeout:              getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts:          getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			DisableAfterFailures: getEnvAsInt("WEBHOOK_DISABLE_AFTER_FAILURES", 20),
+			MaxPerUser:           getEnvAsInt("WEBHOOK_MAX_PER_USER", 10),
+			AllowPrivateNetworks: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+			RetentionDays:        getEnvAsInt("WEBHOOK_RETENTION_DAYS", 30),
+		},
+		Stats: StatsConfig{
+			Timezone: statsTimezone,
+		},
+		Account: AccountConfig{
+			DeletionGraceDays:    getEnvAsInt("ACCOUNT_DELETION_GRACE_DAYS", 7),
+			EmailVerificationTTL: emailVerificationTTL,
+			PasswordResetTTL:     passwordResetTTL,
+			RecentLoginWindow:    getEnvAsDuration("ACCOUNT_RECENT_LOGIN_WINDOW", 10*time.Minute),
+			FrontendURL:          frontendURL,
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "Tomato <no-reply@localhost>"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			FileDir:      getEnv("MAIL_FILE_DIR", "tmp/mail"),
+		},
+		Password: PasswordPolicyConfig{
+			MinLength:   getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+			MinClasses:  getEnvAsInt("PASSWORD_MIN_CLASSES", 2),
+			BlockCommon: getEnvAsBool("PASSWORD_BLOCK_COMMON", true),
+		},
+		Login: LoginThrottleConfig{
+			MaxAttempts:   getEnvAsInt("LOGIN_MAX_ATTEMPTS", 5),
+			IPMaxAttempts: getEnvAsInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+			Window:        getEnvAsDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+			BaseLockout:   getEnvAsDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+			MaxLockout:    getEnvAsDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+		},
+		OIDC: OIDCConfig{
+			Providers: loadOIDCProviders(frontendURL),
+			StateTTL:  getEnvAsDuration("OIDC_STATE_TTL", 10*time.Minute),
+		},
 	}
 
 	// Validate required fields
-	if AppConfig.JWT.Secret == "" {
-		log.Fatal("JWT_SECRET is required")
+	if AppConfig.JWT.Secret == "" && AppConfig.JWT.SigningKeyFile == "" {
+		log.Fatal("JWT_SECRET or JWT_SIGNING_KEY_FILE is required")
 	}
 
 	if AppConfig.Database.Password == "" {
@@ -120,6 +351,14 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	valueStr := getEnv(key, "")
 	if value, err := strconv.ParseBool(valueStr); err == nil {
@@ -127,3 +366,42 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsList splits a comma separated variable, dropping empty entries
+func getEnvAsList(key string, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func loadOIDCProviders(frontendURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvAsList("OIDC_PROVIDERS", "") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:           name,
+			IssuerURL:      strings.TrimRight(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:       getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret:   getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:    getEnv(prefix+"REDIRECT_URL", frontendURL+"/auth/callback/"+name),
+			Scopes:         strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			AllowedDomains: getEnvAsList(prefix+"ALLOWED_DOMAINS", ""),
+			AssignSchool:   getEnvAsBool(prefix+"ASSIGN_SCHOOL", true),
+		})
+	}
+	return providers
+}
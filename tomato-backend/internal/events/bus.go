@@ -0,0 +1,128 @@
+// Package events is an in-memory publish/subscribe bus that carries change
+// notifications from the handlers to live clients. Events are not persisted;
+// a client that misses some reloads its data when it reconnects.
+package events
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// subscriberBuffer is how many events may queue up for a slow subscriber
+// before it is dropped
+const subscriberBuffer = 64
+
+// Event is a change notification
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// UserTopic is the topic of events about one user's own data
+func UserTopic(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// SchoolTopic is the topic of events about a school
+func SchoolTopic(schoolID uuid.UUID) string {
+	return "school:" + schoolID.String()
+}
+
+// Bus delivers published events to the subscribers of their topic. It is
+// safe for concurrent use.
+type Bus struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]bool
+}
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{topics: map[string]map[*Subscription]bool{}}
+}
+
+// Subscription receives the events of one or more topics
+type Subscription struct {
+	bus    *Bus
+	topics []string
+	ch     chan Event
+	closed bool
+}
+
+// Subscribe starts receiving the events published to the given topics. The
+// subscription must be closed when no longer needed.
+func (b *Bus) Subscribe(topics ...string) *Subscription {
+	s := &Subscription{bus: b, topics: topics, ch: make(chan Event, subscriberBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, topic := range topics {
+		if b.topics[topic] == nil {
+			b.topics[topic] = map[*Subscription]bool{}
+		}
+		b.topics[topic][s] = true
+	}
+	return s
+}
+
+// Events returns the channel events arrive on. It is closed when the
+// subscription is closed, including when the bus drops a subscriber that
+// doesn't keep up.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close stops the subscription. It may be called more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove unsubscribes s. Must be called with the write lock held.
+func (b *Bus) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ch)
+
+	for _, topic := range s.topics {
+		delete(b.topics[topic], s)
+		if len(b.topics[topic]) == 0 {
+			delete(b.topics, topic)
+		}
+	}
+}
+
+// Publish sends the event to every subscriber of the topic without
+// blocking. Subscribers whose queue is full are dropped so that they resync.
+func (b *Bus) Publish(topic string, event Event) {
+	var slow []*Subscription
+
+	b.mu.RLock()
+	for s := range b.topics[topic] {
+		select {
+		case s.ch <- event:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	if len(slow) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range slow {
+		b.remove(s)
+	}
+}
+
+// Active reports whether anyone is subscribed at all
+func (b *Bus) Active() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics) > 0
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPublishReachesTopicSubscribers(t *testing.T) {
+	bus := NewBus()
+	alice, bob, school := uuid.New(), uuid.New(), uuid.New()
+
+	a := bus.Subscribe(UserTopic(alice), SchoolTopic(school))
+	defer a.Close()
+	b := bus.Subscribe(UserTopic(bob))
+	defer b.Close()
+
+	bus.Publish(UserTopic(alice), Event{Type: "mine"})
+	bus.Publish(SchoolTopic(school), Event{Type: "school"})
+	bus.Publish(UserTopic(uuid.New()), Event{Type: "nobody"})
+
+	for _, want := range []string{"mine", "school"} {
+		if got := <-a.Events(); got.Type != want {
+			t.Errorf("Expected %s event, got %s", want, got.Type)
+		}
+	}
+	select {
+	case event := <-b.Events():
+		t.Errorf("Expected bob to get nothing, got %+v", event)
+	default:
+	}
+}
+
+func TestCloseUnsubscribes(t *testing.T) {
+	bus := NewBus()
+	topic := UserTopic(uuid.New())
+
+	s := bus.Subscribe(topic)
+	if !bus.Active() {
+		t.Fatal("Expected the bus to be active with a subscriber")
+	}
+
+	s.Close()
+	s.Close()
+	if bus.Active() {
+		t.Error("Expected the bus to be idle after the subscriber left")
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Error("Expected the events channel to be closed")
+	}
+
+	// Publishing to a topic without subscribers is a no-op
+	bus.Publish(topic, Event{Type: "late"})
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	bus := NewBus()
+	topic := UserTopic(uuid.New())
+
+	slow := bus.Subscribe(topic)
+	defer slow.Close()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.Publish(topic, Event{Type: "tick"})
+	}
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected the %d queued events before the channel closed, got %d", subscriberBuffer, received)
+	}
+	if bus.Active() {
+		t.Error("Expected the slow subscriber to be removed")
+	}
+}
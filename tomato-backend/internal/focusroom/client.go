@@ -0,0 +1,100 @@
+package focusroom
+
+import (
+	"log"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+// sendBuffer is how many events may queue up for a slow client before it is
+// disconnected
+const sendBuffer = 32
+
+// maxCommandBytes caps the size of a message from a client
+const maxCommandBytes = 4096
+
+// Client is one WebSocket connection to a room
+type Client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	roomID string
+	userID uuid.UUID
+	name   string
+	send   chan Event
+	// removed is set by the hub once the client may no longer be in the room
+	removed bool
+}
+
+// deliver queues an event for the client. Called from the hub goroutine; a
+// client that can't keep up is disconnected rather than blocking the hub.
+func (c *Client) deliver(event Event) {
+	select {
+	case c.send <- event:
+	default:
+		log.Printf("Focus room client of user %s is too slow, disconnecting", c.userID)
+		c.conn.Close()
+	}
+}
+
+// Serve joins the room over conn as the given user and blocks until the
+// connection closes
+func (h *Hub) Serve(conn *websocket.Conn, roomID string, userID uuid.UUID, name string) {
+	conn.MaxPayloadBytes = maxCommandBytes
+
+	c := &Client{
+		hub:    h,
+		conn:   conn,
+		roomID: roomID,
+		userID: userID,
+		name:   name,
+		send:   make(chan Event, sendBuffer),
+	}
+
+	go c.writeEvents()
+	if !h.submit(h.join, c) {
+		conn.Close()
+		return
+	}
+	c.readCommands()
+	h.submit(h.leave, c)
+}
+
+// submit hands the client to the hub unless the hub has stopped
+func (h *Hub) submit(ch chan *Client, c *Client) bool {
+	select {
+	case ch <- c:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// readCommands forwards commands to the hub until the connection fails
+func (c *Client) readCommands() {
+	for {
+		var cmd Command
+		if err := websocket.JSON.Receive(c.conn, &cmd); err != nil {
+			return
+		}
+		select {
+		case c.hub.commands <- command{client: c, Command: cmd}:
+		case <-c.hub.done:
+			return
+		}
+	}
+}
+
+// writeEvents sends queued events until the hub closes the queue
+func (c *Client) writeEvents() {
+	defer c.conn.Close()
+
+	for event := range c.send {
+		if err := websocket.JSON.Send(c.conn, event); err != nil {
+			return
+		}
+		if event.Type == EventRemoved {
+			return
+		}
+	}
+}
@@ -0,0 +1,432 @@
+// Package focusroom tracks live study rooms where members focus together.
+// All room state lives in memory and is owned by the Hub goroutine; clients
+// talk to it over channels.
+package focusroom
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types sent to clients
+const (
+	// EventState is the full room state, sent to a client when it joins
+	EventState = "state"
+	EventJoin  = "join"
+	EventLeave = "leave"
+	EventStart = "start"
+	// EventTick reports the remaining time of the running pomodoro
+	EventTick   = "tick"
+	EventFinish = "finish"
+	EventCancel = "cancel"
+	EventError  = "error"
+	// EventRemoved is the last event a client gets before it is disconnected
+	// for no longer being allowed in the room
+	EventRemoved = "removed"
+)
+
+// Command types sent by clients
+const (
+	CommandStart  = "start"
+	CommandCancel = "cancel"
+)
+
+const (
+	// DefaultMinutes is the length of a pomodoro started without one
+	DefaultMinutes = 25
+	// MaxMinutes caps the length of a room pomodoro
+	MaxMinutes = 180
+	// removalBuffer is how many removals may queue up for the hub, so that
+	// callers don't wait on it
+	removalBuffer = 64
+)
+
+// Member is a user present in a room
+type Member struct {
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	// Focusing is set while the member takes part in the running pomodoro
+	Focusing         bool `json:"focusing"`
+	RemainingSeconds int  `json:"remaining_seconds,omitempty"`
+}
+
+// PomodoroState describes the running pomodoro of a room
+type PomodoroState struct {
+	Minutes          int         `json:"minutes"`
+	StartedBy        uuid.UUID   `json:"started_by"`
+	StartedAt        time.Time   `json:"started_at"`
+	EndsAt           time.Time   `json:"ends_at"`
+	RemainingSeconds int         `json:"remaining_seconds"`
+	Participants     []uuid.UUID `json:"participants"`
+}
+
+// Event is a message sent to clients
+type Event struct {
+	Type     string         `json:"type"`
+	Member   *Member        `json:"member,omitempty"`
+	Members  []Member       `json:"members,omitempty"`
+	Pomodoro *PomodoroState `json:"pomodoro,omitempty"`
+	Message  string         `json:"message,omitempty"`
+}
+
+// Command is a message sent by a client
+type Command struct {
+	Type    string `json:"type"`
+	Minutes int    `json:"minutes"`
+}
+
+// Pomodoro is a finished room pomodoro, reported so that each participant
+// gets a focus session
+type Pomodoro struct {
+	RoomID       string
+	Minutes      int
+	StartedAt    time.Time
+	EndedAt      time.Time
+	Participants []uuid.UUID
+}
+
+type pomodoro struct {
+	minutes      int
+	startedBy    uuid.UUID
+	startedAt    time.Time
+	endsAt       time.Time
+	participants map[uuid.UUID]bool
+}
+
+type room struct {
+	id      string
+	clients map[*Client]bool
+	// names of the present users, with how many connections each has open
+	names       map[uuid.UUID]string
+	connections map[uuid.UUID]int
+	pomodoro    *pomodoro
+}
+
+type command struct {
+	client *Client
+	Command
+}
+
+// removal disconnects a user, or everyone when userID is nil, from a room
+type removal struct {
+	roomID  string
+	userID  uuid.UUID
+	message string
+}
+
+// Hub owns all rooms. Its fields may only be changed before Start.
+type Hub struct {
+	// TickInterval is how often running pomodoros report their remaining time
+	TickInterval time.Duration
+	// Now returns the current time
+	Now func() time.Time
+	// OnFinish is called, outside the hub goroutine, for every pomodoro that
+	// ran to the end with at least one participant left
+	OnFinish func(Pomodoro)
+
+	rooms    map[string]*room
+	join     chan *Client
+	leave    chan *Client
+	commands chan command
+	removals chan removal
+	done     chan struct{}
+}
+
+// NewHub creates a hub that reports finished pomodoros to onFinish
+func NewHub(onFinish func(Pomodoro)) *Hub {
+	return &Hub{
+		TickInterval: time.Second,
+		Now:          time.Now,
+		OnFinish:     onFinish,
+		rooms:        map[string]*room{},
+		join:         make(chan *Client),
+		leave:        make(chan *Client),
+		commands:     make(chan command),
+		removals:     make(chan removal, removalBuffer),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start runs the hub goroutine until the returned stop function is called
+func (h *Hub) Start() (stop func()) {
+	go h.run()
+	return func() { close(h.done) }
+}
+
+func (h *Hub) run() {
+	ticker := time.NewTicker(h.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case c := <-h.join:
+			h.handleJoin(c)
+		case c := <-h.leave:
+			h.handleLeave(c)
+		case cmd := <-h.commands:
+			h.handleCommand(cmd)
+		case rm := <-h.removals:
+			h.handleRemoval(rm)
+		case <-ticker.C:
+			h.tick()
+		case <-h.done:
+			for _, r := range h.rooms {
+				for c := range r.clients {
+					close(c.send)
+				}
+			}
+			h.rooms = map[string]*room{}
+			return
+		}
+	}
+}
+
+// Kick disconnects every connection of userID from the room, e.g. after they
+// left or were removed from the group
+func (h *Hub) Kick(roomID string, userID uuid.UUID) {
+	h.remove(removal{roomID: roomID, userID: userID, message: "你已不是此群組的成員"})
+}
+
+// CloseRoom disconnects everyone from the room, e.g. after the group was
+// deleted
+func (h *Hub) CloseRoom(roomID string) {
+	h.remove(removal{roomID: roomID, message: "群組已刪除"})
+}
+
+func (h *Hub) remove(rm removal) {
+	select {
+	case h.removals <- rm:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) handleJoin(c *Client) {
+	r, ok := h.rooms[c.roomID]
+	if !ok {
+		r = &room{
+			id:          c.roomID,
+			clients:     map[*Client]bool{},
+			names:       map[uuid.UUID]string{},
+			connections: map[uuid.UUID]int{},
+		}
+		h.rooms[c.roomID] = r
+	}
+
+	r.clients[c] = true
+	r.connections[c.userID]++
+	r.names[c.userID] = c.name
+
+	// Another tab of a present user is not a new member
+	if r.connections[c.userID] == 1 {
+		member := r.member(c.userID, h.Now())
+		h.broadcast(r, Event{Type: EventJoin, Member: &member}, c)
+	}
+	c.deliver(Event{Type: EventState, Members: r.members(h.Now()), Pomodoro: r.pomodoroState(h.Now())})
+}
+
+func (h *Hub) handleLeave(c *Client) {
+	r, ok := h.rooms[c.roomID]
+	if !ok || !r.clients[c] {
+		return
+	}
+
+	delete(r.clients, c)
+	close(c.send)
+
+	r.connections[c.userID]--
+	if r.connections[c.userID] > 0 {
+		return
+	}
+	delete(r.connections, c.userID)
+	delete(r.names, c.userID)
+
+	// Leaving forfeits the running pomodoro
+	if r.pomodoro != nil {
+		delete(r.pomodoro.participants, c.userID)
+	}
+
+	if len(r.clients) == 0 {
+		delete(h.rooms, r.id)
+		return
+	}
+	h.broadcast(r, Event{Type: EventLeave, Member: &Member{UserID: c.userID, Name: c.name}}, nil)
+	if r.pomodoro != nil && len(r.pomodoro.participants) == 0 {
+		r.pomodoro = nil
+		h.broadcast(r, Event{Type: EventCancel, Message: "所有參與者都已離開"}, nil)
+	}
+}
+
+// handleRemoval tells the removed clients why and lets them disconnect. They
+// forfeit the running pomodoro right away and can no longer send commands.
+func (h *Hub) handleRemoval(rm removal) {
+	r, ok := h.rooms[rm.roomID]
+	if !ok {
+		return
+	}
+
+	for c := range r.clients {
+		if rm.userID != uuid.Nil && c.userID != rm.userID {
+			continue
+		}
+		if c.removed {
+			continue
+		}
+		c.removed = true
+		c.deliver(Event{Type: EventRemoved, Message: rm.message})
+		if r.pomodoro != nil {
+			delete(r.pomodoro.participants, c.userID)
+		}
+	}
+}
+
+func (h *Hub) handleCommand(cmd command) {
+	c := cmd.client
+	r, ok := h.rooms[c.roomID]
+	if !ok || !r.clients[c] || c.removed {
+		return
+	}
+	now := h.Now()
+
+	switch cmd.Type {
+	case CommandStart:
+		if r.pomodoro != nil {
+			c.deliver(Event{Type: EventError, Message: "番茄鐘已在進行中"})
+			return
+		}
+		minutes := cmd.Minutes
+		if minutes == 0 {
+			minutes = DefaultMinutes
+		}
+		if minutes < 1 || minutes > MaxMinutes {
+			c.deliver(Event{Type: EventError, Message: "番茄鐘長度需介於 1 到 180 分鐘"})
+			return
+		}
+
+		// Everyone present takes part
+		participants := make(map[uuid.UUID]bool, len(r.connections))
+		for userID := range r.connections {
+			participants[userID] = true
+		}
+		r.pomodoro = &pomodoro{
+			minutes:      minutes,
+			startedBy:    c.userID,
+			startedAt:    now,
+			endsAt:       now.Add(time.Duration(minutes) * time.Minute),
+			participants: participants,
+		}
+		h.broadcast(r, Event{Type: EventStart, Members: r.members(now), Pomodoro: r.pomodoroState(now)}, nil)
+
+	case CommandCancel:
+		if r.pomodoro == nil {
+			c.deliver(Event{Type: EventError, Message: "目前沒有進行中的番茄鐘"})
+			return
+		}
+		if r.pomodoro.startedBy != c.userID {
+			c.deliver(Event{Type: EventError, Message: "只有開始番茄鐘的人可以取消"})
+			return
+		}
+		r.pomodoro = nil
+		h.broadcast(r, Event{Type: EventCancel, Member: &Member{UserID: c.userID, Name: c.name}}, nil)
+
+	default:
+		c.deliver(Event{Type: EventError, Message: "未知的指令"})
+	}
+}
+
+// tick reports the remaining time of running pomodoros and finishes those
+// that are due
+func (h *Hub) tick() {
+	now := h.Now()
+	for _, r := range h.rooms {
+		p := r.pomodoro
+		if p == nil {
+			continue
+		}
+
+		if now.Before(p.endsAt) {
+			h.broadcast(r, Event{Type: EventTick, Pomodoro: r.pomodoroState(now)}, nil)
+			continue
+		}
+
+		state := r.pomodoroState(now)
+		r.pomodoro = nil
+		h.broadcast(r, Event{Type: EventFinish, Members: r.members(now), Pomodoro: state}, nil)
+
+		if h.OnFinish != nil && len(state.Participants) > 0 {
+			finished := Pomodoro{
+				RoomID:       r.id,
+				Minutes:      p.minutes,
+				StartedAt:    p.startedAt,
+				EndedAt:      p.endsAt,
+				Participants: state.Participants,
+			}
+			go h.OnFinish(finished)
+		}
+	}
+}
+
+// broadcast sends the event to every client in the room except skip
+func (h *Hub) broadcast(r *room, event Event, skip *Client) {
+	for c := range r.clients {
+		if c != skip {
+			c.deliver(event)
+		}
+	}
+}
+
+func (r *room) member(userID uuid.UUID, now time.Time) Member {
+	m := Member{UserID: userID, Name: r.names[userID]}
+	if r.pomodoro != nil && r.pomodoro.participants[userID] {
+		m.Focusing = true
+		m.RemainingSeconds = remainingSeconds(r.pomodoro, now)
+	}
+	return m
+}
+
+// members lists the present users by name
+func (r *room) members(now time.Time) []Member {
+	members := make([]Member, 0, len(r.names))
+	for userID := range r.names {
+		members = append(members, r.member(userID, now))
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Name != members[j].Name {
+			return members[i].Name < members[j].Name
+		}
+		return members[i].UserID.String() < members[j].UserID.String()
+	})
+	return members
+}
+
+func (r *room) pomodoroState(now time.Time) *PomodoroState {
+	p := r.pomodoro
+	if p == nil {
+		return nil
+	}
+
+	participants := make([]uuid.UUID, 0, len(p.participants))
+	for userID := range p.participants {
+		participants = append(participants, userID)
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].String() < participants[j].String() })
+
+	return &PomodoroState{
+		Minutes:          p.minutes,
+		StartedBy:        p.startedBy,
+		StartedAt:        p.startedAt,
+		EndsAt:           p.endsAt,
+		RemainingSeconds: remainingSeconds(p, now),
+		Participants:     participants,
+	}
+}
+
+func remainingSeconds(p *pomodoro, now time.Time) int {
+	remaining := p.endsAt.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	// Round up so that a pomodoro shows 0 only when it is over
+	return int((remaining + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,231 @@
+package focusroom
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+// fakeClock is a clock the test moves forward by hand
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func setupHub(t *testing.T) (*Hub, *httptest.Server, *fakeClock, chan Pomodoro, func()) {
+	clock := &fakeClock{now: time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)}
+	finished := make(chan Pomodoro, 1)
+
+	hub := NewHub(func(p Pomodoro) { finished <- p })
+	hub.TickInterval = 5 * time.Millisecond
+	hub.Now = clock.Now
+	stop := hub.Start()
+
+	// The user is passed in the URL; the real endpoint authenticates first
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		query := conn.Request().URL.Query()
+		hub.Serve(conn, query.Get("room"), uuid.MustParse(query.Get("user")), query.Get("name"))
+	}))
+
+	return hub, server, clock, finished, func() {
+		server.Close()
+		stop()
+	}
+}
+
+type testClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func connect(t *testing.T, server *httptest.Server, room string, userID uuid.UUID, name string) *testClient {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?room=" + room + "&user=" + userID.String() + "&name=" + name
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return &testClient{t: t, conn: conn}
+}
+
+func (c *testClient) send(cmd Command) {
+	if err := websocket.JSON.Send(c.conn, cmd); err != nil {
+		c.t.Fatalf("Failed to send command: %v", err)
+	}
+}
+
+// expect reads events until one of the given type arrives, skipping ticks
+func (c *testClient) expect(eventType string) Event {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var event Event
+		if err := websocket.JSON.Receive(c.conn, &event); err != nil {
+			c.t.Fatalf("Expected %s event, got error: %v", eventType, err)
+		}
+		if event.Type == eventType {
+			return event
+		}
+		if event.Type != EventTick {
+			c.t.Fatalf("Expected %s event, got %+v", eventType, event)
+		}
+	}
+}
+
+func TestRoomPomodoro(t *testing.T) {
+	_, server, clock, finished, cleanup := setupHub(t)
+	defer cleanup()
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	a := connect(t, server, "room", alice, "alice")
+	defer a.conn.Close()
+	if state := a.expect(EventState); len(state.Members) != 1 || state.Pomodoro != nil {
+		t.Fatalf("Expected an idle room with one member, got %+v", state)
+	}
+
+	b := connect(t, server, "room", bob, "bob")
+	defer b.conn.Close()
+	b.expect(EventState)
+	if join := a.expect(EventJoin); join.Member.UserID != bob {
+		t.Errorf("Expected bob to join, got %+v", join.Member)
+	}
+
+	// Rooms are separate
+	other := connect(t, server, "other", carol, "carol")
+	defer other.conn.Close()
+	if state := other.expect(EventState); len(state.Members) != 1 {
+		t.Errorf("Expected carol alone in her room, got %+v", state.Members)
+	}
+
+	a.send(Command{Type: CommandStart, Minutes: 500})
+	if e := a.expect(EventError); e.Message == "" {
+		t.Error("Expected an error message for a too long pomodoro")
+	}
+
+	a.send(Command{Type: CommandStart})
+	start := b.expect(EventStart)
+	if start.Pomodoro.Minutes != DefaultMinutes || len(start.Pomodoro.Participants) != 2 {
+		t.Fatalf("Expected a 25 minute pomodoro for both, got %+v", start.Pomodoro)
+	}
+	for _, m := range start.Members {
+		if !m.Focusing || m.RemainingSeconds != 25*60 {
+			t.Errorf("Expected %s focusing with 25 minutes left, got %+v", m.Name, m)
+		}
+	}
+	a.expect(EventStart)
+
+	// Only the starter may cancel
+	b.send(Command{Type: CommandCancel})
+	b.expect(EventError)
+
+	clock.Advance(10 * time.Minute)
+	var tick Event
+	for tick.Pomodoro == nil || tick.Pomodoro.RemainingSeconds != 15*60 {
+		tick = a.expect(EventTick)
+	}
+
+	clock.Advance(15 * time.Minute)
+	finish := a.expect(EventFinish)
+	if finish.Pomodoro.RemainingSeconds != 0 {
+		t.Errorf("Expected no time left, got %d", finish.Pomodoro.RemainingSeconds)
+	}
+
+	select {
+	case p := <-finished:
+		if p.RoomID != "room" || p.Minutes != 25 || len(p.Participants) != 2 {
+			t.Errorf("Expected both to finish 25 minutes in room, got %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the finished pomodoro to be reported")
+	}
+}
+
+func TestLeavingForfeitsPomodoro(t *testing.T) {
+	_, server, clock, finished, cleanup := setupHub(t)
+	defer cleanup()
+
+	alice, bob := uuid.New(), uuid.New()
+
+	a := connect(t, server, "room", alice, "alice")
+	defer a.conn.Close()
+	a.expect(EventState)
+	b := connect(t, server, "room", bob, "bob")
+	b.expect(EventState)
+	a.expect(EventJoin)
+
+	b.send(Command{Type: CommandStart, Minutes: 30})
+	a.expect(EventStart)
+
+	b.conn.Close()
+	if leave := a.expect(EventLeave); leave.Member.UserID != bob {
+		t.Errorf("Expected bob to leave, got %+v", leave.Member)
+	}
+
+	clock.Advance(30 * time.Minute)
+	a.expect(EventFinish)
+
+	p := <-finished
+	if len(p.Participants) != 1 || p.Participants[0] != alice {
+		t.Errorf("Expected only alice to finish, got %v", p.Participants)
+	}
+}
+
+func TestKickAndCloseRoom(t *testing.T) {
+	hub, server, clock, finished, cleanup := setupHub(t)
+	defer cleanup()
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	a := connect(t, server, "room", alice, "alice")
+	defer a.conn.Close()
+	a.expect(EventState)
+	b := connect(t, server, "room", bob, "bob")
+	defer b.conn.Close()
+	b.expect(EventState)
+	a.expect(EventJoin)
+
+	a.send(Command{Type: CommandStart, Minutes: 30})
+	a.expect(EventStart)
+	b.expect(EventStart)
+
+	// A kicked member is told why, disconnected and loses the pomodoro
+	hub.Kick("room", bob)
+	if removed := b.expect(EventRemoved); removed.Message == "" {
+		t.Error("Expected a reason for the removal")
+	}
+	if leave := a.expect(EventLeave); leave.Member.UserID != bob {
+		t.Errorf("Expected bob to leave, got %+v", leave.Member)
+	}
+
+	clock.Advance(30 * time.Minute)
+	a.expect(EventFinish)
+	if p := <-finished; len(p.Participants) != 1 || p.Participants[0] != alice {
+		t.Errorf("Expected only alice to finish, got %v", p.Participants)
+	}
+
+	// Closing the room disconnects everyone
+	c := connect(t, server, "room", carol, "carol")
+	defer c.conn.Close()
+	c.expect(EventState)
+	a.expect(EventJoin)
+
+	hub.CloseRoom("room")
+	a.expect(EventRemoved)
+	c.expect(EventRemoved)
+}
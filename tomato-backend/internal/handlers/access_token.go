@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxAccessTokens caps how many active tokens a user may hold
+	maxAccessTokens = 20
+	// maxAccessTokenDays is the longest expiry that can be chosen; tokens
+	// may also never expire
+	maxAccessTokenDays = 365
+	// accessTokenPrefixLength is how much of a token is kept for display
+	accessTokenPrefixLength = 12
+)
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresInDays sets the expiry; leave it out for a token that doesn't
+	// expire
+	ExpiresInDays *int `json:"expires_in_days"`
+}
+
+// AccessTokenWithSecret is returned when a token is created. The token is
+// not shown again.
+type AccessTokenWithSecret struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// validateAccessTokenScopes checks the requested scopes and removes
+// duplicates
+func validateAccessTokenScopes(scopes []string) ([]string, string) {
+	seen := map[string]bool{}
+	var valid []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if seen[scope] {
+			continue
+		}
+		known := false
+		for _, s := range middleware.AccessTokenScopes {
+			if scope == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, "不支援的權限範圍: " + scope
+		}
+		seen[scope] = true
+		valid = append(valid, scope)
+	}
+	return valid, ""
+}
+
+// revokeAccessTokens revokes all of the user's personal access tokens
+func revokeAccessTokens(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// ListAccessTokens lists the current user's personal access tokens that have
+// not been revoked
+func ListAccessTokens(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢存取權杖失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"tokens": tokens,
+		"scopes": middleware.AccessTokenScopes,
+	}, "")
+}
+
+// CreateAccessToken creates a personal access token. The response includes
+// the token, which is only shown this once.
+func CreateAccessToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.ValidationErrorResponse(c, "名稱不可為空")
+		return
+	}
+	scopes, msg := validateAccessTokenScopes(req.Scopes)
+	if msg != "" {
+		utils.ValidationErrorResponse(c, msg)
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > maxAccessTokenDays {
+			utils.ValidationErrorResponse(c, "有效天數需介於 1 到 365 天")
+			return
+		}
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&count).Error; err != nil {
+		utils.InternalErrorResponse(c, "建立存取權杖失敗")
+		return
+	}
+	if count >= maxAccessTokens {
+		utils.ConflictResponse(c, "存取權杖數量已達上限，請先撤銷不用的權杖")
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken()
+	if err != nil {
+		utils.InternalErrorResponse(c, "建立存取權杖失敗")
+		return
+	}
+	token := models.AccessTokenPrefix + secret
+
+	pat := models.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   utils.HashToken(token),
+		TokenPrefix: token[:accessTokenPrefixLength],
+		Scopes:      scopes,
+		ExpiresAt:   expiresAt,
+	}
+	if err := database.DB.Create(&pat).Error; err != nil {
+		utils.InternalErrorResponse(c, "建立存取權杖失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, AccessTokenWithSecret{PersonalAccessToken: pat, Token: token}, "存取權杖已建立，請妥善保存")
+}
+
+// RevokeAccessToken revokes one of the current user's personal access tokens
+func RevokeAccessToken(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的權杖 ID")
+		return
+	}
+
+	result := database.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.InternalErrorResponse(c, "撤銷存取權杖失敗")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "存取權杖不存在")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, nil, "存取權杖已撤銷")
+}
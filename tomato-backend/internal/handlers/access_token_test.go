@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupAccessTokenTests(t *testing.T) (*gin.Engine, *models.User, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	users := router.Group("/users")
+	users.Use(middleware.AuthMiddleware())
+	users.GET("/me", GetMe)
+	users.PUT("/me/password", ChangePassword)
+	users.GET("/me/tokens", ListAccessTokens)
+	users.POST("/me/tokens", CreateAccessToken)
+	users.DELETE("/me/tokens/:id", RevokeAccessToken)
+	sessions := router.Group("/sessions")
+	sessions.Use(middleware.AuthMiddleware())
+	sessions.GET("", GetSessions)
+	sessions.POST("", CreateSession)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, token, cleanup
+}
+
+// createAccessToken creates a personal access token and returns its ID and
+// the token itself
+func createAccessToken(t *testing.T, router *gin.Engine, token string, body map[string]interface{}) (string, string) {
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/users/me/tokens", token, body)
+	testutil.AssertStatusCode(t, w, 201)
+
+	data := testutil.GetResponseData(t, w).(map[string]interface{})
+	return data["id"].(string), data["token"].(string)
+}
+
+func TestAccessTokenLifecycle(t *testing.T) {
+	router, user, token, cleanup := setupAccessTokenTests(t)
+	defer cleanup()
+
+	tokenID, pat := createAccessToken(t, router, token, map[string]interface{}{
+		"name": "桌上計時器", "scopes": []string{"sessions:write"},
+	})
+	if len(pat) < 40 || pat[:len(models.AccessTokenPrefix)] != models.AccessTokenPrefix {
+		t.Fatalf("Expected a prefixed token, got %q", pat)
+	}
+
+	var stored models.PersonalAccessToken
+	database.DB.First(&stored)
+	if stored.TokenHash != utils.HashToken(pat) || stored.TokenPrefix != pat[:accessTokenPrefixLength] {
+		t.Errorf("Expected only the hash and prefix stored, got %+v", stored)
+	}
+
+	// The granted scope works
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", pat, map[string]interface{}{
+		"date": time.Now().Format("2006-01-02"), "minutes": 25,
+	})
+	testutil.AssertStatusCode(t, w, 201)
+	var count int64
+	database.DB.Model(&models.FocusSession{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the session recorded for the token's owner, got %d", count)
+	}
+
+	database.DB.First(&stored)
+	if stored.LastUsedAt == nil || stored.LastUsedIP == "" {
+		t.Errorf("Expected the last use recorded, got %+v", stored)
+	}
+
+	// Other scopes and routes that need a login are refused
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/sessions"},
+		{"GET", "/users/me"},
+		{"GET", "/users/me/tokens"},
+		{"POST", "/users/me/tokens"},
+		{"PUT", "/users/me/password"},
+	} {
+		w := testutil.MakeAuthenticatedRequest(t, router, req.method, req.path, pat, map[string]interface{}{})
+		testutil.AssertStatusCode(t, w, 403)
+	}
+
+	// The token itself is never listed
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me/tokens", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	tokens := testutil.GetResponseData(t, w).(map[string]interface{})["tokens"].([]interface{})
+	if len(tokens) != 1 {
+		t.Fatalf("Expected 1 token listed, got %d", len(tokens))
+	}
+	if _, ok := tokens[0].(map[string]interface{})["token"]; ok {
+		t.Error("Expected the token to be hidden")
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/users/me/tokens/"+tokenID, token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", pat, map[string]interface{}{
+		"date": time.Now().Format("2006-01-02"), "minutes": 25,
+	})
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/users/me/tokens/"+tokenID, token, nil)
+	testutil.AssertStatusCode(t, w, 404)
+}
+
+func TestCreateAccessTokenValidation(t *testing.T) {
+	router, _, token, cleanup := setupAccessTokenTests(t)
+	defer cleanup()
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "有效的權杖",
+			requestBody:    map[string]interface{}{"name": "CLI", "scopes": []string{"stats:read", "sessions:read"}, "expires_in_days": 30},
+			expectedStatus: 201,
+		},
+		{
+			name:           "不支援的權限範圍",
+			requestBody:    map[string]interface{}{"name": "CLI", "scopes": []string{"admin"}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "缺少權限範圍",
+			requestBody:    map[string]interface{}{"name": "CLI", "scopes": []string{}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "缺少名稱",
+			requestBody:    map[string]interface{}{"scopes": []string{"stats:read"}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "有效天數過長",
+			requestBody:    map[string]interface{}{"name": "CLI", "scopes": []string{"stats:read"}, "expires_in_days": 400},
+			expectedStatus: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/users/me/tokens", token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedStatus == 400 {
+				testutil.AssertError(t, w, "VALIDATION_ERROR")
+			}
+		})
+	}
+}
+
+func TestAccessTokenExpiryAndPasswordChange(t *testing.T) {
+	router, _, token, cleanup := setupAccessTokenTests(t)
+	defer cleanup()
+
+	expiringID, expiring := createAccessToken(t, router, token, map[string]interface{}{
+		"name": "短期", "scopes": []string{"profile:read"}, "expires_in_days": 1,
+	})
+	_, lasting := createAccessToken(t, router, token, map[string]interface{}{
+		"name": "長期", "scopes": []string{"profile:read"},
+	})
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", expiring, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	database.DB.Model(&models.PersonalAccessToken{}).Where("id = ?", expiringID).Update("expires_at", time.Now().Add(-time.Minute))
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", expiring, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	// Changing the password revokes every token
+	w = testutil.MakeAuthenticatedRequest(t, router, "PUT", "/users/me/password", token, map[string]interface{}{
+		"old_password": "password123", "new_password": "newpassword456",
+	})
+	testutil.AssertStatusCode(t, w, 200)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", lasting, nil)
+	testutil.AssertStatusCode(t, w, 401)
+}
+
+func TestAccessTokenNotStoredForIdempotency(t *testing.T) {
+	router, user, token, cleanup := setupAccessTokenTests(t)
+	defer cleanup()
+
+	router.POST("/idempotent/tokens", middleware.AuthMiddleware(), middleware.Idempotency(), middleware.WithholdIdempotentResponse(), CreateAccessToken)
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		"Idempotency-Key": "create-token",
+	}
+	body := map[string]interface{}{"name": "桌上計時器", "scopes": []string{"sessions:write"}}
+
+	w := testutil.MakeRequest(t, router, "POST", "/idempotent/tokens", body, headers)
+	testutil.AssertStatusCode(t, w, 201)
+	pat := testutil.GetResponseData(t, w).(map[string]interface{})["token"].(string)
+
+	var record models.IdempotencyKey
+	if err := database.DB.Where("user_id = ? AND key = ?", user.ID, "create-token").First(&record).Error; err != nil {
+		t.Fatalf("Expected the key to be claimed: %v", err)
+	}
+	if !record.ResponseWithheld || len(record.ResponseBody) != 0 {
+		t.Errorf("Expected the response with the token to be withheld, got %+v", record)
+	}
+
+	// A retry is neither replayed nor executed again
+	w = testutil.MakeRequest(t, router, "POST", "/idempotent/tokens", body, headers)
+	testutil.AssertStatusCode(t, w, 409)
+	if w.Body.Len() == 0 || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Expected the retry to be rejected rather than replayed")
+	}
+	if strings.Contains(w.Body.String(), pat) {
+		t.Error("Expected the retry not to reveal the token")
+	}
+
+	var count int64
+	database.DB.Model(&models.PersonalAccessToken{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 token, got %d", count)
+	}
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountDeletionConfirmation must be sent verbatim to confirm account deletion
+const AccountDeletionConfirmation = "DELETE"
+
+type RequestAccountDeletionRequest struct {
+	// Password is required unless the user only signs in with SSO
+	Password     string `json:"password"`
+	Confirmation string `json:"confirmation" binding:"required"`
+}
+
+// UserDataExport contains all personal data stored for a user
+type UserDataExport struct {
+	ExportedAt   time.Time                    `json:"exported_at"`
+	Profile      models.User                  `json:"profile"`
+	Courses      []models.Course              `json:"courses"`
+	Plans        []models.StudyPlan           `json:"plans"`
+	Todos        []models.Todo                `json:"todos"`
+	Sessions     []models.FocusSession        `json:"sessions"`
+	Points       []models.PointTransaction    `json:"points"`
+	Achievements []models.UserAchievement     `json:"achievements"`
+	StudyGroups  []models.StudyGroup          `json:"study_groups"`
+	Webhooks     []models.Webhook             `json:"webhooks"`
+	AccessTokens []models.PersonalAccessToken `json:"access_tokens"`
+	AuthSessions []exportedAuthSession        `json:"auth_sessions"`
+	Identities   []exportedIdentity           `json:"identities"`
+}
+
+// exportedAuthSession includes revoked sessions, which the API hides
+type exportedAuthSession struct {
+	models.AuthSession
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// exportedIdentity includes the provider subject, which the API hides
+type exportedIdentity struct {
+	models.UserIdentity
+	Subject string `json:"subject"`
+}
+
+// ExportMyData exports the authenticated user's personal data as JSON or ZIP
+func ExportMyData(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	format := c.DefaultQuery("format", "json") // json, zip
+	if format != "json" && format != "zip" {
+		utils.ValidationErrorResponse(c, "format 必須為 json 或 zip")
+		return
+	}
+
+	export, err := collectUserData(userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "匯出資料失敗")
+		return
+	}
+
+	if format == "json" {
+		utils.SuccessResponse(c, 200, export, "")
+		return
+	}
+
+	filename := fmt.Sprintf("tomato-export-%s.zip", export.ExportedAt.Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(200)
+
+	if err := writeExportZip(c.Writer, export); err != nil {
+		// Headers are already sent, so the error can only be recorded
+		c.Error(err)
+	}
+}
+
+// collectUserData loads everything stored for a user, including trashed items
+func collectUserData(userID uuid.UUID) (*UserDataExport, error) {
+	export := &UserDataExport{ExportedAt: time.Now()}
+
+	if err := database.DB.Preload("School").First(&export.Profile, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Unscoped().Where("user_id = ?", userID).Order("created_at").Find(&export.Courses).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Unscoped().Where("user_id = ?", userID).Order("date, start_time").Find(&export.Plans).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Unscoped().Where("user_id = ?", userID).Order("date, created_at").Find(&export.Todos).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Order("date, created_at").Find(&export.Sessions).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&export.Points).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Order("awarded_at").Find(&export.Achievements).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.
+		Joins("JOIN study_group_members m ON m.group_id = study_groups.id").
+		Where("m.user_id = ?", userID).
+		Order("m.joined_at").
+		Find(&export.StudyGroups).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&export.Webhooks).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&export.AccessTokens).Error; err != nil {
+		return nil, err
+	}
+
+	var sessions []models.AuthSession
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	export.AuthSessions = make([]exportedAuthSession, len(sessions))
+	for i, session := range sessions {
+		export.AuthSessions[i] = exportedAuthSession{AuthSession: session, RevokedAt: session.RevokedAt}
+	}
+
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	export.Identities = make([]exportedIdentity, len(identities))
+	for i, identity := range identities {
+		export.Identities[i] = exportedIdentity{UserIdentity: identity, Subject: identity.Subject}
+	}
+
+	return export, nil
+}
+
+// writeExportZip writes one JSON file per data category into a ZIP archive
+func writeExportZip(w io.Writer, export *UserDataExport) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"courses.json", export.Courses},
+		{"plans.json", export.Plans},
+		{"todos.json", export.Todos},
+		{"sessions.json", export.Sessions},
+		{"points.json", export.Points},
+		{"achievements.json", export.Achievements},
+		{"study_groups.json", export.StudyGroups},
+		{"webhooks.json", export.Webhooks},
+		{"access_tokens.json", export.AccessTokens},
+		{"auth_sessions.json", export.AuthSessions},
+		{"identities.json", export.Identities},
+	}
+
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// RequestAccountDeletion schedules the authenticated user's account for
+// deletion after the configured grace period
+func RequestAccountDeletion(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req RequestAccountDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if req.Confirmation != AccountDeletionConfirmation {
+		utils.ValidationErrorResponse(c, fmt.Sprintf("請輸入 %s 以確認刪除帳號", AccountDeletionConfirmation))
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	if user.PasswordHash == "" {
+		// SSO users have no password; a fresh login confirms instead
+		if !loggedInRecently(c, user.ID) {
+			utils.UnauthorizedResponse(c, "請重新登入後再刪除帳號")
+			return
+		}
+	} else if !utils.CheckPassword(req.Password, user.PasswordHash) {
+		utils.UnauthorizedResponse(c, "密碼錯誤")
+		return
+	}
+
+	if user.DeletionScheduledAt != nil {
+		utils.ConflictResponse(c, "帳號已排定刪除")
+		return
+	}
+
+	scheduledAt := time.Now().AddDate(0, 0, config.AppConfig.Account.DeletionGraceDays)
+	if err := database.DB.Model(&user).Update("deletion_scheduled_at", scheduledAt).Error; err != nil {
+		utils.InternalErrorResponse(c, "排定刪除帳號失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 202, gin.H{
+		"deletion_scheduled_at": scheduledAt,
+	}, "帳號將於寬限期後刪除，期間可隨時取消")
+}
+
+// loggedInRecently reports whether the request was made with a login session
+// that started within the recent login window. Refreshing a session doesn't
+// count as logging in again.
+func loggedInRecently(c *gin.Context, userID uuid.UUID) bool {
+	sessionID, ok := middleware.GetSessionID(c)
+	if !ok {
+		return false
+	}
+
+	var count int64
+	since := time.Now().Add(-config.AppConfig.Account.RecentLoginWindow)
+	database.DB.Model(&models.AuthSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND created_at > ?", sessionID, userID, since).
+		Count(&count)
+	return count > 0
+}
+
+// CancelAccountDeletion cancels a pending account deletion
+func CancelAccountDeletion(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Update("deletion_scheduled_at", nil)
+	if result.Error != nil {
+		utils.InternalErrorResponse(c, "取消刪除帳號失敗")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "帳號未排定刪除")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, nil, "已取消刪除帳號")
+}
+
+// PurgeDeletedAccounts permanently deletes accounts whose grace period has
+// ended and returns the number of deleted accounts. An account that fails to
+// delete is logged and retried on the next run.
+func PurgeDeletedAccounts() (int, error) {
+	now := time.Now()
+
+	var userIDs []uuid.UUID
+	if err := database.DB.Model(&models.User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).
+		Pluck("id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		deleted, err := purgeAccount(userID, now)
+		if err != nil {
+			log.Printf("Failed to delete account %s: %v", userID, err)
+			continue
+		}
+		if deleted {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeAccount deletes a user whose deletion is still due at now. The schedule
+// is re-read under the row lock, so an account whose deletion was cancelled
+// after it was listed is kept.
+func purgeAccount(userID uuid.UUID, now time.Time) (bool, error) {
+	deleted := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "school_id", "total_points", "email_verified_at", "leaderboard_banned", "deletion_scheduled_at").
+			First(&user, userID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+
+		if user.DeletionScheduledAt == nil || user.DeletionScheduledAt.After(now) {
+			return nil
+		}
+
+		deleted = true
+		return removeAccount(tx, &user)
+	})
+	return deleted, err
+}
+
+// removeAccount deletes a user locked in tx along with all owned data.
+// Courses, plans, todos and sessions are removed by their OnDelete:CASCADE
+// constraints. Study groups the user owns are handed over to another member
+// first.
+func removeAccount(tx *gorm.DB, user *models.User) error {
+	if user.IsEmailVerified() {
+		if err := adjustSchoolMembership(tx, user.SchoolID, -1, -schoolPoints(user)); err != nil {
+			return err
+		}
+	}
+
+	if err := leaveAllGroups(tx, user.ID); err != nil {
+		return err
+	}
+
+	return tx.Delete(&models.User{}, user.ID).Error
+}
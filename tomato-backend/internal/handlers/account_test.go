@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupAccountTests(t *testing.T) (*gin.Engine, *models.School, *models.User, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/users/me/export", middleware.AuthMiddleware(), ExportMyData)
+	router.POST("/users/me/deletion", middleware.AuthMiddleware(), RequestAccountDeletion)
+	router.DELETE("/users/me/deletion", middleware.AuthMiddleware(), CancelAccountDeletion)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// Generate token
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, school, user, token, cleanup
+}
+
+func TestExportMyData(t *testing.T) {
+	router, _, user, token, cleanup := setupAccountTests(t)
+	defer cleanup()
+
+	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
+	testutil.CreateTestStudyPlan(database.DB, user.ID, &course.ID, "測試計畫", 60)
+	testutil.CreateTestTodo(database.DB, user.ID, &course.ID, "作業", models.TodoTypeHomework)
+	testutil.CreateTestFocusSession(database.DB, user.ID, nil, &course.ID, 25)
+	database.DB.Create(&models.AuthSession{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken("refresh"),
+		IPAddress:        "203.0.113.7",
+		LastSeenAt:       time.Now(),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	})
+	database.DB.Create(&models.UserIdentity{UserID: user.ID, Provider: "google", Subject: "google-subject", Email: user.Email})
+
+	t.Run("JSON 匯出", func(t *testing.T) {
+		w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me/export", token, nil)
+		testutil.AssertStatusCode(t, w, 200)
+		testutil.AssertSuccess(t, w)
+
+		var response utils.Response
+		testutil.ParseResponse(t, w, &response)
+		data := response.Data.(map[string]interface{})
+
+		for _, key := range []string{"courses", "plans", "todos", "sessions", "auth_sessions", "identities"} {
+			items, ok := data[key].([]interface{})
+			if !ok || len(items) != 1 {
+				t.Errorf("Expected 1 item in %s, got %v", key, data[key])
+			}
+		}
+
+		identity := data["identities"].([]interface{})[0].(map[string]interface{})
+		if identity["subject"] != "google-subject" {
+			t.Errorf("Expected the identity subject to be exported, got %v", identity)
+		}
+		session := data["auth_sessions"].([]interface{})[0].(map[string]interface{})
+		if session["ip_address"] != "203.0.113.7" || session["refresh_token_hash"] != nil {
+			t.Errorf("Expected the session's IP without its token hash, got %v", session)
+		}
+
+		profile := data["profile"].(map[string]interface{})
+		if profile["email"] != user.Email {
+			t.Errorf("Expected profile email %s, got %v", user.Email, profile["email"])
+		}
+	})
+
+	t.Run("ZIP 匯出", func(t *testing.T) {
+		w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me/export?format=zip", token, nil)
+		testutil.AssertStatusCode(t, w, 200)
+
+		body := w.Body.Bytes()
+		reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("Response is not a valid zip: %v", err)
+		}
+
+		files := map[string]bool{}
+		for _, f := range reader.File {
+			files[f.Name] = true
+		}
+		for _, name := range []string{"profile.json", "courses.json", "plans.json", "todos.json", "sessions.json", "auth_sessions.json", "identities.json"} {
+			if !files[name] {
+				t.Errorf("Zip missing %s", name)
+			}
+		}
+	})
+
+	t.Run("無效的格式", func(t *testing.T) {
+		w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me/export?format=xml", token, nil)
+		testutil.AssertStatusCode(t, w, 400)
+		testutil.AssertError(t, w, "VALIDATION_ERROR")
+	})
+}
+
+func TestRequestAccountDeletion(t *testing.T) {
+	router, _, user, token, cleanup := setupAccountTests(t)
+	defer cleanup()
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "確認文字錯誤",
+			requestBody: map[string]interface{}{
+				"password":     "password123",
+				"confirmation": "yes",
+			},
+			expectedStatus: 400,
+			expectedError:  "VALIDATION_ERROR",
+		},
+		{
+			name: "密碼錯誤",
+			requestBody: map[string]interface{}{
+				"password":     "wrongpassword",
+				"confirmation": AccountDeletionConfirmation,
+			},
+			expectedStatus: 401,
+			expectedError:  "UNAUTHORIZED",
+		},
+		{
+			name: "成功排定刪除",
+			requestBody: map[string]interface{}{
+				"password":     "password123",
+				"confirmation": AccountDeletionConfirmation,
+			},
+			expectedStatus: 202,
+		},
+		{
+			name: "重複排定刪除",
+			requestBody: map[string]interface{}{
+				"password":     "password123",
+				"confirmation": AccountDeletionConfirmation,
+			},
+			expectedStatus: 409,
+			expectedError:  "CONFLICT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/users/me/deletion", token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+
+			if tt.expectedError != "" {
+				testutil.AssertError(t, w, tt.expectedError)
+			} else {
+				testutil.AssertSuccess(t, w)
+			}
+		})
+	}
+
+	var scheduled models.User
+	database.DB.First(&scheduled, user.ID)
+	if scheduled.DeletionScheduledAt == nil {
+		t.Fatal("Expected deletion to be scheduled")
+	}
+
+	// Cancel within grace period
+	w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/users/me/deletion", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var cancelled models.User
+	database.DB.First(&cancelled, user.ID)
+	if cancelled.DeletionScheduledAt != nil {
+		t.Error("Expected deletion to be cancelled")
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/users/me/deletion", token, nil)
+	testutil.AssertStatusCode(t, w, 404)
+}
+
+func TestRequestAccountDeletionWithoutPassword(t *testing.T) {
+	router, _, user, token, cleanup := setupAccountTests(t)
+	defer cleanup()
+
+	// SSO users have no password
+	database.DB.Model(user).Update("password_hash", "")
+
+	// sessionToken signs in on a device that logged in at loggedInAt
+	sessionToken := func(loggedInAt time.Time) string {
+		session := &models.AuthSession{
+			UserID:           user.ID,
+			RefreshTokenHash: utils.HashToken("refresh"),
+			LastSeenAt:       loggedInAt,
+			ExpiresAt:        time.Now().Add(time.Hour),
+			CreatedAt:        loggedInAt,
+		}
+		if err := database.DB.Create(session).Error; err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		sessionToken, _, _ := utils.GenerateSessionTokens(user, session.ID)
+		return sessionToken
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "未綁定登入裝置", token: token, expectedStatus: 401},
+		{name: "登入已久", token: sessionToken(time.Now().Add(-time.Hour)), expectedStatus: 401},
+		{name: "剛重新登入", token: sessionToken(time.Now()), expectedStatus: 202},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/users/me/deletion", tt.token, map[string]interface{}{
+				"confirmation": AccountDeletionConfirmation,
+			})
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+		})
+	}
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	_, school, user, _, cleanup := setupAccountTests(t)
+	defer cleanup()
+
+	other := testutil.CreateTestUser(database.DB, "other@example.com", "password123", "其他用戶", &school.ID)
+	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
+	testutil.CreateTestFocusSession(database.DB, user.ID, nil, &course.ID, 25)
+
+	database.DB.Model(user).Update("total_points", 250)
+	database.DB.Model(other).Update("total_points", 100)
+	database.DB.Model(school).UpdateColumns(map[string]interface{}{"total_points": 350, "student_count": 2})
+
+	// Not yet due
+	database.DB.Model(other).Update("deletion_scheduled_at", time.Now().Add(time.Hour))
+	// Grace period over
+	database.DB.Model(user).Update("deletion_scheduled_at", time.Now().Add(-time.Hour))
+
+	purged, err := PurgeDeletedAccounts()
+	if err != nil {
+		t.Fatalf("PurgeDeletedAccounts failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 purged account, got %d", purged)
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Error("User should be deleted")
+	}
+
+	database.DB.Unscoped().Model(&models.Course{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Error("User's courses should be cascaded")
+	}
+
+	database.DB.Model(&models.FocusSession{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Error("User's sessions should be cascaded")
+	}
+
+	var schoolAfter models.School
+	database.DB.First(&schoolAfter, school.ID)
+	if schoolAfter.StudentCount != 1 {
+		t.Errorf("Expected student count 1, got %d", schoolAfter.StudentCount)
+	}
+	if schoolAfter.TotalPoints != 100 {
+		t.Errorf("Expected school points 100, got %d", schoolAfter.TotalPoints)
+	}
+}
+
+func TestPurgeSkipsCancelledDeletion(t *testing.T) {
+	_, _, user, _, cleanup := setupAccountTests(t)
+	defer cleanup()
+
+	// Listed as due, then cancelled before the purge reaches it
+	listedAt := time.Now()
+	database.DB.Model(user).Update("deletion_scheduled_at", listedAt.Add(-time.Hour))
+	database.DB.Model(user).Update("deletion_scheduled_at", nil)
+
+	deleted, err := purgeAccount(user.ID, listedAt)
+	if err != nil {
+		t.Fatalf("purgeAccount failed: %v", err)
+	}
+	if deleted {
+		t.Error("Expected a cancelled deletion to be skipped")
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Error("User should still exist after cancelling the deletion")
+	}
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/stats"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AchievementTrigger is an event after which achievements are evaluated
+type AchievementTrigger string
+
+const (
+	TriggerSessionCreated AchievementTrigger = "session_created"
+	TriggerPlanCompleted  AchievementTrigger = "plan_completed"
+	TriggerTodoCompleted  AchievementTrigger = "todo_completed"
+)
+
+// AchievementMetric is the quantity an achievement rule measures
+type AchievementMetric string
+
+const (
+	// MetricSessions counts focus sessions
+	MetricSessions AchievementMetric = "sessions"
+	// MetricFocusMinutes sums the minutes of focus sessions
+	MetricFocusMinutes AchievementMetric = "focus_minutes"
+	// MetricStreakDays is the longest run of consecutive days with a session
+	MetricStreakDays AchievementMetric = "streak_days"
+	// MetricPlansCompleted counts completed study plans
+	MetricPlansCompleted AchievementMetric = "plans_completed"
+	// MetricTodosCompleted counts completed todos
+	MetricTodosCompleted AchievementMetric = "todos_completed"
+)
+
+// trigger returns the event that can change the metric
+func (m AchievementMetric) trigger() AchievementTrigger {
+	switch m {
+	case MetricPlansCompleted:
+		return TriggerPlanCompleted
+	case MetricTodosCompleted:
+		return TriggerTodoCompleted
+	default:
+		return TriggerSessionCreated
+	}
+}
+
+// AchievementRule declares an achievement: it is earned once Metric reaches
+// Threshold, counting only the activity the filters select
+type AchievementRule struct {
+	Code        string            `json:"code"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Metric      AchievementMetric `json:"metric"`
+	Threshold   int               `json:"threshold"`
+
+	// MinSessionMinutes only counts sessions at least this long
+	MinSessionMinutes int `json:"-"`
+	// CourseKeywords only counts sessions of courses whose name contains one
+	// of the keywords, ignoring case
+	CourseKeywords []string `json:"-"`
+	// WindowDays only counts activity in the last WindowDays days
+	WindowDays int `json:"-"`
+}
+
+// achievementRules are all achievements that can be earned. Codes are stored
+// with awarded achievements and must never change.
+var achievementRules = []AchievementRule{
+	{
+		Code:              "first_focus",
+		Name:              "初次專注",
+		Description:       "完成第一次 25 分鐘以上的專注",
+		Metric:            MetricSessions,
+		Threshold:         1,
+		MinSessionMinutes: 25,
+	},
+	{
+		Code:        "sessions_100",
+		Name:        "百次專注",
+		Description: "累積完成 100 次專注",
+		Metric:      MetricSessions,
+		Threshold:   100,
+	},
+	{
+		Code:        "streak_7",
+		Name:        "連續七天",
+		Description: "連續 7 天都有專注紀錄",
+		Metric:      MetricStreakDays,
+		Threshold:   7,
+	},
+	{
+		Code:        "streak_30",
+		Name:        "連續三十天",
+		Description: "連續 30 天都有專注紀錄",
+		Metric:      MetricStreakDays,
+		Threshold:   30,
+	},
+	{
+		Code:        "focus_100_hours",
+		Name:        "百小時專注",
+		Description: "累積專注 100 小時",
+		Metric:      MetricFocusMinutes,
+		Threshold:   100 * 60,
+	},
+	{
+		Code:           "calculus_100_hours",
+		Name:           "微積分達人",
+		Description:    "在微積分課程累積專注 100 小時",
+		Metric:         MetricFocusMinutes,
+		Threshold:      100 * 60,
+		CourseKeywords: []string{"微積分", "calculus"},
+	},
+	{
+		Code:        "plans_10_week",
+		Name:        "計畫執行者",
+		Description: "7 天內完成 10 個學習計畫",
+		Metric:      MetricPlansCompleted,
+		Threshold:   10,
+		WindowDays:  7,
+	},
+	{
+		Code:        "todos_50",
+		Name:        "待辦終結者",
+		Description: "累積完成 50 個待辦事項",
+		Metric:      MetricTodosCompleted,
+		Threshold:   50,
+	},
+}
+
+// AchievementResponse is an achievement with the user's progress towards it
+type AchievementResponse struct {
+	AchievementRule
+	Progress  int        `json:"progress"`
+	Earned    bool       `json:"earned"`
+	AwardedAt *time.Time `json:"awarded_at"`
+}
+
+// achievementProgress measures the rule's metric for the user
+func achievementProgress(db *gorm.DB, userID uuid.UUID, rule AchievementRule) (int, error) {
+	var since time.Time
+	if rule.WindowDays > 0 {
+		since = time.Now().AddDate(0, 0, -rule.WindowDays)
+	}
+
+	switch rule.Metric {
+	case MetricSessions, MetricFocusMinutes:
+		query := db.Table("focus_sessions").Where("focus_sessions.user_id = ?", userID)
+		if rule.MinSessionMinutes > 0 {
+			query = query.Where("focus_sessions.minutes >= ?", rule.MinSessionMinutes)
+		}
+		if !since.IsZero() {
+			query = query.Where("focus_sessions.date > ?", since.Format("2006-01-02"))
+		}
+		if len(rule.CourseKeywords) > 0 {
+			// Trashed courses still count towards achievements
+			conditions := make([]string, len(rule.CourseKeywords))
+			args := make([]interface{}, len(rule.CourseKeywords))
+			for i, keyword := range rule.CourseKeywords {
+				conditions[i] = "LOWER(courses.name) LIKE ?"
+				args[i] = "%" + strings.ToLower(keyword) + "%"
+			}
+			query = query.Joins("JOIN courses ON courses.id = focus_sessions.course_id").
+				Where(strings.Join(conditions, " OR "), args...)
+		}
+
+		if rule.Metric == MetricSessions {
+			var count int64
+			err := query.Count(&count).Error
+			return int(count), err
+		}
+		var minutes int
+		err := query.Select("COALESCE(SUM(focus_sessions.minutes), 0)").Scan(&minutes).Error
+		return minutes, err
+
+	case MetricStreakDays:
+		_, longest, err := stats.NewRepository(db).Streaks(userID, localDate(time.Now()))
+		return longest, err
+
+	case MetricPlansCompleted, MetricTodosCompleted:
+		query := db.Model(&models.StudyPlan{})
+		if rule.Metric == MetricTodosCompleted {
+			query = db.Model(&models.Todo{})
+		}
+		query = query.Where("user_id = ? AND completed = ?", userID, true)
+		if !since.IsZero() {
+			query = query.Where("completed_at > ?", since)
+		}
+
+		var count int64
+		err := query.Count(&count).Error
+		return int(count), err
+	}
+
+	return 0, nil
+}
+
+// evaluateAchievements awards every achievement the user has newly earned
+// through one of the given events and returns them
+func evaluateAchievements(db *gorm.DB, userID uuid.UUID, triggers ...AchievementTrigger) ([]AchievementRule, error) {
+	var earned []string
+	if err := db.Model(&models.UserAchievement{}).Where("user_id = ?", userID).Pluck("code", &earned).Error; err != nil {
+		return nil, err
+	}
+	earnedCodes := make(map[string]bool, len(earned))
+	for _, code := range earned {
+		earnedCodes[code] = true
+	}
+
+	var awarded []AchievementRule
+	for _, rule := range achievementRules {
+		if earnedCodes[rule.Code] || !triggeredBy(rule, triggers) {
+			continue
+		}
+
+		progress, err := achievementProgress(db, userID, rule)
+		if err != nil {
+			return awarded, err
+		}
+		if progress < rule.Threshold {
+			continue
+		}
+
+		// Concurrent evaluations may race; the unique index awards once
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserAchievement{
+			UserID:    userID,
+			Code:      rule.Code,
+			AwardedAt: time.Now(),
+		})
+		if result.Error != nil {
+			return awarded, result.Error
+		}
+		if result.RowsAffected > 0 {
+			awarded = append(awarded, rule)
+		}
+	}
+
+	return awarded, nil
+}
+
+func triggeredBy(rule AchievementRule, triggers []AchievementTrigger) bool {
+	for _, trigger := range triggers {
+		if rule.Metric.trigger() == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// awardAchievements evaluates achievements for a committed domain event.
+// It runs as an outbox subscriber, which retries it when it fails.
+func awardAchievements(tx *gorm.DB, userID uuid.UUID, triggers ...AchievementTrigger) error {
+	awarded, err := evaluateAchievements(tx, userID, triggers...)
+	for _, rule := range awarded {
+		log.Printf("User %s earned achievement %s", userID, rule.Code)
+	}
+	return err
+}
+
+// GetMyAchievements lists all achievements with the user's progress and
+// when each was earned
+func GetMyAchievements(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var awarded []models.UserAchievement
+	if err := database.DB.Where("user_id = ?", userID).Find(&awarded).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢成就失敗")
+		return
+	}
+	awardedAt := make(map[string]time.Time, len(awarded))
+	for _, a := range awarded {
+		awardedAt[a.Code] = a.AwardedAt
+	}
+
+	achievements := make([]AchievementResponse, 0, len(achievementRules))
+	earnedCount := 0
+	for _, rule := range achievementRules {
+		achievement := AchievementResponse{AchievementRule: rule}
+
+		if at, ok := awardedAt[rule.Code]; ok {
+			achievement.Earned = true
+			achievement.AwardedAt = &at
+			achievement.Progress = rule.Threshold
+			earnedCount++
+		} else {
+			progress, err := achievementProgress(database.DB, userID, rule)
+			if err != nil {
+				utils.InternalErrorResponse(c, "查詢成就失敗")
+				return
+			}
+			if progress > rule.Threshold {
+				progress = rule.Threshold
+			}
+			achievement.Progress = progress
+		}
+
+		achievements = append(achievements, achievement)
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"achievements": achievements,
+		"earned_count": earnedCount,
+	}, "")
+}
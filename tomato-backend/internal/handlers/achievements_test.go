@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupAchievementTests(t *testing.T) (*gin.Engine, *models.User, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
+	router.PATCH("/plans/:id/complete", middleware.AuthMiddleware(), TogglePlanComplete)
+	router.GET("/users/me/achievements", middleware.AuthMiddleware(), GetMyAchievements)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, token, cleanup
+}
+
+// seedSession stores a focus session daysAgo days in the past
+func seedSession(t *testing.T, userID uuid.UUID, courseID *uuid.UUID, daysAgo, minutes int) {
+	date, _ := time.Parse("2006-01-02", time.Now().AddDate(0, 0, -daysAgo).Format("2006-01-02"))
+	if err := database.DB.Create(&models.FocusSession{
+		UserID:   userID,
+		CourseID: courseID,
+		Date:     date,
+		Minutes:  minutes,
+	}).Error; err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+}
+
+func earnedAchievements(t *testing.T, userID uuid.UUID) map[string]bool {
+	var codes []string
+	database.DB.Model(&models.UserAchievement{}).Where("user_id = ?", userID).Pluck("code", &codes)
+
+	earned := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		earned[code] = true
+	}
+	return earned
+}
+
+func TestAchievementRulesAreValid(t *testing.T) {
+	codes := map[string]bool{}
+	for _, rule := range achievementRules {
+		if rule.Code == "" || len(rule.Code) > 50 {
+			t.Errorf("Invalid code %q", rule.Code)
+		}
+		if codes[rule.Code] {
+			t.Errorf("Duplicate code %q", rule.Code)
+		}
+		codes[rule.Code] = true
+
+		if rule.Name == "" || rule.Description == "" || rule.Threshold <= 0 {
+			t.Errorf("Rule %q needs a name, description and positive threshold", rule.Code)
+		}
+	}
+}
+
+func TestFirstFocusAchievement(t *testing.T) {
+	router, user, token, cleanup := setupAchievementTests(t)
+	defer cleanup()
+
+	today := time.Now().Format("2006-01-02")
+
+	// Too short to count
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{"date": today, "minutes": 15})
+	testutil.AssertStatusCode(t, w, 201)
+	deliverDomainEvents(t)
+	if earnedAchievements(t, user.ID)["first_focus"] {
+		t.Fatal("Expected no achievement for a 15-minute session")
+	}
+
+	for i := 0; i < 2; i++ {
+		w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{"date": today, "minutes": 25})
+		testutil.AssertStatusCode(t, w, 201)
+	}
+	deliverDomainEvents(t)
+
+	var count int64
+	database.DB.Model(&models.UserAchievement{}).Where("user_id = ? AND code = ?", user.ID, "first_focus").Count(&count)
+	if count != 1 {
+		t.Fatalf("Expected first_focus to be awarded once, got %d", count)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me/achievements", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	data := response.Data.(map[string]interface{})
+	if data["earned_count"] != float64(1) {
+		t.Errorf("Expected 1 earned achievement, got %v", data["earned_count"])
+	}
+
+	achievements := data["achievements"].([]interface{})
+	if len(achievements) != len(achievementRules) {
+		t.Fatalf("Expected all %d achievements listed, got %d", len(achievementRules), len(achievements))
+	}
+	for _, a := range achievements {
+		achievement := a.(map[string]interface{})
+		switch achievement["code"] {
+		case "first_focus":
+			if achievement["earned"] != true || achievement["awarded_at"] == nil {
+				t.Errorf("Expected first_focus to be earned with a timestamp, got %v", achievement)
+			}
+		case "sessions_100":
+			if achievement["earned"] != false || achievement["progress"] != float64(3) {
+				t.Errorf("Expected sessions_100 in progress at 3, got %v", achievement)
+			}
+		}
+	}
+}
+
+func TestAchievementProgress(t *testing.T) {
+	_, user, _, cleanup := setupAchievementTests(t)
+	defer cleanup()
+
+	calculus := testutil.CreateTestCourse(database.DB, user.ID, "微積分(一)", "#3b82f6")
+	physics := testutil.CreateTestCourse(database.DB, user.ID, "普通物理", "#ef4444")
+
+	// Two streaks: 3 days long ending 10 days ago, 7 days long ending yesterday
+	for _, daysAgo := range []int{10, 11, 12, 1, 2, 3, 4, 5, 6, 7} {
+		seedSession(t, user.ID, &calculus.ID, daysAgo, 600)
+	}
+	seedSession(t, user.ID, &physics.ID, 1, 600)
+
+	// Plans completed inside and outside the last week
+	for i := 0; i < 12; i++ {
+		completedAt := time.Now().Add(-time.Hour)
+		if i >= 9 {
+			completedAt = time.Now().AddDate(0, 0, -8)
+		}
+		plan := testutil.CreateTestStudyPlan(database.DB, user.ID, nil, "計畫", 0)
+		database.DB.Model(plan).Updates(map[string]interface{}{"completed": true, "completed_at": completedAt})
+	}
+
+	tests := []struct {
+		code     string
+		expected int
+	}{
+		{code: "first_focus", expected: 11},
+		{code: "streak_7", expected: 7},
+		{code: "focus_100_hours", expected: 6600},
+		{code: "calculus_100_hours", expected: 6000},
+		{code: "plans_10_week", expected: 9},
+		{code: "todos_50", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			for _, rule := range achievementRules {
+				if rule.Code != tt.code {
+					continue
+				}
+				progress, err := achievementProgress(database.DB, user.ID, rule)
+				if err != nil {
+					t.Fatalf("achievementProgress failed: %v", err)
+				}
+				if progress != tt.expected {
+					t.Errorf("Expected progress %d, got %d", tt.expected, progress)
+				}
+				return
+			}
+			t.Fatalf("No rule %q", tt.code)
+		})
+	}
+
+	awarded, err := evaluateAchievements(database.DB, user.ID, TriggerSessionCreated, TriggerPlanCompleted)
+	if err != nil {
+		t.Fatalf("evaluateAchievements failed: %v", err)
+	}
+	if len(awarded) != 4 {
+		t.Errorf("Expected 4 achievements awarded, got %d", len(awarded))
+	}
+
+	earned := earnedAchievements(t, user.ID)
+	for _, code := range []string{"first_focus", "streak_7", "focus_100_hours", "calculus_100_hours"} {
+		if !earned[code] {
+			t.Errorf("Expected %s to be earned", code)
+		}
+	}
+	if earned["plans_10_week"] {
+		t.Error("Expected plans_10_week not to be earned with 9 plans in the last week")
+	}
+}
+
+func TestPlanCompletionAwardsAchievement(t *testing.T) {
+	router, user, token, cleanup := setupAchievementTests(t)
+	defer cleanup()
+
+	var plans []*models.StudyPlan
+	for i := 0; i < 10; i++ {
+		plans = append(plans, testutil.CreateTestStudyPlan(database.DB, user.ID, nil, "計畫", 0))
+	}
+
+	for i, plan := range plans {
+		w := testutil.MakeAuthenticatedRequest(t, router, "PATCH", "/plans/"+plan.ID.String()+"/complete", token, map[string]interface{}{"completed": true})
+		testutil.AssertStatusCode(t, w, 200)
+		deliverDomainEvents(t)
+
+		if earned := earnedAchievements(t, user.ID)["plans_10_week"]; earned != (i == len(plans)-1) {
+			t.Fatalf("After %d plans expected earned=%v", i+1, !earned)
+		}
+	}
+
+	var plan models.StudyPlan
+	database.DB.First(&plan, plans[0].ID)
+	if plan.CompletedAt == nil {
+		t.Error("Expected completion time to be recorded")
+	}
+}
@@ -0,0 +1,793 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Audit log actions
+const (
+	AuditActionAdjustPoints  = "adjust_points"
+	AuditActionReversePoints = "reverse_points"
+	AuditActionChangeRole    = "change_role"
+	AuditActionBanUser       = "ban_leaderboard"
+	AuditActionUnbanUser     = "unban_leaderboard"
+	AuditActionUpdateSchool  = "update_school"
+	AuditActionAddAlias      = "add_school_alias"
+	AuditActionAddDomain     = "add_school_domain"
+	AuditActionMergeSchools  = "merge_schools"
+	AuditActionCreateSeason  = "create_season"
+)
+
+// ErrLeaderboardBanUnchanged is returned when a user already has the requested
+// leaderboard ban status
+var ErrLeaderboardBanUnchanged = errors.New("leaderboard ban unchanged")
+
+// Audit log target types
+const (
+	auditTargetUser   = "user"
+	auditTargetSchool = "school"
+	auditTargetSeason = "season"
+)
+
+type AdjustPointsRequest struct {
+	Delta  int    `json:"delta" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ReversePointsRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ChangeRoleRequest struct {
+	Role   models.UserRole `json:"role" binding:"required"`
+	Reason string          `json:"reason"`
+}
+
+type BanUserRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type UpdateSchoolRequest struct {
+	Name    string `json:"name"`
+	LogoURL string `json:"logo_url"`
+}
+
+type AddSchoolAliasRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type AddSchoolDomainRequest struct {
+	Domain string `json:"domain" binding:"required"`
+}
+
+type MergeSchoolsRequest struct {
+	SourceID uuid.UUID `json:"source_id" binding:"required"`
+	TargetID uuid.UUID `json:"target_id" binding:"required"`
+}
+
+// currentAdmin loads the acting user. The role is re-read from the database
+// so that a demotion takes effect before the access token expires.
+func currentAdmin(c *gin.Context) (*models.User, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return nil, false
+	}
+
+	var actor models.User
+	if err := database.DB.First(&actor, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.UnauthorizedResponse(c, "")
+			return nil, false
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return nil, false
+	}
+
+	if actor.Role != models.RoleAdmin && actor.Role != models.RoleSchoolAdmin {
+		utils.ForbiddenResponse(c, "")
+		return nil, false
+	}
+	return &actor, true
+}
+
+// canManageSchool reports whether actor may manage the given school. Admins
+// manage every school, school admins only their own.
+func canManageSchool(actor *models.User, schoolID *uuid.UUID) bool {
+	if actor.Role == models.RoleAdmin {
+		return true
+	}
+	return schoolID != nil && actor.SchoolID != nil && *actor.SchoolID == *schoolID
+}
+
+// writeAuditLog appends an entry to the admin audit log
+func writeAuditLog(tx *gorm.DB, actor *models.User, action, targetType string, targetID uuid.UUID, reason string, details interface{}) (*models.AdminAuditLog, error) {
+	entry := models.AdminAuditLog{
+		ActorID:    &actor.ID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reason,
+	}
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return nil, err
+		}
+		entry.Details = raw
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// loadManagedUser fetches the target user of an admin request and checks
+// that actor may manage them
+func loadManagedUser(c *gin.Context, actor *models.User) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的用戶 ID")
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.Preload("School").First(&user, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return nil, false
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return nil, false
+	}
+
+	// School admins can't act on platform admins, even from their own school
+	if !canManageSchool(actor, user.SchoolID) || (actor.Role != models.RoleAdmin && user.Role == models.RoleAdmin) {
+		utils.ForbiddenResponse(c, "")
+		return nil, false
+	}
+	return &user, true
+}
+
+// AdminListUsers searches users by name or email. School admins only see
+// students of their own school.
+func AdminListUsers(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	// Pagination
+	limit := 50
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := utils.ParseInt(o); err == nil && val >= 0 {
+			offset = val
+		}
+	}
+
+	query := database.DB.Model(&models.User{})
+
+	if actor.Role == models.RoleSchoolAdmin {
+		query = query.Where("school_id = ?", actor.SchoolID)
+	} else if schoolID := c.Query("school_id"); schoolID != "" {
+		id, err := uuid.Parse(schoolID)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "無效的學校 ID")
+			return
+		}
+		query = query.Where("school_id = ?", id)
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+	}
+
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	if c.Query("banned") == "true" {
+		query = query.Where("leaderboard_banned = ?", true)
+	}
+
+	// Get total count
+	var total int64
+	query.Count(&total)
+
+	var users []models.User
+	if err := query.Preload("School").
+		Order("created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&users).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}, "")
+}
+
+// AdminGetUser retrieves a single user with their recent audit history
+func AdminGetUser(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	user, ok := loadManagedUser(c, actor)
+	if !ok {
+		return
+	}
+
+	var logs []models.AdminAuditLog
+	if err := database.DB.Where("target_type = ? AND target_id = ?", auditTargetUser, user.ID).
+		Order("created_at DESC").
+		Limit(20).
+		Find(&logs).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢稽核紀錄失敗")
+		return
+	}
+
+	var transactions []models.PointTransaction
+	if err := database.DB.Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(20).
+		Find(&transactions).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢積分紀錄失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"user":               user,
+		"audit_logs":         logs,
+		"point_transactions": transactions,
+	}, "")
+}
+
+// AdminAdjustPoints adds or removes points from a user. The user's school
+// total moves by the same amount and the change is recorded with its reason.
+// Only admins may do this.
+func AdminAdjustPoints(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	var req AdjustPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	target, ok := loadManagedUser(c, actor)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, target.ID).Error; err != nil {
+			return err
+		}
+
+		before := user.TotalPoints
+		entry, err := writeAuditLog(tx, actor, AuditActionAdjustPoints, auditTargetUser, user.ID, req.Reason, gin.H{
+			"delta":  req.Delta,
+			"before": before,
+			"after":  before + req.Delta,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The ledger entry references the audit log entry explaining it
+		_, err = recordPoints(tx, user.ID, req.Delta, models.PointSourceAdminAdjustment, &entry.ID, req.Reason)
+		return err
+	})
+	if err != nil {
+		if err == ErrNegativePoints {
+			utils.ValidationErrorResponse(c, "調整後積分不可小於 0")
+			return
+		}
+		utils.InternalErrorResponse(c, "積分調整失敗")
+		return
+	}
+
+	database.DB.Preload("School").First(&user, user.ID)
+	publishPointsChanged(user.ID, user.TotalPoints, req.Delta)
+
+	utils.SuccessResponse(c, 200, user, "積分已調整")
+}
+
+// AdminReversePoints cancels out a point transaction, e.g. points earned from
+// a fraudulent session. Only admins may do this.
+func AdminReversePoints(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的積分紀錄 ID")
+		return
+	}
+
+	var req ReversePointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var reversal *models.PointTransaction
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		reversal, err = reversePoints(tx, transactionID, req.Reason)
+		if err != nil {
+			return err
+		}
+
+		_, err = writeAuditLog(tx, actor, AuditActionReversePoints, auditTargetUser, reversal.UserID, req.Reason, gin.H{
+			"transaction_id": transactionID,
+			"reversal_id":    reversal.ID,
+			"delta":          reversal.Delta,
+		})
+		return err
+	})
+	if err != nil {
+		switch err {
+		case gorm.ErrRecordNotFound:
+			utils.NotFoundResponse(c, "積分紀錄不存在")
+		case ErrAlreadyReversed:
+			utils.ConflictResponse(c, "此積分紀錄已被沖銷")
+		case ErrReverseOfReversal:
+			utils.ValidationErrorResponse(c, "無法沖銷沖銷紀錄")
+		case ErrNegativePoints:
+			utils.ValidationErrorResponse(c, "沖銷後積分不可小於 0")
+		default:
+			utils.InternalErrorResponse(c, "積分沖銷失敗")
+		}
+		return
+	}
+
+	var totalPoints int
+	if database.DB.Model(&models.User{}).Where("id = ?", reversal.UserID).Select("total_points").Scan(&totalPoints).Error == nil {
+		publishPointsChanged(reversal.UserID, totalPoints, reversal.Delta)
+	}
+
+	utils.SuccessResponse(c, 201, reversal, "積分已沖銷")
+}
+
+// AdminChangeRole changes a user's role. Only admins may do this.
+func AdminChangeRole(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	var req ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	if !req.Role.IsValid() {
+		utils.ValidationErrorResponse(c, "無效的角色")
+		return
+	}
+
+	user, ok := loadManagedUser(c, actor)
+	if !ok {
+		return
+	}
+	if user.ID == actor.ID {
+		utils.ForbiddenResponse(c, "無法變更自己的角色")
+		return
+	}
+
+	// Tokens carry the role, so the user signs in again to pick up the new one
+	before := user.Role
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"role":          req.Role,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		_, err := writeAuditLog(tx, actor, AuditActionChangeRole, auditTargetUser, user.ID, req.Reason, gin.H{
+			"before": before,
+			"after":  req.Role,
+		})
+		return err
+	})
+	if err != nil {
+		utils.InternalErrorResponse(c, "角色更新失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, user, "角色已更新")
+}
+
+// AdminBanUser hides a user from leaderboards
+func AdminBanUser(c *gin.Context) {
+	setLeaderboardBan(c, true)
+}
+
+// AdminUnbanUser lifts a leaderboard ban
+func AdminUnbanUser(c *gin.Context) {
+	setLeaderboardBan(c, false)
+}
+
+func setLeaderboardBan(c *gin.Context, banned bool) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req BanUserRequest
+	if banned {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ValidationErrorResponse(c, err.Error())
+			return
+		}
+	} else {
+		// Reason is optional when lifting a ban
+		_ = c.ShouldBindJSON(&req)
+	}
+
+	user, ok := loadManagedUser(c, actor)
+	if !ok {
+		return
+	}
+	action := AuditActionBanUser
+	message := "已禁止用戶上榜"
+	if !banned {
+		action = AuditActionUnbanUser
+		message = "已解除上榜禁令"
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so total_points can't change while the school total
+		// is adjusted
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, user.ID).Error; err != nil {
+			return err
+		}
+		if user.LeaderboardBanned == banned {
+			return ErrLeaderboardBanUnchanged
+		}
+
+		// Banned users' points are left out of their school's total
+		if user.IsEmailVerified() {
+			points := user.TotalPoints
+			if banned {
+				points = -points
+			}
+			if err := adjustSchoolMembership(tx, user.SchoolID, 0, points); err != nil {
+				return err
+			}
+		}
+
+		user.LeaderboardBanned = banned
+		if err := tx.Model(user).Update("leaderboard_banned", banned).Error; err != nil {
+			return err
+		}
+		_, err := writeAuditLog(tx, actor, action, auditTargetUser, user.ID, req.Reason, nil)
+		return err
+	})
+	if err == ErrLeaderboardBanUnchanged {
+		if banned {
+			utils.ConflictResponse(c, "用戶已被禁止上榜")
+		} else {
+			utils.ConflictResponse(c, "用戶未被禁止上榜")
+		}
+		return
+	}
+	if err != nil {
+		utils.InternalErrorResponse(c, "更新失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, user, message)
+}
+
+// loadManagedSchool fetches the target school of an admin request and checks
+// that actor may manage it
+func loadManagedSchool(c *gin.Context, actor *models.User) (*models.School, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的學校 ID")
+		return nil, false
+	}
+
+	if !canManageSchool(actor, &id) {
+		utils.ForbiddenResponse(c, "")
+		return nil, false
+	}
+
+	var school models.School
+	if err := database.DB.First(&school, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "學校不存在")
+			return nil, false
+		}
+		utils.InternalErrorResponse(c, "查詢學校失敗")
+		return nil, false
+	}
+	return &school, true
+}
+
+// AdminUpdateSchool updates a school's name or logo
+func AdminUpdateSchool(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateSchoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	school, ok := loadManagedSchool(c, actor)
+	if !ok {
+		return
+	}
+
+	before := gin.H{"name": school.Name, "logo_url": school.LogoURL}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if name := strings.Join(strings.Fields(req.Name), " "); name != "" && name != school.Name {
+			// The new name must not resolve to another school
+			if existing, err := FindSchool(tx, name); err == nil && existing.ID != school.ID {
+				return ErrSchoolNameTaken
+			} else if err != nil && err != gorm.ErrRecordNotFound {
+				return err
+			}
+			school.Name = name
+		}
+		if req.LogoURL != "" {
+			school.LogoURL = req.LogoURL
+		}
+
+		if err := tx.Model(school).Select("name", "logo_url").Updates(school).Error; err != nil {
+			return err
+		}
+		_, err := writeAuditLog(tx, actor, AuditActionUpdateSchool, auditTargetSchool, school.ID, "", gin.H{
+			"before": before,
+			"after":  gin.H{"name": school.Name, "logo_url": school.LogoURL},
+		})
+		return err
+	})
+	if err != nil {
+		if err == ErrSchoolNameTaken {
+			utils.ConflictResponse(c, "學校名稱已被使用")
+			return
+		}
+		utils.InternalErrorResponse(c, "學校更新失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, school, "更新成功")
+}
+
+// AdminAddSchoolAlias registers an alternative name for a school
+func AdminAddSchoolAlias(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req AddSchoolAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	school, ok := loadManagedSchool(c, actor)
+	if !ok {
+		return
+	}
+
+	var alias *models.SchoolAlias
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if alias, err = AddSchoolAlias(tx, school.ID, req.Name); err != nil {
+			return err
+		}
+		_, err = writeAuditLog(tx, actor, AuditActionAddAlias, auditTargetSchool, school.ID, "", gin.H{"alias": alias.Name})
+		return err
+	})
+	if err != nil {
+		if err == ErrSchoolNameTaken {
+			utils.ConflictResponse(c, "學校名稱已被使用")
+			return
+		}
+		utils.InternalErrorResponse(c, "新增別名失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, alias, "別名已新增")
+}
+
+// AdminAddSchoolDomain registers an email domain for a school so that SSO
+// users with a matching email join it automatically. Only admins may do this
+// since a domain decides school membership.
+func AdminAddSchoolDomain(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	var req AddSchoolDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	school, ok := loadManagedSchool(c, actor)
+	if !ok {
+		return
+	}
+
+	var domain *models.SchoolDomain
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if domain, err = AddSchoolDomain(tx, school.ID, req.Domain); err != nil {
+			return err
+		}
+		_, err = writeAuditLog(tx, actor, AuditActionAddDomain, auditTargetSchool, school.ID, "", gin.H{"domain": domain.Domain})
+		return err
+	})
+	if err != nil {
+		switch err {
+		case ErrInvalidDomain:
+			utils.ValidationErrorResponse(c, "Email 網域格式錯誤")
+		case ErrDomainTaken:
+			utils.ConflictResponse(c, "此網域已屬於其他學校")
+		default:
+			utils.InternalErrorResponse(c, "新增網域失敗")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, 201, domain, "網域已新增")
+}
+
+// AdminMergeSchools merges a duplicate school into another. Only admins may
+// do this since it spans schools.
+func AdminMergeSchools(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	var req MergeSchoolsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var school *models.School
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if school, err = MergeSchools(tx, req.SourceID, req.TargetID); err != nil {
+			return err
+		}
+		_, err = writeAuditLog(tx, actor, AuditActionMergeSchools, auditTargetSchool, school.ID, "", gin.H{"source_id": req.SourceID})
+		return err
+	})
+	if err != nil {
+		switch err {
+		case ErrSameSchool:
+			utils.ValidationErrorResponse(c, "無法將學校合併至自己")
+		case gorm.ErrRecordNotFound:
+			utils.NotFoundResponse(c, "學校不存在")
+		default:
+			utils.InternalErrorResponse(c, "學校合併失敗")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, 200, school, "學校已合併")
+}
+
+// AdminGetAuditLogs lists audit log entries, newest first
+func AdminGetAuditLogs(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := utils.ParseInt(o); err == nil && val >= 0 {
+			offset = val
+		}
+	}
+
+	query := database.DB.Model(&models.AdminAuditLog{})
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		id, err := uuid.Parse(targetID)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "無效的目標 ID")
+			return
+		}
+		query = query.Where("target_id = ?", id)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.AdminAuditLog
+	if err := query.Order("created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&logs).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢稽核紀錄失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"logs":   logs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}, "")
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+type adminFixture struct {
+	school      *models.School
+	otherSchool *models.School
+	student     *models.User
+	outsider    *models.User
+	adminToken  string
+	staffToken  string
+	userToken   string
+}
+
+func setupAdminTests(t *testing.T) (*gin.Engine, *adminFixture, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	admin := router.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleSchoolAdmin, models.RoleAdmin))
+	admin.GET("/users", AdminListUsers)
+	admin.GET("/users/:id", AdminGetUser)
+	admin.POST("/users/:id/points", AdminAdjustPoints)
+	admin.PUT("/users/:id/role", AdminChangeRole)
+	admin.POST("/users/:id/ban", AdminBanUser)
+	admin.DELETE("/users/:id/ban", AdminUnbanUser)
+	admin.PUT("/schools/:id", AdminUpdateSchool)
+	admin.POST("/schools/merge", AdminMergeSchools)
+	admin.POST("/schools/:id/domains", AdminAddSchoolDomain)
+
+	// Create test data
+	f := &adminFixture{}
+	f.school = testutil.CreateTestSchool(db, "測試大學")
+	f.otherSchool = testutil.CreateTestSchool(db, "其他大學")
+	f.student = testutil.CreateTestUser(db, "student@example.com", "password123", "學生", &f.school.ID)
+	f.outsider = testutil.CreateTestUser(db, "outsider@example.com", "password123", "外校學生", &f.otherSchool.ID)
+
+	adminUser := testutil.CreateTestUser(db, "admin@example.com", "password123", "管理員", nil)
+	db.Model(adminUser).Update("role", models.RoleAdmin)
+	staff := testutil.CreateTestUser(db, "staff@example.com", "password123", "校方管理員", &f.school.ID)
+	db.Model(staff).Update("role", models.RoleSchoolAdmin)
+
+	f.adminToken, _, _ = utils.GenerateSessionTokens(adminUser, uuid.Nil)
+	f.staffToken, _, _ = utils.GenerateSessionTokens(staff, uuid.Nil)
+	f.userToken, _, _ = utils.GenerateSessionTokens(f.student, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, f, cleanup
+}
+
+func TestAdminAccessControl(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		requestBody    interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "學生無法存取",
+			method:         "GET",
+			path:           "/admin/users",
+			token:          f.userToken,
+			expectedStatus: 403,
+		},
+		{
+			name:           "校方管理員查看本校學生",
+			method:         "GET",
+			path:           fmt.Sprintf("/admin/users/%s", f.student.ID),
+			token:          f.staffToken,
+			expectedStatus: 200,
+		},
+		{
+			name:           "校方管理員無法查看外校學生",
+			method:         "GET",
+			path:           fmt.Sprintf("/admin/users/%s", f.outsider.ID),
+			token:          f.staffToken,
+			expectedStatus: 403,
+		},
+		{
+			name:           "校方管理員無法調整積分",
+			method:         "POST",
+			path:           fmt.Sprintf("/admin/users/%s/points", f.student.ID),
+			token:          f.staffToken,
+			requestBody:    map[string]interface{}{"delta": 100, "reason": "活動獎勵"},
+			expectedStatus: 403,
+		},
+		{
+			name:           "校方管理員無法管理外校",
+			method:         "PUT",
+			path:           fmt.Sprintf("/admin/schools/%s", f.otherSchool.ID),
+			token:          f.staffToken,
+			requestBody:    map[string]interface{}{"logo_url": "https://example.com/logo.png"},
+			expectedStatus: 403,
+		},
+		{
+			name:           "校方管理員無法合併學校",
+			method:         "POST",
+			path:           "/admin/schools/merge",
+			token:          f.staffToken,
+			requestBody:    map[string]interface{}{"source_id": f.otherSchool.ID, "target_id": f.school.ID},
+			expectedStatus: 403,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, tt.method, tt.path, tt.token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedStatus == 403 {
+				testutil.AssertError(t, w, "FORBIDDEN")
+			}
+		})
+	}
+}
+
+func TestAdminListUsersScopedToSchool(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/admin/users?q=outsider", f.adminToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	if total := response.Data.(map[string]interface{})["total"]; total != float64(1) {
+		t.Errorf("Expected admin to find 1 user, got %v", total)
+	}
+
+	// School admins never see students of other schools
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/admin/users?q=outsider", f.staffToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.ParseResponse(t, w, &response)
+	if total := response.Data.(map[string]interface{})["total"]; total != float64(0) {
+		t.Errorf("Expected school admin to find 0 users, got %v", total)
+	}
+}
+
+func TestAdminAdjustPoints(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	database.DB.Model(f.student).Update("total_points", 100)
+	database.DB.Model(f.school).UpdateColumn("total_points", 100)
+
+	path := fmt.Sprintf("/admin/users/%s/points", f.student.ID)
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		expectedStatus int
+		expectedPoints int
+	}{
+		{
+			name:           "缺少原因",
+			requestBody:    map[string]interface{}{"delta": 50},
+			expectedStatus: 400,
+			expectedPoints: 100,
+		},
+		{
+			name:           "增加積分",
+			requestBody:    map[string]interface{}{"delta": 50, "reason": "活動獎勵"},
+			expectedStatus: 200,
+			expectedPoints: 150,
+		},
+		{
+			name:           "積分不可為負",
+			requestBody:    map[string]interface{}{"delta": -200, "reason": "作弊"},
+			expectedStatus: 400,
+			expectedPoints: 150,
+		},
+		{
+			name:           "扣除積分",
+			requestBody:    map[string]interface{}{"delta": -150, "reason": "作弊"},
+			expectedStatus: 200,
+			expectedPoints: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.adminToken, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+
+			var user models.User
+			database.DB.First(&user, f.student.ID)
+			if user.TotalPoints != tt.expectedPoints {
+				t.Errorf("Expected user points %d, got %d", tt.expectedPoints, user.TotalPoints)
+			}
+
+			var school models.School
+			database.DB.First(&school, f.school.ID)
+			if school.TotalPoints != tt.expectedPoints {
+				t.Errorf("Expected school points %d, got %d", tt.expectedPoints, school.TotalPoints)
+			}
+		})
+	}
+
+	var logs []models.AdminAuditLog
+	database.DB.Where("target_id = ? AND action = ?", f.student.ID, AuditActionAdjustPoints).Find(&logs)
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 audit log entries, got %d", len(logs))
+	}
+	for _, log := range logs {
+		if log.Reason == "" || log.ActorID == nil {
+			t.Errorf("Audit log missing reason or actor: %+v", log)
+		}
+
+		// Every adjustment has a ledger entry pointing back at its audit log
+		var count int64
+		database.DB.Model(&models.PointTransaction{}).
+			Where("source = ? AND reference_id = ?", models.PointSourceAdminAdjustment, log.ID).
+			Count(&count)
+		if count != 1 {
+			t.Errorf("Expected 1 ledger entry for audit log %s, got %d", log.ID, count)
+		}
+	}
+}
+
+func TestAdminBanUser(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	path := fmt.Sprintf("/admin/users/%s/ban", f.student.ID)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.staffToken, map[string]interface{}{"reason": "刷分"})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var user models.User
+	database.DB.First(&user, f.student.ID)
+	if !user.LeaderboardBanned {
+		t.Error("Expected user to be banned from leaderboards")
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.staffToken, map[string]interface{}{"reason": "刷分"})
+	testutil.AssertStatusCode(t, w, 409)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", path, f.staffToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	database.DB.First(&user, f.student.ID)
+	if user.LeaderboardBanned {
+		t.Error("Expected leaderboard ban to be lifted")
+	}
+}
+
+func TestAdminBanLeavesSchoolTotal(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	database.DB.Model(f.student).Update("total_points", 300)
+	// The student and the school admin are both verified members
+	database.DB.Model(f.school).UpdateColumns(map[string]interface{}{"total_points": 300, "student_count": 2})
+
+	path := fmt.Sprintf("/admin/users/%s/ban", f.student.ID)
+	schoolPoints := func() int {
+		var school models.School
+		database.DB.First(&school, f.school.ID)
+		return school.TotalPoints
+	}
+
+	// Banning takes the student's points out of the school total
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.staffToken, map[string]interface{}{"reason": "刷分"})
+	testutil.AssertStatusCode(t, w, 200)
+	if points := schoolPoints(); points != 0 {
+		t.Errorf("Expected school points 0 after the ban, got %d", points)
+	}
+
+	// Points earned while banned don't reach the school
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := recordPoints(tx, f.student.ID, 50, models.PointSourceAdminAdjustment, nil, "測試")
+		return err
+	}); err != nil {
+		t.Fatalf("Failed to record points: %v", err)
+	}
+	if points := schoolPoints(); points != 0 {
+		t.Errorf("Expected school points to stay 0 while banned, got %d", points)
+	}
+
+	// Lifting the ban adds everything back
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", path, f.staffToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	if points := schoolPoints(); points != 350 {
+		t.Errorf("Expected school points 350 after lifting the ban, got %d", points)
+	}
+
+	drifts, err := ReconcileSchools(true)
+	if err != nil {
+		t.Fatalf("ReconcileSchools failed: %v", err)
+	}
+	for _, drift := range drifts {
+		if drift.SchoolID == f.school.ID {
+			t.Errorf("Expected no drift, got %+v", drift)
+		}
+	}
+}
+
+func TestAdminMergeSchoolsWritesAuditLog(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/admin/schools/merge", f.adminToken, map[string]interface{}{
+		"source_id": f.otherSchool.ID, "target_id": f.school.ID,
+	})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var count int64
+	database.DB.Model(&models.AdminAuditLog{}).
+		Where("action = ? AND target_id = ?", AuditActionMergeSchools, f.school.ID).
+		Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 audit log entry for the merge, got %d", count)
+	}
+}
+
+func TestAdminAddSchoolDomain(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	path := fmt.Sprintf("/admin/schools/%s/domains", f.school.ID)
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.staffToken, map[string]interface{}{"domain": "ntu.edu.tw"})
+	testutil.AssertStatusCode(t, w, 403)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.adminToken, map[string]interface{}{"domain": "ntu.edu.tw"})
+	testutil.AssertStatusCode(t, w, 201)
+
+	var count int64
+	database.DB.Model(&models.AdminAuditLog{}).
+		Where("action = ? AND target_id = ?", AuditActionAddDomain, f.school.ID).
+		Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 audit log entry for the domain, got %d", count)
+	}
+
+	// A domain already taken by another school leaves no audit entry
+	path = fmt.Sprintf("/admin/schools/%s/domains", f.otherSchool.ID)
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", path, f.adminToken, map[string]interface{}{"domain": "ntu.edu.tw"})
+	testutil.AssertStatusCode(t, w, 409)
+	database.DB.Model(&models.AdminAuditLog{}).Where("action = ?", AuditActionAddDomain).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected still 1 audit log entry, got %d", count)
+	}
+}
+
+func TestAdminChangeRole(t *testing.T) {
+	router, f, cleanup := setupAdminTests(t)
+	defer cleanup()
+
+	path := fmt.Sprintf("/admin/users/%s/role", f.student.ID)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "PUT", path, f.adminToken, map[string]interface{}{"role": "superuser"})
+	testutil.AssertStatusCode(t, w, 400)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "PUT", path, f.staffToken, map[string]interface{}{"role": "admin"})
+	testutil.AssertStatusCode(t, w, 403)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "PUT", path, f.adminToken, map[string]interface{}{"role": "school_admin"})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var user models.User
+	database.DB.First(&user, f.student.ID)
+	if user.Role != models.RoleSchoolAdmin {
+		t.Errorf("Expected role school_admin, got %s", user.Role)
+	}
+
+	// The promoted user signs in again to pick up the new role
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/admin/users", f.userToken, nil)
+	testutil.AssertStatusCode(t, w, 401)
+	promotedToken, _, _ := utils.GenerateSessionTokens(&user, uuid.Nil)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/admin/users", promotedToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	// A demoted admin loses access even though their token still says admin
+	database.DB.Model(&models.User{}).Where("email = ?", "admin@example.com").Update("role", models.RoleStudent)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/admin/users", f.adminToken, nil)
+	testutil.AssertStatusCode(t, w, 403)
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
 	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
 	"github.com/yourusername/tomato-backend/internal/utils"
 	"gorm.io/gorm"
@@ -10,14 +16,16 @@ import (
 
 type RegisterRequest struct {
 	Email      string `json:"email" binding:"required,email"`
-	Password   string `json:"password" binding:"required,min=6"`
+	Password   string `json:"password" binding:"required"`
 	Name       string `json:"name" binding:"required"`
 	SchoolName string `json:"school_name" binding:"required"`
+	DeviceName string `json:"device_name"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name"`
 }
 
 type AuthResponse struct {
@@ -34,6 +42,11 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
 	// Check if email already exists
 	var existingUser models.User
 	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
@@ -48,51 +61,56 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Find or create school
-	var school models.School
-	err = database.DB.Where("name = ?", req.SchoolName).FirstOrCreate(&school, models.School{
-		Name: req.SchoolName,
-	}).Error
-	if err != nil {
-		utils.InternalErrorResponse(c, "學校創建失敗")
-		return
-	}
-
-	// Create user
 	user := models.User{
 		Email:        req.Email,
 		PasswordHash: hashedPassword,
 		Name:         req.Name,
-		SchoolID:     &school.ID,
 		TotalPoints:  0,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	// Create user and their verification token atomically. The user only
+	// counts as a student of their school once the email is verified.
+	var verificationToken string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Resolve school by name or alias, creating it if unknown
+		school, err := findOrCreateSchool(tx, req.SchoolName)
+		if err != nil {
+			return err
+		}
+
+		user.SchoolID = &school.ID
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		verificationToken, err = issueUserToken(tx, user.ID, models.TokenPurposeEmailVerification, config.AppConfig.Account.EmailVerificationTTL)
+		return err
+	})
+	if err != nil {
 		utils.InternalErrorResponse(c, "用戶創建失敗")
 		return
 	}
 
+	// The user can request another email if this one fails
+	if err := sendVerificationEmail(&user, verificationToken); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
 	// Load school relation
 	database.DB.Preload("School").First(&user, user.ID)
 
 	// Generate tokens
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	token, refreshToken, err := startSession(c, &user, req.DeviceName)
 	if err != nil {
 		utils.InternalErrorResponse(c, "Token 生成失敗")
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email)
-	if err != nil {
-		utils.InternalErrorResponse(c, "Refresh token 生成失敗")
-		return
-	}
-
 	utils.SuccessResponse(c, 201, AuthResponse{
 		User:         user,
 		Token:        token,
 		RefreshToken: refreshToken,
-	}, "註冊成功")
+	}, "註冊成功，請至信箱完成驗證")
 }
 
 // Login handles user login
@@ -103,11 +121,21 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse locked accounts and IPs before looking at the password
+	accountKey, ipKey := loginThrottleKeys(c, req.Email)
+	if wait, err := loginLockedFor(accountKey, ipKey); err != nil {
+		utils.InternalErrorResponse(c, "")
+		return
+	} else if wait > 0 {
+		accountLockedResponse(c, wait)
+		return
+	}
+
 	// Find user by email
 	var user models.User
 	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			utils.UnauthorizedResponse(c, "Email 或密碼錯誤")
+			loginFailed(c, accountKey, ipKey)
 			return
 		}
 		utils.InternalErrorResponse(c, "查詢用戶失敗")
@@ -116,26 +144,24 @@ func Login(c *gin.Context) {
 
 	// Check password
 	if !utils.CheckPassword(req.Password, user.PasswordHash) {
-		utils.UnauthorizedResponse(c, "Email 或密碼錯誤")
+		loginFailed(c, accountKey, ipKey)
 		return
 	}
 
+	if err := clearLoginFailures(accountKey); err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", accountKey, err)
+	}
+
 	// Load school relation
 	database.DB.Preload("School").First(&user, user.ID)
 
 	// Generate tokens
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	token, refreshToken, err := startSession(c, &user, req.DeviceName)
 	if err != nil {
 		utils.InternalErrorResponse(c, "Token 生成失敗")
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email)
-	if err != nil {
-		utils.InternalErrorResponse(c, "Refresh token 生成失敗")
-		return
-	}
-
 	utils.SuccessResponse(c, 200, AuthResponse{
 		User:         user,
 		Token:        token,
@@ -143,6 +169,30 @@ func Login(c *gin.Context) {
 	}, "登入成功")
 }
 
+// loginFailed counts a failed login against the account and the client IP and
+// responds with ACCOUNT_LOCKED if that tipped either over the limit
+func loginFailed(c *gin.Context, accountKey, ipKey string) {
+	cfg := config.AppConfig.Login
+
+	var wait time.Duration
+	for key, maxAttempts := range map[string]int{accountKey: cfg.MaxAttempts, ipKey: cfg.IPMaxAttempts} {
+		lockout, err := recordLoginFailure(key, maxAttempts)
+		if err != nil {
+			log.Printf("Failed to record login failure for %s: %v", key, err)
+			continue
+		}
+		if lockout > wait {
+			wait = lockout
+		}
+	}
+
+	if wait > 0 {
+		accountLockedResponse(c, wait)
+		return
+	}
+	utils.UnauthorizedResponse(c, "Email 或密碼錯誤")
+}
+
 // RefreshToken handles token refresh
 func RefreshToken(c *gin.Context) {
 	type RefreshRequest struct {
@@ -162,16 +212,44 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Generate new tokens
-	token, err := utils.GenerateToken(claims.UserID, claims.Email)
-	if err != nil {
-		utils.InternalErrorResponse(c, "Token 生成失敗")
+	// An access token is rejected before it reaches the session, where it
+	// would look like a reused refresh token and revoke the session
+	if claims.Type == utils.TokenTypeAccess {
+		utils.UnauthorizedResponse(c, "無效的 refresh token")
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(claims.UserID, claims.Email)
+	// Reload user so role changes take effect on refresh
+	var user models.User
+	if err := database.DB.Select("id", "email", "role", "token_version").First(&user, claims.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.UnauthorizedResponse(c, "無效的 refresh token")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	// Refresh tokens issued before a password change are revoked
+	if user.TokenVersion != claims.TokenVersion {
+		utils.UnauthorizedResponse(c, "無效的 refresh token")
+		return
+	}
+
+	// Rotate the refresh token. Tokens issued before sessions were tracked
+	// start a new session.
+	var token, refreshToken string
+	if claims.SessionID == uuid.Nil {
+		token, refreshToken, err = startSession(c, &user, "")
+	} else {
+		token, refreshToken, err = refreshSession(c, &user, claims.SessionID, req.RefreshToken)
+	}
 	if err != nil {
-		utils.InternalErrorResponse(c, "Refresh token 生成失敗")
+		if err == ErrSessionInvalid || err == ErrRefreshTokenReused {
+			utils.UnauthorizedResponse(c, "無效的 refresh token")
+			return
+		}
+		utils.InternalErrorResponse(c, "Token 生成失敗")
 		return
 	}
 
@@ -181,7 +259,16 @@ func RefreshToken(c *gin.Context) {
 	}, "")
 }
 
-// Logout handles user logout (client-side token removal)
+// Logout handles user logout. The login session of the token is revoked so
+// that its refresh token can no longer be used.
 func Logout(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	if sessionID, ok := middleware.GetSessionID(c); ok {
+		if err := revokeSession(database.DB, userID, sessionID); err != nil && err != gorm.ErrRecordNotFound {
+			utils.InternalErrorResponse(c, "登出失敗")
+			return
+		}
+	}
+
 	utils.SuccessResponse(c, 200, nil, "登出成功")
 }
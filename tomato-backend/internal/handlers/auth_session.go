@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSessionInvalid     = errors.New("login session revoked or expired")
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+)
+
+// SessionResponse is a login session as listed to its user
+type SessionResponse struct {
+	models.AuthSession
+	Current bool `json:"current"`
+}
+
+// userAgentBrowsers and userAgentPlatforms map user agent markers to display
+// names. Order matters: Edge and Chrome both claim to be Safari.
+var (
+	userAgentBrowsers = []struct{ marker, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentPlatforms = []struct{ marker, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// deviceName returns the name the client gave its device, or one derived
+// from the user agent
+func deviceName(requested, userAgent string) string {
+	if name := strings.TrimSpace(requested); name != "" {
+		return truncate(name, 100)
+	}
+
+	var browser, platform string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.marker) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range userAgentPlatforms {
+		if strings.Contains(userAgent, p.marker) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "未知裝置"
+	}
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// startSession records a new login for user from the requesting device and
+// returns tokens bound to it
+func startSession(c *gin.Context, user *models.User, requestedName string) (token, refreshToken string, err error) {
+	now := time.Now()
+	session := models.AuthSession{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		DeviceName: deviceName(requestedName, c.Request.UserAgent()),
+		UserAgent:  truncate(c.Request.UserAgent(), 500),
+		IPAddress:  c.ClientIP(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(config.AppConfig.JWT.RefreshExpiration),
+	}
+
+	token, refreshToken, err = utils.GenerateSessionTokens(user, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	session.RefreshTokenHash = utils.HashToken(refreshToken)
+
+	if err := database.DB.Create(&session).Error; err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// refreshSession exchanges the session's current refresh token for a new
+// token pair. A refresh token that was already exchanged means it leaked, so
+// the session is revoked.
+func refreshSession(c *gin.Context, user *models.User, sessionID uuid.UUID, presented string) (token, refreshToken string, err error) {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.AuthSession
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", sessionID, user.ID).
+			First(&session).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrSessionInvalid
+			}
+			return err
+		}
+		if !session.IsActive() {
+			return ErrSessionInvalid
+		}
+		if session.RefreshTokenHash != utils.HashToken(presented) {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		token, refreshToken, err = utils.GenerateSessionTokens(user, session.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"refresh_token_hash": utils.HashToken(refreshToken),
+			"user_agent":         truncate(c.Request.UserAgent(), 500),
+			"ip_address":         c.ClientIP(),
+			"last_seen_at":       now,
+			"expires_at":         now.Add(config.AppConfig.JWT.RefreshExpiration),
+		}).Error
+	})
+
+	if err == ErrRefreshTokenReused {
+		log.Printf("Refresh token reused for session %s of user %s, revoking", sessionID, user.ID)
+		if err := revokeSession(database.DB, user.ID, sessionID); err != nil {
+			log.Printf("Failed to revoke session %s: %v", sessionID, err)
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// revokeSession revokes one of the user's sessions. It returns
+// gorm.ErrRecordNotFound if there is no such active session.
+func revokeSession(tx *gorm.DB, userID, sessionID uuid.UUID) error {
+	result := tx.Model(&models.AuthSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// revokeUserSessions signs the user out on every device
+func revokeUserSessions(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.AuthSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// ListSessions lists the devices the current user is logged in on
+func ListSessions(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+	currentID, _ := middleware.GetSessionID(c)
+
+	var sessions []models.AuthSession
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢登入裝置失敗")
+		return
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{
+			AuthSession: session,
+			Current:     session.ID == currentID,
+		}
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{"sessions": response}, "")
+}
+
+// RevokeSession signs one of the current user's devices out. Its access and
+// refresh tokens stop working immediately.
+func RevokeSession(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的裝置 ID")
+		return
+	}
+
+	if err := revokeSession(database.DB, userID, sessionID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "找不到此登入裝置")
+			return
+		}
+		utils.InternalErrorResponse(c, "登出裝置失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, nil, "已登出此裝置")
+}
+
+// CleanupAuthSessions deletes sessions that expired or were revoked
+func CleanupAuthSessions() (int64, error) {
+	result := database.DB.Where("expires_at < ? OR revoked_at IS NOT NULL", time.Now()).Delete(&models.AuthSession{})
+	return result.RowsAffected, result.Error
+}
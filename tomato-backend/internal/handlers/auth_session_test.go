@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+const iPhoneUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+
+func setupAuthSessionTests(t *testing.T) (*gin.Engine, *models.User, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/auth/login", Login)
+	router.POST("/auth/refresh", RefreshToken)
+	router.POST("/auth/logout", middleware.AuthMiddleware(), Logout)
+	router.GET("/auth/sessions", middleware.AuthMiddleware(), ListSessions)
+	router.DELETE("/auth/sessions/:id", middleware.AuthMiddleware(), RevokeSession)
+	router.GET("/users/me", middleware.AuthMiddleware(), GetMe)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, cleanup
+}
+
+// loginDevice logs in as the test user and returns the token pair
+func loginDevice(t *testing.T, router *gin.Engine, deviceName, userAgent string) (string, string) {
+	w := testutil.MakeRequest(t, router, "POST", "/auth/login", map[string]interface{}{
+		"email":       "test@example.com",
+		"password":    "password123",
+		"device_name": deviceName,
+	}, map[string]string{"User-Agent": userAgent})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	data := response.Data.(map[string]interface{})
+	return data["token"].(string), data["refresh_token"].(string)
+}
+
+func listSessions(t *testing.T, router *gin.Engine, token string) []interface{} {
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/auth/sessions", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	return response.Data.(map[string]interface{})["sessions"].([]interface{})
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	router, _, cleanup := setupAuthSessionTests(t)
+	defer cleanup()
+
+	laptopToken, _ := loginDevice(t, router, "我的筆電", "")
+	phoneToken, phoneRefresh := loginDevice(t, router, "", iPhoneUserAgent)
+
+	sessions := listSessions(t, router, laptopToken)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	var phoneID string
+	for _, s := range sessions {
+		session := s.(map[string]interface{})
+		switch session["device_name"] {
+		case "我的筆電":
+			if session["current"] != true {
+				t.Error("Expected the laptop session to be marked current")
+			}
+		case "Safari on iPhone":
+			phoneID = session["id"].(string)
+			if session["current"] != false {
+				t.Error("Expected the phone session not to be marked current")
+			}
+			if session["user_agent"] != iPhoneUserAgent {
+				t.Errorf("Expected user agent to be recorded, got %v", session["user_agent"])
+			}
+		default:
+			t.Errorf("Unexpected device name %v", session["device_name"])
+		}
+	}
+	if phoneID == "" {
+		t.Fatal("Expected a session named after the phone's user agent")
+	}
+
+	// Revoking signs the phone out at once
+	w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/auth/sessions/"+phoneID, laptopToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", phoneToken, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": phoneRefresh}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	if sessions := listSessions(t, router, laptopToken); len(sessions) != 1 {
+		t.Errorf("Expected 1 session after revoking, got %d", len(sessions))
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{name: "已登出的裝置", id: phoneID, expectedStatus: 404},
+		{name: "不存在的裝置", id: uuid.New().String(), expectedStatus: 404},
+		{name: "無效的 ID", id: "not-a-uuid", expectedStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/auth/sessions/"+tt.id, laptopToken, nil)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+		})
+	}
+}
+
+func TestRevokeOtherUsersSession(t *testing.T) {
+	router, _, cleanup := setupAuthSessionTests(t)
+	defer cleanup()
+
+	_, _ = loginDevice(t, router, "", "")
+
+	var session models.AuthSession
+	if err := database.DB.First(&session).Error; err != nil {
+		t.Fatalf("Expected a session to be recorded: %v", err)
+	}
+
+	other := testutil.CreateTestUser(database.DB, "other@example.com", "password123", "其他用戶", nil)
+	otherToken, _, _ := utils.GenerateSessionTokens(other, uuid.Nil)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/auth/sessions/"+session.ID.String(), otherToken, nil)
+	testutil.AssertStatusCode(t, w, 404)
+
+	database.DB.First(&session, session.ID)
+	if !session.IsActive() {
+		t.Error("Expected the session to remain active")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	router, _, cleanup := setupAuthSessionTests(t)
+	defer cleanup()
+
+	_, refreshToken := loginDevice(t, router, "", "")
+
+	w := testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": refreshToken}, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	newToken := response.Data.(map[string]interface{})["token"].(string)
+	newRefreshToken := response.Data.(map[string]interface{})["refresh_token"].(string)
+	if newRefreshToken == refreshToken {
+		t.Fatal("Expected the refresh token to be rotated")
+	}
+
+	// Replaying the old refresh token means it leaked: the session is revoked
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": refreshToken}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": newRefreshToken}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", newToken, nil)
+	testutil.AssertStatusCode(t, w, 401)
+}
+
+func TestTokenTypesNotInterchangeable(t *testing.T) {
+	router, _, cleanup := setupAuthSessionTests(t)
+	defer cleanup()
+
+	token, refreshToken := loginDevice(t, router, "", "")
+
+	// A refresh token is not accepted as an access token
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", refreshToken, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	// An access token cannot be refreshed, and does not revoke the session
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": token}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": refreshToken}, nil)
+	testutil.AssertStatusCode(t, w, 200)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	router, _, cleanup := setupAuthSessionTests(t)
+	defer cleanup()
+
+	token, refreshToken := loginDevice(t, router, "", "")
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/auth/logout", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": refreshToken}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", token, nil)
+	testutil.AssertStatusCode(t, w, 401)
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/yourusername/tomato-backend/internal/config"
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
@@ -52,7 +53,7 @@ func TestRegister(t *testing.T) {
 			name: "成功註冊",
 			requestBody: map[string]interface{}{
 				"email":       "test@example.com",
-				"password":    "password123",
+				"password":    "tomato-focus-42",
 				"name":        "測試用戶",
 				"school_name": "測試大學",
 			},
@@ -61,7 +62,7 @@ func TestRegister(t *testing.T) {
 		{
 			name: "缺少必填欄位 - email",
 			requestBody: map[string]interface{}{
-				"password":    "password123",
+				"password":    "tomato-focus-42",
 				"name":        "測試用戶",
 				"school_name": "測試大學",
 			},
@@ -82,7 +83,7 @@ func TestRegister(t *testing.T) {
 			name: "無效的 email 格式",
 			requestBody: map[string]interface{}{
 				"email":       "invalid-email",
-				"password":    "password123",
+				"password":    "tomato-focus-42",
 				"name":        "測試用戶",
 				"school_name": "測試大學",
 			},
@@ -100,11 +101,33 @@ func TestRegister(t *testing.T) {
 			expectedStatus: 400,
 			expectedError:  "VALIDATION_ERROR",
 		},
+		{
+			name: "常見密碼",
+			requestBody: map[string]interface{}{
+				"email":       "test4@example.com",
+				"password":    "Password123",
+				"name":        "測試用戶",
+				"school_name": "測試大學",
+			},
+			expectedStatus: 400,
+			expectedError:  "VALIDATION_ERROR",
+		},
+		{
+			name: "密碼字元種類不足",
+			requestBody: map[string]interface{}{
+				"email":       "test5@example.com",
+				"password":    "tomatofocus",
+				"name":        "測試用戶",
+				"school_name": "測試大學",
+			},
+			expectedStatus: 400,
+			expectedError:  "VALIDATION_ERROR",
+		},
 		{
 			name: "重複的 email",
 			requestBody: map[string]interface{}{
 				"email":       "test@example.com", // Same as first test
-				"password":    "password123",
+				"password":    "tomato-focus-42",
 				"name":        "測試用戶2",
 				"school_name": "測試大學",
 			},
@@ -247,7 +270,7 @@ func TestRefreshToken(t *testing.T) {
 	user := testutil.CreateTestUser(database.DB, "test@example.com", "password123", "測試用戶", &school.ID)
 
 	// Generate valid refresh token
-	validRefreshToken, _ := utils.GenerateRefreshToken(user.ID.String(), user.Email)
+	_, validRefreshToken, _ := utils.GenerateSessionTokens(user, uuid.Nil)
 
 	tests := []struct {
 		name           string
@@ -321,7 +344,7 @@ func TestLogout(t *testing.T) {
 	user := testutil.CreateTestUser(database.DB, "test@example.com", "password123", "測試用戶", &school.ID)
 
 	// Generate valid access token
-	validToken, _ := utils.GenerateToken(user.ID.String(), user.Email)
+	validToken, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
 
 	tests := []struct {
 		name           string
@@ -375,7 +398,7 @@ func TestAuthenticationFlow(t *testing.T) {
 	// Step 1: Register
 	registerBody := map[string]interface{}{
 		"email":       "flow@example.com",
-		"password":    "password123",
+		"password":    "tomato-focus-42",
 		"name":        "流程測試",
 		"school_name": "測試大學",
 	}
@@ -400,7 +423,7 @@ func TestAuthenticationFlow(t *testing.T) {
 	// Step 3: Login again
 	loginBody := map[string]interface{}{
 		"email":    "flow@example.com",
-		"password": "password123",
+		"password": "tomato-focus-42",
 	}
 	w = testutil.MakeRequest(t, router, "POST", "/auth/login", loginBody, nil)
 	testutil.AssertStatusCode(t, w, 200)
@@ -433,3 +456,41 @@ func TestAuthenticationFlow(t *testing.T) {
 
 	fmt.Println("✓ Complete authentication flow test passed")
 }
+
+func TestRegisterUpdatesStudentCount(t *testing.T) {
+	router, cleanup := setupAuthTests(t)
+	defer cleanup()
+
+	router.POST("/auth/register", Register)
+	router.POST("/auth/verify-email", VerifyEmail)
+	mail := captureMail(t)
+
+	for i := 1; i <= 2; i++ {
+		requestBody := map[string]interface{}{
+			"email":       fmt.Sprintf("student%d@example.com", i),
+			"password":    "tomato-focus-42",
+			"name":        "學生",
+			"school_name": "計數大學",
+		}
+		w := testutil.MakeRequest(t, router, "POST", "/auth/register", requestBody, nil)
+		testutil.AssertStatusCode(t, w, 201)
+	}
+
+	// Students only count once their email is verified
+	var school models.School
+	database.DB.Where("name = ?", "計數大學").First(&school)
+	if school.StudentCount != 0 {
+		t.Errorf("Expected student count 0 before verification, got %d", school.StudentCount)
+	}
+
+	for i := 1; i <= 2; i++ {
+		token := mail.lastToken(t, fmt.Sprintf("student%d@example.com", i))
+		w := testutil.MakeRequest(t, router, "POST", "/auth/verify-email", map[string]interface{}{"token": token}, nil)
+		testutil.AssertStatusCode(t, w, 200)
+	}
+
+	database.DB.First(&school, school.ID)
+	if school.StudentCount != 2 {
+		t.Errorf("Expected student count 2, got %d", school.StudentCount)
+	}
+}
@@ -168,7 +168,8 @@ func UpdateCourse(c *gin.Context) {
 	utils.SuccessResponse(c, 200, course, "課程更新成功")
 }
 
-// DeleteCourse deletes a course
+// DeleteCourse moves a course to the trash. Sessions keep referencing it so
+// historical stats still show the course name.
 func DeleteCourse(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -193,11 +194,11 @@ func DeleteCourse(c *gin.Context) {
 		return
 	}
 
-	// Delete course
+	// Soft delete course
 	if err := database.DB.Delete(&course).Error; err != nil {
 		utils.InternalErrorResponse(c, "課程刪除失敗")
 		return
 	}
 
-	utils.SuccessResponse(c, 200, nil, "課程刪除成功")
+	utils.SuccessResponse(c, 200, nil, "課程已移至垃圾桶")
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
@@ -26,7 +27,7 @@ func setupCourseTests(t *testing.T) (*gin.Engine, *models.User, string, func())
 	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
 
 	// Generate token
-	token, _ := utils.GenerateToken(user.ID.String(), user.Email)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
 
 	// Cleanup function
 	cleanup := func() {
@@ -44,8 +45,8 @@ func TestGetCourses(t *testing.T) {
 	router.GET("/courses", middleware.AuthMiddleware(), GetCourses)
 
 	// Create test courses
-	testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6", 3)
-	testutil.CreateTestCourse(database.DB, user.ID, "物理", "#ef4444", 4)
+	testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
+	testutil.CreateTestCourse(database.DB, user.ID, "物理", "#ef4444")
 
 	t.Run("成功獲取課程列表", func(t *testing.T) {
 		w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/courses", token, nil)
@@ -73,7 +74,7 @@ func TestGetCourses(t *testing.T) {
 }
 
 func TestCreateCourse(t *testing.T) {
-	router, user, token, cleanup := setupCourseTests(t)
+	router, _, token, cleanup := setupCourseTests(t)
 	defer cleanup()
 
 	router.POST("/courses", middleware.AuthMiddleware(), CreateCourse)
@@ -175,12 +176,12 @@ func TestGetCourse(t *testing.T) {
 	router.GET("/courses/:id", middleware.AuthMiddleware(), GetCourse)
 
 	// Create test course
-	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6", 3)
+	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
 
 	// Create another user's course
 	otherSchool := testutil.CreateTestSchool(database.DB, "其他大學")
 	otherUser := testutil.CreateTestUser(database.DB, "other@example.com", "password123", "其他用戶", &otherSchool.ID)
-	otherCourse := testutil.CreateTestCourse(database.DB, otherUser.ID, "其他課程", "#ef4444", 3)
+	otherCourse := testutil.CreateTestCourse(database.DB, otherUser.ID, "其他課程", "#ef4444")
 
 	tests := []struct {
 		name           string
@@ -235,7 +236,7 @@ func TestUpdateCourse(t *testing.T) {
 	router.PUT("/courses/:id", middleware.AuthMiddleware(), UpdateCourse)
 
 	// Create test course
-	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6", 3)
+	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
 
 	tests := []struct {
 		name           string
@@ -350,7 +351,7 @@ func TestDeleteCourse(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var courseID string
 			if tt.setupCourse {
-				course := testutil.CreateTestCourse(database.DB, user.ID, "待刪除課程", "#3b82f6", 3)
+				course := testutil.CreateTestCourse(database.DB, user.ID, "待刪除課程", "#3b82f6")
 				courseID = course.ID.String()
 			} else {
 				courseID = tt.courseID
@@ -377,7 +378,7 @@ func TestDeleteCourse(t *testing.T) {
 }
 
 func TestCourseCRUDFlow(t *testing.T) {
-	router, user, token, cleanup := setupCourseTests(t)
+	router, _, token, cleanup := setupCourseTests(t)
 	defer cleanup()
 
 	// Setup routes
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/events"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+// Event types sent over the event stream
+const (
+	// EventReady is the first event of a stream, with the user's current totals
+	EventReady          = "ready"
+	EventSessionCreated = "session_created"
+	EventPlanCreated    = "plan_created"
+	EventPlanUpdated    = "plan_updated"
+	EventPlanDeleted    = "plan_deleted"
+	EventPlanRestored   = "plan_restored"
+	EventTodoCreated    = "todo_created"
+	EventTodoUpdated    = "todo_updated"
+	EventTodoDeleted    = "todo_deleted"
+	EventTodoRestored   = "todo_restored"
+	EventPointsChanged  = "points_changed"
+	// EventSchoolRankChanged is sent to every student of a school whose rank
+	// among all schools changed
+	EventSchoolRankChanged = "school_rank_changed"
+)
+
+// eventHeartbeatInterval is how often an idle stream sends a comment so that
+// proxies keep the connection open
+var eventHeartbeatInterval = 25 * time.Second
+
+// eventBus carries change notifications from the handlers to event streams.
+// Handlers publish only after their transaction has committed.
+var eventBus = events.NewBus()
+
+// PointsUpdate is the payload of points_changed and ready events
+type PointsUpdate struct {
+	TotalPoints int             `json:"total_points"`
+	Delta       int             `json:"delta"`
+	Level       utils.LevelInfo `json:"level"`
+	SchoolRank  *SchoolRank     `json:"school_rank,omitempty"`
+}
+
+// SchoolRank is a school's position among all schools by total points
+type SchoolRank struct {
+	SchoolID    uuid.UUID `json:"school_id"`
+	SchoolName  string    `json:"school_name"`
+	Rank        int       `json:"rank"`
+	TotalPoints int       `json:"total_points"`
+	// PreviousRank is set on school_rank_changed events
+	PreviousRank int `json:"previous_rank,omitempty"`
+}
+
+// publishUserEvent notifies the user's own event streams
+func publishUserEvent(userID uuid.UUID, eventType string, data interface{}) {
+	eventBus.Publish(events.UserTopic(userID), events.Event{Type: eventType, Data: data})
+}
+
+// publishPointsChanged notifies the user of their new point total and
+// schedules a check whether any school moved in the ranking
+func publishPointsChanged(userID uuid.UUID, totalPoints, delta int) {
+	publishUserEvent(userID, EventPointsChanged, PointsUpdate{
+		TotalPoints: totalPoints,
+		Delta:       delta,
+		Level:       utils.LevelFor(totalPoints),
+	})
+	scheduleSchoolRankRefresh()
+}
+
+// schoolRankDelay is how long a rank refresh waits after a points change, so
+// that a burst of changes costs a single ranking query
+var schoolRankDelay = time.Second
+
+// schoolRanks remembers the last published rank of every school. Ranks are
+// only tracked while someone is listening.
+var schoolRanks struct {
+	sync.Mutex
+	ranks map[uuid.UUID]SchoolRank
+	// pending is set while a refresh is scheduled
+	pending bool
+	// refreshing serializes refreshes without holding the lock above
+	// during the ranking query
+	refreshing sync.Mutex
+}
+
+// scheduleSchoolRankRefresh refreshes the ranking after schoolRankDelay.
+// Changes in the meantime are folded into the scheduled refresh.
+func scheduleSchoolRankRefresh() {
+	schoolRanks.Lock()
+	defer schoolRanks.Unlock()
+
+	if !eventBus.Active() {
+		// Nobody is listening; the next listener starts afresh
+		schoolRanks.ranks = nil
+		return
+	}
+	if schoolRanks.pending {
+		return
+	}
+	schoolRanks.pending = true
+	time.AfterFunc(schoolRankDelay, func() {
+		schoolRanks.Lock()
+		schoolRanks.pending = false
+		schoolRanks.Unlock()
+
+		refreshSchoolRanks()
+	})
+}
+
+func computeSchoolRanks() ([]SchoolRank, error) {
+	var ranks []SchoolRank
+	err := database.DB.Raw(`
+		SELECT
+			id AS school_id,
+			name AS school_name,
+			total_points,
+			RANK() OVER (ORDER BY total_points DESC) AS rank
+		FROM schools`).Scan(&ranks).Error
+	return ranks, err
+}
+
+// refreshSchoolRanks recomputes the school ranking and notifies the students
+// of every school whose rank changed since the last refresh
+func refreshSchoolRanks() {
+	schoolRanks.refreshing.Lock()
+	defer schoolRanks.refreshing.Unlock()
+
+	if !eventBus.Active() {
+		schoolRanks.Lock()
+		schoolRanks.ranks = nil
+		schoolRanks.Unlock()
+		return
+	}
+
+	ranks, err := computeSchoolRanks()
+	if err != nil {
+		log.Printf("Failed to compute school ranks: %v", err)
+		return
+	}
+
+	schoolRanks.Lock()
+	defer schoolRanks.Unlock()
+
+	previous := schoolRanks.ranks
+	schoolRanks.ranks = make(map[uuid.UUID]SchoolRank, len(ranks))
+	for _, rank := range ranks {
+		schoolRanks.ranks[rank.SchoolID] = rank
+
+		// The first refresh only records where everyone stands
+		before, known := previous[rank.SchoolID]
+		if !known || before.Rank == rank.Rank {
+			continue
+		}
+		rank.PreviousRank = before.Rank
+		eventBus.Publish(events.SchoolTopic(rank.SchoolID), events.Event{Type: EventSchoolRankChanged, Data: rank})
+	}
+}
+
+// trackingSchoolRanks reports whether ranks have been computed since someone
+// started listening
+func trackingSchoolRanks() bool {
+	schoolRanks.Lock()
+	defer schoolRanks.Unlock()
+	return schoolRanks.ranks != nil
+}
+
+// currentSchoolRank returns the last known rank of a school
+func currentSchoolRank(schoolID uuid.UUID) *SchoolRank {
+	schoolRanks.Lock()
+	defer schoolRanks.Unlock()
+
+	rank, ok := schoolRanks.ranks[schoolID]
+	if !ok {
+		return nil
+	}
+	return &rank
+}
+
+// StreamEvents streams changes to the user's sessions, plans, todos, points
+// and school rank as Server-Sent Events until the client disconnects
+func StreamEvents(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "school_id", "total_points").First(&user, userID).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢使用者失敗")
+		return
+	}
+
+	topics := []string{events.UserTopic(user.ID)}
+	if user.SchoolID != nil {
+		topics = append(topics, events.SchoolTopic(*user.SchoolID))
+	}
+	sub := eventBus.Subscribe(topics...)
+	defer sub.Close()
+
+	// Start tracking ranks now that someone is listening
+	if !trackingSchoolRanks() {
+		refreshSchoolRanks()
+	}
+
+	ready := PointsUpdate{
+		TotalPoints: user.TotalPoints,
+		Level:       utils.LevelFor(user.TotalPoints),
+	}
+	if user.SchoolID != nil {
+		ready.SchoolRank = currentSchoolRank(*user.SchoolID)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keep nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	c.SSEvent(EventReady, ready)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind; the client reconnects and reloads
+				return false
+			}
+			c.SSEvent(event.Type, event.Data)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+func setupEventTests(t *testing.T) (*gin.Engine, *gorm.DB, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/events", middleware.AuthMiddleware(), StreamEvents)
+	router.POST("/auth/stream-ticket", middleware.AuthMiddleware(), CreateStreamTicket)
+	protected := router.Group("")
+	protected.Use(middleware.AuthMiddleware())
+	protected.POST("/sessions", CreateSession)
+	protected.POST("/todos", CreateTodo)
+	protected.DELETE("/todos/:id", DeleteTodo)
+
+	// Don't hold rank refreshes back for long
+	delay := schoolRankDelay
+	schoolRankDelay = 10 * time.Millisecond
+
+	// Cleanup function
+	cleanup := func() {
+		schoolRankDelay = delay
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, db, cleanup
+}
+
+type streamedEvent struct {
+	Type string
+	Data map[string]interface{}
+}
+
+type eventStream struct {
+	t      *testing.T
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+// openEventStream connects the way a browser EventSource does, with a
+// stream ticket in the query string
+func openEventStream(t *testing.T, server *httptest.Server, token string) *eventStream {
+	req, _ := http.NewRequest("GET", server.URL+"/events?ticket="+streamTicket(t, server, token), nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	return &eventStream{t: t, resp: resp, reader: bufio.NewReader(resp.Body)}
+}
+
+// next reads the next event, skipping heartbeats
+func (s *eventStream) next() streamedEvent {
+	type result struct {
+		event streamedEvent
+		err   error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		var event streamedEvent
+		for {
+			line, err := s.reader.ReadString('\n')
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event.Type = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event.Data)
+			case line == "" && event.Type != "":
+				done <- result{event: event}
+				return
+			}
+		}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			s.t.Fatalf("Failed to read event: %v", r.err)
+		}
+		return r.event
+	case <-time.After(2 * time.Second):
+		s.t.Fatal("Timed out waiting for an event")
+		return streamedEvent{}
+	}
+}
+
+func (s *eventStream) expect(eventType string) streamedEvent {
+	event := s.next()
+	if event.Type != eventType {
+		s.t.Fatalf("Expected %s event, got %s %v", eventType, event.Type, event.Data)
+	}
+	return event
+}
+
+func TestStreamEvents(t *testing.T) {
+	router, db, cleanup := setupEventTests(t)
+	defer cleanup()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	other := testutil.CreateTestUser(db, "other@example.com", "password123", "其他用戶", nil)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+	otherToken, _, _ := utils.GenerateSessionTokens(other, uuid.Nil)
+
+	stream := openEventStream(t, server, token)
+	defer stream.resp.Body.Close()
+
+	ready := stream.expect(EventReady)
+	if ready.Data["total_points"].(float64) != 0 {
+		t.Errorf("Expected 0 points, got %v", ready.Data["total_points"])
+	}
+
+	// Other users' changes are not streamed
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/todos", otherToken, map[string]interface{}{
+		"title": "別人的待辦", "date": "2026-10-18", "todo_type": "memo",
+	})
+	testutil.AssertStatusCode(t, w, 201)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+		"date": "2026-10-18", "minutes": 25,
+	})
+	testutil.AssertStatusCode(t, w, 201)
+
+	session := stream.expect(EventSessionCreated)
+	if session.Data["minutes"].(float64) != 25 {
+		t.Errorf("Expected the 25 minute session, got %v", session.Data)
+	}
+	points := stream.expect(EventPointsChanged)
+	if int(points.Data["total_points"].(float64)) != sessionPoints(25) || int(points.Data["delta"].(float64)) != sessionPoints(25) {
+		t.Errorf("Expected %d points, got %v", sessionPoints(25), points.Data)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/todos", token, map[string]interface{}{
+		"title": "期中考", "date": "2026-10-20", "todo_type": "exam",
+	})
+	testutil.AssertStatusCode(t, w, 201)
+	todo := stream.expect(EventTodoCreated)
+	if todo.Data["title"] != "期中考" {
+		t.Errorf("Expected the new todo, got %v", todo.Data)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/todos/"+todo.Data["id"].(string), token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	if deleted := stream.expect(EventTodoDeleted); deleted.Data["id"] != todo.Data["id"] {
+		t.Errorf("Expected the todo to be deleted, got %v", deleted.Data)
+	}
+}
+
+func TestStreamSchoolRankChanged(t *testing.T) {
+	router, db, cleanup := setupEventTests(t)
+	defer cleanup()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	mine := testutil.CreateTestSchool(db, "我的大學")
+	rival := testutil.CreateTestSchool(db, "對手大學")
+	db.Model(rival).Update("total_points", 100)
+
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &mine.ID)
+	classmate := testutil.CreateTestUser(db, "classmate@example.com", "password123", "同學", &mine.ID)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+	classmateToken, _, _ := utils.GenerateSessionTokens(classmate, uuid.Nil)
+
+	stream := openEventStream(t, server, token)
+	defer stream.resp.Body.Close()
+
+	ready := stream.expect(EventReady)
+	rank := ready.Data["school_rank"].(map[string]interface{})
+	if rank["rank"].(float64) != 2 {
+		t.Fatalf("Expected my school to start second, got %v", rank)
+	}
+
+	// A classmate's session lifts the whole school past the rival
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", classmateToken, map[string]interface{}{
+		"date": "2026-10-18", "minutes": 60,
+	})
+	testutil.AssertStatusCode(t, w, 201)
+
+	changed := stream.expect(EventSchoolRankChanged)
+	if changed.Data["school_id"] != mine.ID.String() || changed.Data["rank"].(float64) != 1 || changed.Data["previous_rank"].(float64) != 2 {
+		t.Errorf("Expected my school to move from 2 to 1, got %v", changed.Data)
+	}
+
+	var school models.School
+	db.First(&school, mine.ID)
+	if int(changed.Data["total_points"].(float64)) != school.TotalPoints {
+		t.Errorf("Expected %d school points, got %v", school.TotalPoints, changed.Data["total_points"])
+	}
+}
+
+func TestStreamEventsRequiresAuth(t *testing.T) {
+	router, _, cleanup := setupEventTests(t)
+	defer cleanup()
+
+	w := testutil.MakeRequest(t, router, "GET", "/events", nil, map[string]string{"Accept": "text/event-stream"})
+	testutil.AssertStatusCode(t, w, 401)
+}
+
+func TestEventStreamTicket(t *testing.T) {
+	router, db, cleanup := setupEventTests(t)
+	defer cleanup()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", nil)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	open := func(query string) int {
+		req, _ := http.NewRequest("GET", server.URL+"/events?"+query, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to open event stream: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Tokens are no longer accepted in the URL
+	if status := open("access_token=" + token); status != 401 {
+		t.Errorf("Expected a token in the URL to be rejected, got %d", status)
+	}
+
+	ticket := streamTicket(t, server, token)
+	if status := open("ticket=" + ticket); status != 200 {
+		t.Fatalf("Expected the ticket to open the stream, got %d", status)
+	}
+	if status := open("ticket=" + ticket); status != 401 {
+		t.Errorf("Expected a used ticket to be rejected, got %d", status)
+	}
+
+	// Expired tickets are rejected too
+	ticket = streamTicket(t, server, token)
+	db.Model(&models.UserToken{}).Where("token_hash = ?", utils.HashToken(ticket)).Update("expires_at", time.Now().Add(-time.Second))
+	if status := open("ticket=" + ticket); status != 401 {
+		t.Errorf("Expected an expired ticket to be rejected, got %d", status)
+	}
+}
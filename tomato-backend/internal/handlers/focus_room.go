@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/focusroom"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"golang.org/x/net/websocket"
+)
+
+// focusRoomLocation is the location recorded on sessions from room pomodoros
+const focusRoomLocation = "線上自習室"
+
+// focusRooms tracks the live focus room of every study group
+var focusRooms = focusroom.NewHub(recordRoomPomodoro)
+
+// StartFocusRooms starts the hub goroutine behind the focus rooms
+func StartFocusRooms() (stop func()) {
+	return focusRooms.Start()
+}
+
+// recordRoomPomodoro gives every participant of a finished room pomodoro a
+// focus session, exactly as if they had submitted it themselves. Participants
+// who left the group while it ran get nothing.
+func recordRoomPomodoro(p focusroom.Pomodoro) {
+	for _, userID := range p.Participants {
+		var members int64
+		if err := database.DB.Model(&models.StudyGroupMember{}).
+			Where("group_id = ? AND user_id = ?", p.RoomID, userID).
+			Count(&members).Error; err != nil {
+			log.Printf("Failed to check room membership of user %s: %v", userID, err)
+			continue
+		}
+		if members == 0 {
+			continue
+		}
+
+		startedAt := p.StartedAt
+		session := models.FocusSession{
+			UserID:       userID,
+			Date:         localDate(p.StartedAt),
+			Minutes:      p.Minutes,
+			StartedAt:    &startedAt,
+			PointsEarned: sessionPoints(p.Minutes),
+			Location:     focusRoomLocation,
+		}
+
+		if _, err := saveFocusSession(&session); err != nil {
+			log.Printf("Failed to record room pomodoro for user %s: %v", userID, err)
+		}
+	}
+}
+
+// checkRoomOrigin only accepts browser connections from the allowed CORS
+// origins. Native clients send no Origin header.
+func checkRoomOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	for _, allowed := range config.AppConfig.CORS.AllowedOrigins {
+		if origin == allowed {
+			return nil
+		}
+	}
+	return errors.New("origin not allowed")
+}
+
+// JoinFocusRoom upgrades to a WebSocket connection to the study group's live
+// focus room. Members see who is present, start pomodoros together and get
+// a focus session for every one they stay until the end.
+func JoinFocusRoom(c *gin.Context) {
+	group, member, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		utils.ValidationErrorResponse(c, "請使用 WebSocket 連線")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "name").First(&user, member.UserID).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢使用者失敗")
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: checkRoomOrigin,
+		Handler: func(conn *websocket.Conn) {
+			focusRooms.Serve(conn, group.ID.String(), user.ID, user.Name)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
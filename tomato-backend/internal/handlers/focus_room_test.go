@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/focusroom"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"golang.org/x/net/websocket"
+)
+
+// streamTicket requests a ticket for opening a WebSocket connection or event
+// stream, the way a browser does before connecting
+func streamTicket(t *testing.T, server *httptest.Server, token string) string {
+	req, _ := http.NewRequest("POST", server.URL+"/auth/stream-ticket", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request a stream ticket: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data struct {
+			Ticket string `json:"ticket"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to parse stream ticket: %v", err)
+	}
+	return response.Data.Ticket
+}
+
+func dialFocusRoom(server *httptest.Server, groupID, ticket string) (*websocket.Conn, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/groups/" + groupID + "/room?ticket=" + ticket
+	return websocket.Dial(url, "", "http://localhost:3000")
+}
+
+// receiveRoomEvent reads events until one of the given type arrives
+func receiveRoomEvent(t *testing.T, conn *websocket.Conn, eventType string) focusroom.Event {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var event focusroom.Event
+		if err := websocket.JSON.Receive(conn, &event); err != nil {
+			t.Fatalf("Expected %s event, got error: %v", eventType, err)
+		}
+		if event.Type == eventType {
+			return event
+		}
+	}
+}
+
+func TestFocusRoomRecordsSessions(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+	router.GET("/groups/:id/room", middleware.AuthMiddleware(), JoinFocusRoom)
+	router.POST("/auth/stream-ticket", middleware.AuthMiddleware(), CreateStreamTicket)
+
+	var mu sync.Mutex
+	now := time.Now()
+	defer func(hub *focusroom.Hub) { focusRooms = hub }(focusRooms)
+	focusRooms = focusroom.NewHub(recordRoomPomodoro)
+	focusRooms.TickInterval = 5 * time.Millisecond
+	focusRooms.Now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	stop := StartFocusRooms()
+	defer stop()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "讀書會"})
+	groupID := group["id"].(string)
+
+	// Only members may enter
+	if _, err := dialFocusRoom(server, groupID, streamTicket(t, server, f.outsiderToken)); err == nil {
+		t.Fatal("Expected an outsider to be turned away")
+	}
+	if _, err := dialFocusRoom(server, groupID, "invalid"); err == nil {
+		t.Fatal("Expected an invalid ticket to be turned away")
+	}
+
+	ownerTicket := streamTicket(t, server, f.ownerToken)
+	owner, err := dialFocusRoom(server, groupID, ownerTicket)
+	if err != nil {
+		t.Fatalf("Failed to join as owner: %v", err)
+	}
+	defer owner.Close()
+	receiveRoomEvent(t, owner, focusroom.EventState)
+
+	// Tickets only work once
+	if _, err := dialFocusRoom(server, groupID, ownerTicket); err == nil {
+		t.Fatal("Expected a used ticket to be turned away")
+	}
+
+	member, err := dialFocusRoom(server, groupID, streamTicket(t, server, f.memberToken))
+	if err != nil {
+		t.Fatalf("Failed to join as member: %v", err)
+	}
+	defer member.Close()
+	receiveRoomEvent(t, member, focusroom.EventState)
+	if join := receiveRoomEvent(t, owner, focusroom.EventJoin); join.Member.Name != "組員" {
+		t.Errorf("Expected the member to join by name, got %+v", join.Member)
+	}
+
+	websocket.JSON.Send(owner, focusroom.Command{Type: focusroom.CommandStart, Minutes: 30})
+	receiveRoomEvent(t, member, focusroom.EventStart)
+
+	mu.Lock()
+	now = now.Add(30 * time.Minute)
+	mu.Unlock()
+	receiveRoomEvent(t, member, focusroom.EventFinish)
+
+	// Sessions are recorded in the background
+	deadline := time.Now().Add(2 * time.Second)
+	var sessions []models.FocusSession
+	for time.Now().Before(deadline) {
+		database.DB.Where("location = ?", focusRoomLocation).Find(&sessions)
+		if len(sessions) == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected a session for both participants, got %d", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.Minutes != 30 || s.PointsEarned != sessionPoints(30) {
+			t.Errorf("Expected 30 minutes worth %d points, got %+v", sessionPoints(30), s)
+		}
+	}
+
+	var user models.User
+	database.DB.First(&user, f.member.ID)
+	if user.TotalPoints != sessionPoints(30) {
+		t.Errorf("Expected the member to be credited %d points, got %d", sessionPoints(30), user.TotalPoints)
+	}
+}
+
+func TestFocusRoomRemovesFormerMembers(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+	router.GET("/groups/:id/room", middleware.AuthMiddleware(), JoinFocusRoom)
+	router.POST("/auth/stream-ticket", middleware.AuthMiddleware(), CreateStreamTicket)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "讀書會"})
+	groupID := group["id"].(string)
+
+	owner, err := dialFocusRoom(server, groupID, streamTicket(t, server, f.ownerToken))
+	if err != nil {
+		t.Fatalf("Failed to join as owner: %v", err)
+	}
+	defer owner.Close()
+	receiveRoomEvent(t, owner, focusroom.EventState)
+
+	member, err := dialFocusRoom(server, groupID, streamTicket(t, server, f.memberToken))
+	if err != nil {
+		t.Fatalf("Failed to join as member: %v", err)
+	}
+	defer member.Close()
+	receiveRoomEvent(t, member, focusroom.EventState)
+	receiveRoomEvent(t, owner, focusroom.EventJoin)
+
+	// A removed member is disconnected
+	w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/groups/"+groupID+"/members/"+f.member.ID.String(), f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	receiveRoomEvent(t, member, focusroom.EventRemoved)
+	receiveRoomEvent(t, owner, focusroom.EventLeave)
+
+	// Pomodoros that finish after someone left the group only count for members
+	config.AppConfig.Stats.Timezone = "Asia/Taipei"
+	startedAt := time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC)
+	recordRoomPomodoro(focusroom.Pomodoro{
+		RoomID:       groupID,
+		Minutes:      25,
+		StartedAt:    startedAt,
+		EndedAt:      startedAt.Add(25 * time.Minute),
+		Participants: []uuid.UUID{f.owner.ID, f.member.ID},
+	})
+
+	var sessions []models.FocusSession
+	database.DB.Where("location = ?", focusRoomLocation).Find(&sessions)
+	if len(sessions) != 1 || sessions[0].UserID != f.owner.ID {
+		t.Fatalf("Expected a session for the owner only, got %+v", sessions)
+	}
+	// Dated in STATS_TIMEZONE, where it was already Monday
+	if got := sessions[0].Date.Format("2006-01-02"); got != "2026-10-19" {
+		t.Errorf("Expected the session dated 2026-10-19, got %s", got)
+	}
+
+	// Deleting the group closes the room
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/groups/"+groupID, f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	receiveRoomEvent(t, owner, focusroom.EventRemoved)
+}
+
+func TestFocusRoomRequiresWebSocket(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+	router.GET("/groups/:id/room", middleware.AuthMiddleware(), JoinFocusRoom)
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "讀書會"})
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/groups/"+group["id"].(string)+"/room", f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 400)
+}
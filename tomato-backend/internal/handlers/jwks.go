@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+// GetJWKS publishes the public keys access tokens can be verified with. The
+// document is a plain JWK Set so that standard JWT libraries can consume it.
+func GetJWKS(c *gin.Context) {
+	set, err := utils.PublicJWKS()
+	if err != nil {
+		utils.InternalErrorResponse(c, "")
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, set)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupJWKSTests(t *testing.T) *gin.Engine {
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	secret := config.AppConfig.JWT.Secret
+	t.Cleanup(func() {
+		config.AppConfig.JWT.Secret = secret
+		config.AppConfig.JWT.SigningKeyFile = ""
+		config.AppConfig.JWT.VerificationKeyFiles = nil
+	})
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/.well-known/jwks.json", GetJWKS)
+
+	return router
+}
+
+// writeKeyFile writes key as a PKCS#8 PEM file and returns its path
+func writeKeyFile(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return path
+}
+
+func fetchJWKS(t *testing.T, router *gin.Engine) utils.JWKSet {
+	w := testutil.MakeRequest(t, router, "GET", "/.well-known/jwks.json", nil, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var set utils.JWKSet
+	testutil.ParseResponse(t, w, &set)
+	return set
+}
+
+func tokenKid(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &utils.Claims{})
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	router := setupJWKSTests(t)
+	user := &models.User{ID: uuid.New(), Email: "test@example.com", Role: models.RoleStudent}
+
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	oldPath, newPath := writeKeyFile(t, oldKey), writeKeyFile(t, newKey)
+
+	// HS256 secrets are never published
+	if set := fetchJWKS(t, router); len(set.Keys) != 0 {
+		t.Errorf("Expected no public keys with HS256, got %d", len(set.Keys))
+	}
+	legacyToken, _, err := utils.GenerateSessionTokens(user, uuid.Nil)
+	if err != nil {
+		t.Fatalf("GenerateSessionTokens failed: %v", err)
+	}
+
+	config.AppConfig.JWT.SigningKeyFile = oldPath
+	oldToken, _, err := utils.GenerateSessionTokens(user, uuid.Nil)
+	if err != nil {
+		t.Fatalf("GenerateSessionTokens failed: %v", err)
+	}
+	set := fetchJWKS(t, router)
+	if len(set.Keys) != 1 || set.Keys[0].Alg != "EdDSA" || set.Keys[0].Kid != tokenKid(t, oldToken) {
+		t.Fatalf("Expected the Ed25519 key to be published, got %+v", set.Keys)
+	}
+
+	// Rotate: sign with the new key, keep accepting the old one
+	config.AppConfig.JWT.SigningKeyFile = newPath
+	config.AppConfig.JWT.VerificationKeyFiles = []string{oldPath}
+	newToken, _, err := utils.GenerateSessionTokens(user, uuid.Nil)
+	if err != nil {
+		t.Fatalf("GenerateSessionTokens failed: %v", err)
+	}
+	if set := fetchJWKS(t, router); len(set.Keys) != 2 {
+		t.Errorf("Expected 2 published keys during rotation, got %d", len(set.Keys))
+	}
+	for name, token := range map[string]string{"legacy": legacyToken, "old": oldToken, "new": newToken} {
+		claims, err := utils.ValidateToken(token)
+		if err != nil {
+			t.Errorf("Expected %s token to be accepted: %v", name, err)
+		} else if claims.UserID != user.ID {
+			t.Errorf("Expected user %s in %s token, got %s", user.ID, name, claims.UserID)
+		}
+	}
+
+	// Retire the old key and the secret
+	config.AppConfig.JWT.VerificationKeyFiles = nil
+	config.AppConfig.JWT.Secret = ""
+	if _, err := utils.ValidateToken(oldToken); err == nil {
+		t.Error("Expected token signed by a retired key to be rejected")
+	}
+	if _, err := utils.ValidateToken(legacyToken); err == nil {
+		t.Error("Expected HS256 token to be rejected without a secret")
+	}
+	if _, err := utils.ValidateToken(newToken); err != nil {
+		t.Errorf("Expected token signed by the current key to be accepted: %v", err)
+	}
+}
+
+func TestJWKSRejectsAlgorithmConfusion(t *testing.T) {
+	setupJWKSTests(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	config.AppConfig.JWT.SigningKeyFile = writeKeyFile(t, key)
+
+	token, _, err := utils.GenerateSessionTokens(&models.User{ID: uuid.New(), Email: "test@example.com"}, uuid.Nil)
+	if err != nil {
+		t.Fatalf("GenerateSessionTokens failed: %v", err)
+	}
+
+	// An HS256 token claiming the RSA key's ID must not be verified with
+	// the public key as an HMAC secret
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.Claims{UserID: uuid.New()})
+	forged.Header["kid"] = tokenKid(t, token)
+	forgedString, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	if err != nil {
+		t.Fatalf("Failed to sign forged token: %v", err)
+	}
+	if _, err := utils.ValidateToken(forgedString); err == nil {
+		t.Error("Expected forged HS256 token to be rejected")
+	}
+}
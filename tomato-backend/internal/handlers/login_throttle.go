@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loginThrottleKeys returns the throttle keys for a login attempt. Accounts
+// are keyed by email so attempts on unknown emails are throttled alike.
+func loginThrottleKeys(c *gin.Context, email string) (accountKey, ipKey string) {
+	return "account:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + c.ClientIP()
+}
+
+// loginLockedFor returns how long logins remain refused for any of keys, or
+// zero if none of them is locked
+func loginLockedFor(keys ...string) (time.Duration, error) {
+	now := time.Now()
+
+	var throttles []models.LoginThrottle
+	if err := database.DB.Where("key IN ? AND locked_until > ?", keys, now).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if remaining := throttle.LockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// lockoutDuration doubles the base lockout for every failure past the limit,
+// capped at the configured maximum
+func lockoutDuration(excess int) time.Duration {
+	cfg := config.AppConfig.Login
+	if excess >= 30 {
+		return cfg.MaxLockout
+	}
+	lockout := cfg.BaseLockout * time.Duration(1<<excess)
+	if lockout <= 0 || lockout > cfg.MaxLockout {
+		return cfg.MaxLockout
+	}
+	return lockout
+}
+
+// recordLoginFailure counts a failed login against key and locks it once
+// maxAttempts failures pile up within the configured window. Returns how long
+// the key is now locked for, if at all.
+func recordLoginFailure(key string, maxAttempts int) (time.Duration, error) {
+	window := config.AppConfig.Login.Window
+	var lockout time.Duration
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		throttle := models.LoginThrottle{Key: key, LastFailureAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&throttle).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).
+			First(&throttle).Error; err != nil {
+			return err
+		}
+
+		// Forget old failures, but keep escalating if attempts resume right
+		// after a lockout ends
+		quietSince := throttle.LastFailureAt
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(quietSince) {
+			quietSince = *throttle.LockedUntil
+		}
+		if now.Sub(quietSince) > window {
+			throttle.Failures = 0
+			throttle.LockedUntil = nil
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		if throttle.Failures >= maxAttempts {
+			lockout = lockoutDuration(throttle.Failures - maxAttempts)
+			lockedUntil := now.Add(lockout)
+			throttle.LockedUntil = &lockedUntil
+		}
+
+		return tx.Save(&throttle).Error
+	})
+
+	return lockout, err
+}
+
+// clearLoginFailures forgets failed logins for key after a successful login
+func clearLoginFailures(key string) error {
+	return database.DB.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+// accountLockedResponse reports a lockout with the time until logins are
+// accepted again
+func accountLockedResponse(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	minutes := int(math.Ceil(wait.Minutes()))
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	utils.ErrorResponse(c, 429, "ACCOUNT_LOCKED",
+		fmt.Sprintf("登入失敗次數過多，請於 %d 分鐘後再試", minutes),
+		gin.H{"retry_after": seconds})
+}
+
+// CleanupLoginThrottles deletes counters that have been quiet for longer than
+// the attempt window
+func CleanupLoginThrottles() (int64, error) {
+	cutoff := time.Now().Add(-config.AppConfig.Login.Window)
+	result := database.DB.
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", cutoff, cutoff).
+		Delete(&models.LoginThrottle{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+)
+
+func setupLoginThrottleTests(t *testing.T) (*gin.Engine, *models.User, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.AppConfig.Login = config.LoginThrottleConfig{
+		MaxAttempts:   3,
+		IPMaxAttempts: 10,
+		Window:        15 * time.Minute,
+		BaseLockout:   time.Minute,
+		MaxLockout:    time.Hour,
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/auth/login", Login)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, cleanup
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	router, user, cleanup := setupLoginThrottleTests(t)
+	defer cleanup()
+
+	wrong := map[string]interface{}{"email": user.Email, "password": "wrongpassword"}
+	correct := map[string]interface{}{"email": user.Email, "password": "password123"}
+
+	for i := 1; i < 3; i++ {
+		w := testutil.MakeRequest(t, router, "POST", "/auth/login", wrong, nil)
+		testutil.AssertStatusCode(t, w, 401)
+	}
+
+	// The third failure locks the account
+	w := testutil.MakeRequest(t, router, "POST", "/auth/login", wrong, nil)
+	testutil.AssertStatusCode(t, w, 429)
+	testutil.AssertError(t, w, "ACCOUNT_LOCKED")
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// Even the correct password is refused while locked
+	w = testutil.MakeRequest(t, router, "POST", "/auth/login", correct, nil)
+	testutil.AssertStatusCode(t, w, 429)
+	testutil.AssertError(t, w, "ACCOUNT_LOCKED")
+
+	// A failure right after the lockout ends doubles the next lockout
+	database.DB.Model(&models.LoginThrottle{}).
+		Where("key = ?", "account:"+user.Email).
+		Update("locked_until", time.Now().Add(-time.Second))
+	w = testutil.MakeRequest(t, router, "POST", "/auth/login", wrong, nil)
+	testutil.AssertStatusCode(t, w, 429)
+	if w.Header().Get("Retry-After") != "120" {
+		t.Errorf("Expected Retry-After 120, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// A successful login after the lockout clears the counter
+	database.DB.Model(&models.LoginThrottle{}).
+		Where("key = ?", "account:"+user.Email).
+		Update("locked_until", time.Now().Add(-time.Second))
+	w = testutil.MakeRequest(t, router, "POST", "/auth/login", correct, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var count int64
+	database.DB.Model(&models.LoginThrottle{}).Where("key = ?", "account:"+user.Email).Count(&count)
+	if count != 0 {
+		t.Error("Expected account failures to be cleared after successful login")
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	router, user, cleanup := setupLoginThrottleTests(t)
+	defer cleanup()
+
+	// Spread failures over many accounts so only the IP limit is reached
+	for i := 1; i <= 10; i++ {
+		requestBody := map[string]interface{}{
+			"email":    fmt.Sprintf("guess%d@example.com", i),
+			"password": "wrongpassword",
+		}
+		w := testutil.MakeRequest(t, router, "POST", "/auth/login", requestBody, nil)
+		if i < 10 {
+			testutil.AssertStatusCode(t, w, 401)
+		} else {
+			testutil.AssertStatusCode(t, w, 429)
+		}
+	}
+
+	w := testutil.MakeRequest(t, router, "POST", "/auth/login", map[string]interface{}{"email": user.Email, "password": "password123"}, nil)
+	testutil.AssertStatusCode(t, w, 429)
+	testutil.AssertError(t, w, "ACCOUNT_LOCKED")
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/oidc"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOIDCNoEmail          = errors.New("provider did not return an email address")
+	ErrOIDCDomainNotAllowed = errors.New("email domain not allowed for this provider")
+	ErrOIDCEmailInUse       = errors.New("email belongs to an account that cannot be linked")
+)
+
+type OIDCCallbackRequest struct {
+	Code       string `json:"code" binding:"required"`
+	State      string `json:"state" binding:"required"`
+	DeviceName string `json:"device_name"`
+}
+
+// ListOIDCProviders lists the configured single sign-on providers
+func ListOIDCProviders(c *gin.Context) {
+	utils.SuccessResponse(c, 200, gin.H{"providers": oidc.Names()}, "")
+}
+
+// StartOIDCLogin begins a login with the given provider and returns the URL
+// the frontend should redirect the user to
+func StartOIDCLogin(c *gin.Context) {
+	provider, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		utils.NotFoundResponse(c, "找不到此登入方式")
+		return
+	}
+
+	loginState := models.OIDCLoginState{
+		Provider:  provider.Config.Name,
+		ExpiresAt: time.Now().Add(config.AppConfig.OIDC.StateTTL),
+	}
+	for _, value := range []*string{&loginState.State, &loginState.Nonce, &loginState.CodeVerifier} {
+		if *value, err = utils.GenerateRandomToken(); err != nil {
+			utils.InternalErrorResponse(c, "")
+			return
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), loginState.State, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC provider %s unavailable: %v", provider.Config.Name, err)
+		utils.ErrorResponse(c, 502, "PROVIDER_ERROR", "無法連線至登入服務", nil)
+		return
+	}
+
+	if err := database.DB.Create(&loginState).Error; err != nil {
+		utils.InternalErrorResponse(c, "")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{"authorization_url": authURL}, "")
+}
+
+// OIDCCallback completes a login with the code and state the provider
+// redirected back with. The provider account is linked to an existing user
+// with the same verified email, or a new user is created.
+func OIDCCallback(c *gin.Context) {
+	provider, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		utils.NotFoundResponse(c, "找不到此登入方式")
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	// Each state can be redeemed once
+	var loginState models.OIDCLoginState
+	result := database.DB.Clauses(clause.Returning{}).
+		Where("state = ? AND provider = ?", req.State, provider.Config.Name).
+		Delete(&loginState)
+	if result.Error != nil {
+		utils.InternalErrorResponse(c, "")
+		return
+	}
+	if result.RowsAffected == 0 || time.Now().After(loginState.ExpiresAt) {
+		utils.ErrorResponse(c, 400, "INVALID_STATE", "登入逾時或已失效，請重新登入", nil)
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.Config.Name, err)
+		utils.UnauthorizedResponse(c, "第三方登入驗證失敗")
+		return
+	}
+
+	user, err := loginWithIdentity(provider.Config, claims)
+	if err != nil {
+		switch err {
+		case ErrOIDCNoEmail:
+			utils.ErrorResponse(c, 400, "EMAIL_REQUIRED", "登入服務未提供 Email，請允許存取 Email", nil)
+		case ErrOIDCDomainNotAllowed:
+			utils.ForbiddenResponse(c, "此登入方式不支援您的 Email 網域")
+		case ErrOIDCEmailInUse:
+			utils.ConflictResponse(c, "此 Email 已註冊，請先以密碼登入")
+		default:
+			utils.InternalErrorResponse(c, "登入失敗")
+		}
+		return
+	}
+
+	// Load school relation
+	database.DB.Preload("School").First(user, user.ID)
+
+	// Generate tokens
+	token, refreshToken, err := startSession(c, user, req.DeviceName)
+	if err != nil {
+		utils.InternalErrorResponse(c, "Token 生成失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, AuthResponse{
+		User:         user,
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, "登入成功")
+}
+
+// emailDomain returns the lowercased domain part of an email address
+func emailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+// loginWithIdentity finds or creates the user for a verified ID token
+func loginWithIdentity(provider config.OIDCProviderConfig, claims *oidc.Claims) (*models.User, error) {
+	email := strings.TrimSpace(claims.Email)
+	if !strings.Contains(email, "@") {
+		return nil, ErrOIDCNoEmail
+	}
+
+	if len(provider.AllowedDomains) > 0 {
+		allowed := false
+		for _, domain := range provider.AllowedDomains {
+			if claims.EmailVerified && emailDomain(email) == strings.ToLower(domain) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrOIDCDomainNotAllowed
+		}
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Returning user
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider.Name, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Model(&identity).Updates(map[string]interface{}{
+				"email":         email,
+				"last_login_at": now,
+			}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			if claims.EmailVerified && strings.EqualFold(user.Email, email) {
+				return markEmailVerified(tx, &user)
+			}
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		identity = models.UserIdentity{
+			Provider:    provider.Name,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}
+
+		// Link to an existing account, but only if the provider vouches for
+		// the email; otherwise anyone could take over an account
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+		if err == nil {
+			if !claims.EmailVerified {
+				return ErrOIDCEmailInUse
+			}
+			// Anyone can register an unverified account for an address they
+			// don't own. The provider proves the SSO user owns it, so the
+			// password set by whoever registered is dropped and everything
+			// issued under it is revoked.
+			if !user.IsEmailVerified() {
+				if err := resetCredentials(tx, &user, ""); err != nil {
+					return err
+				}
+			}
+			identity.UserID = user.ID
+			if err := tx.Create(&identity).Error; err != nil {
+				return err
+			}
+			return markEmailVerified(tx, &user)
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		// New account. SSO users have no password until they reset it.
+		user = models.User{
+			Email: email,
+			Name:  claims.Name,
+		}
+		if user.Name == "" {
+			user.Name = email[:strings.LastIndex(email, "@")]
+		}
+		if provider.AssignSchool && claims.EmailVerified {
+			if school, err := findSchoolByEmail(tx, email); err == nil {
+				user.SchoolID = &school.ID
+			} else if err != gorm.ErrRecordNotFound {
+				return err
+			}
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+
+		if claims.EmailVerified {
+			return markEmailVerified(tx, &user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CleanupExpiredOIDCStates deletes logins that were never completed
+func CleanupExpiredOIDCStates() (int64, error) {
+	result := database.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+	return result.RowsAffected, result.Error
+}
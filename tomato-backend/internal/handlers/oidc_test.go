@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/oidc"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupOIDCTests(t *testing.T, allowedDomains ...string) (*gin.Engine, *testutil.OIDCStub, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Register the stub provider
+	stub := testutil.NewOIDCStub(t)
+	config.AppConfig.OIDC.Providers = []config.OIDCProviderConfig{{
+		Name:           "stub",
+		IssuerURL:      stub.Issuer(),
+		ClientID:       stub.ClientID,
+		ClientSecret:   stub.ClientSecret,
+		RedirectURL:    "http://localhost:3000/auth/callback/stub",
+		Scopes:         []string{"openid", "email", "profile"},
+		AllowedDomains: allowedDomains,
+		AssignSchool:   true,
+	}}
+	oidc.Init(config.AppConfig.OIDC)
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/auth/oidc/providers", ListOIDCProviders)
+	router.GET("/auth/oidc/:provider/login", StartOIDCLogin)
+	router.POST("/auth/oidc/:provider/callback", OIDCCallback)
+
+	// Cleanup function
+	cleanup := func() {
+		oidc.Init(config.OIDCConfig{})
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, stub, cleanup
+}
+
+// oidcLogin runs the full login flow as identity and returns the callback
+// response along with the state that was redeemed
+func oidcLogin(t *testing.T, router *gin.Engine, stub *testutil.OIDCStub, identity testutil.OIDCIdentity) (*httptest.ResponseRecorder, string) {
+	w := testutil.MakeRequest(t, router, "GET", "/auth/oidc/stub/login", nil, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	authorizationURL := response.Data.(map[string]interface{})["authorization_url"].(string)
+
+	stub.Identity = identity
+	code, state := stub.Authorize(t, authorizationURL)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/oidc/stub/callback", map[string]interface{}{
+		"code":  code,
+		"state": state,
+	}, nil)
+	return w, state
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	router, stub, cleanup := setupOIDCTests(t)
+	defer cleanup()
+
+	school := testutil.CreateTestSchool(database.DB, "台灣大學")
+	if _, err := AddSchoolDomain(database.DB, school.ID, "ntu.edu.tw"); err != nil {
+		t.Fatalf("AddSchoolDomain failed: %v", err)
+	}
+
+	identity := testutil.OIDCIdentity{
+		Subject:       "google-123",
+		Email:         "b12345678@g.ntu.edu.tw",
+		EmailVerified: true,
+		Name:          "王小明",
+	}
+
+	w, state := oidcLogin(t, router, stub, identity)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var user models.User
+	if err := database.DB.Where("email = ?", identity.Email).First(&user).Error; err != nil {
+		t.Fatalf("Expected user to be created: %v", err)
+	}
+	if user.SchoolID == nil || *user.SchoolID != school.ID {
+		t.Error("Expected school to be assigned from email domain")
+	}
+	if !user.IsEmailVerified() {
+		t.Error("Expected email verified by the provider to be marked verified")
+	}
+
+	var schoolAfter models.School
+	database.DB.First(&schoolAfter, school.ID)
+	if schoolAfter.StudentCount != 1 {
+		t.Errorf("Expected student count 1, got %d", schoolAfter.StudentCount)
+	}
+
+	// States are single-use
+	w = testutil.MakeRequest(t, router, "POST", "/auth/oidc/stub/callback", map[string]interface{}{
+		"code":  "reused",
+		"state": state,
+	}, nil)
+	testutil.AssertStatusCode(t, w, 400)
+	testutil.AssertError(t, w, "INVALID_STATE")
+
+	// Signing in again uses the same account
+	w, _ = oidcLogin(t, router, stub, identity)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("email = ?", identity.Email).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 user, got %d", count)
+	}
+	database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 linked identity, got %d", count)
+	}
+}
+
+func TestOIDCLoginLinksExistingUser(t *testing.T) {
+	router, stub, cleanup := setupOIDCTests(t)
+	defer cleanup()
+
+	school := testutil.CreateTestSchool(database.DB, "測試大學")
+	user := testutil.CreateTestUser(database.DB, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// An unverified email must not take over the existing account
+	w, _ := oidcLogin(t, router, stub, testutil.OIDCIdentity{
+		Subject: "attacker",
+		Email:   user.Email,
+	})
+	testutil.AssertStatusCode(t, w, 409)
+
+	w, _ = oidcLogin(t, router, stub, testutil.OIDCIdentity{
+		Subject:       "google-456",
+		Email:         user.Email,
+		EmailVerified: true,
+	})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var identity models.UserIdentity
+	if err := database.DB.Where("provider = ? AND subject = ?", "stub", "google-456").First(&identity).Error; err != nil {
+		t.Fatalf("Expected identity to be linked: %v", err)
+	}
+	if identity.UserID != user.ID {
+		t.Errorf("Expected identity linked to %s, got %s", user.ID, identity.UserID)
+	}
+}
+
+func TestOIDCLinkDropsUnverifiedCredentials(t *testing.T) {
+	router, stub, cleanup := setupOIDCTests(t)
+	defer cleanup()
+
+	// Someone registered the address without owning it
+	squatter := testutil.CreateTestUser(database.DB, "victim@example.com", "password123", "搶註者", nil)
+	database.DB.Model(squatter).Update("email_verified_at", nil)
+	squatterToken, _, _ := utils.GenerateSessionTokens(squatter, uuid.Nil)
+	database.DB.Create(&models.AuthSession{
+		UserID:           squatter.ID,
+		RefreshTokenHash: utils.HashToken("refresh"),
+		LastSeenAt:       time.Now(),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	})
+	database.DB.Create(&models.PersonalAccessToken{
+		UserID:      squatter.ID,
+		Name:        "script",
+		TokenHash:   utils.HashToken("pat"),
+		TokenPrefix: "tmt_pat",
+		Scopes:      []string{"read"},
+	})
+
+	// The owner signs in with a provider that vouches for the address
+	w, _ := oidcLogin(t, router, stub, testutil.OIDCIdentity{
+		Subject:       "google-789",
+		Email:         squatter.Email,
+		EmailVerified: true,
+	})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var user models.User
+	database.DB.First(&user, squatter.ID)
+	if user.PasswordHash != "" {
+		t.Error("Expected the squatter's password to be dropped")
+	}
+	if user.TokenVersion <= squatter.TokenVersion {
+		t.Error("Expected tokens issued to the squatter to be revoked")
+	}
+	if !user.IsEmailVerified() {
+		t.Error("Expected the email to be verified by the provider")
+	}
+
+	var count int64
+	database.DB.Model(&models.AuthSession{}).Where("user_id = ? AND revoked_at IS NULL", squatter.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected only the new SSO session to remain, got %d", count)
+	}
+	database.DB.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", squatter.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected personal access tokens to be revoked, got %d", count)
+	}
+
+	router.GET("/users/me", middleware.AuthMiddleware(), GetMe)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", squatterToken, nil)
+	testutil.AssertStatusCode(t, w, 401)
+}
+
+func TestOIDCAllowedDomains(t *testing.T) {
+	router, stub, cleanup := setupOIDCTests(t, "ntu.edu.tw")
+	defer cleanup()
+
+	w, _ := oidcLogin(t, router, stub, testutil.OIDCIdentity{
+		Subject:       "google-789",
+		Email:         "someone@gmail.com",
+		EmailVerified: true,
+	})
+	testutil.AssertStatusCode(t, w, 403)
+
+	var count int64
+	database.DB.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no user to be created, got %d", count)
+	}
+}
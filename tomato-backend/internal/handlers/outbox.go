@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// domainEvents delivers the events handlers write to the outbox to the
+// subsystems that react to them
+var domainEvents = newDomainEvents()
+
+func newDomainEvents() *outbox.Dispatcher {
+	d := outbox.NewDispatcher()
+
+	outbox.Subscribe(d, "achievements", func(tx *gorm.DB, _ outbox.Meta, e outbox.SessionCreated) error {
+		return awardAchievements(tx, e.UserID, TriggerSessionCreated)
+	})
+	outbox.Subscribe(d, "achievements", func(tx *gorm.DB, _ outbox.Meta, e outbox.PlanCompleted) error {
+		return awardAchievements(tx, e.UserID, TriggerPlanCompleted)
+	})
+	outbox.Subscribe(d, "achievements", func(tx *gorm.DB, _ outbox.Meta, e outbox.TodoCompleted) error {
+		return awardAchievements(tx, e.UserID, TriggerTodoCompleted)
+	})
+
+	outbox.Subscribe(d, "webhooks", func(tx *gorm.DB, m outbox.Meta, e outbox.SessionCreated) error {
+		return enqueueWebhookDeliveries(tx, m, e.UserID, e)
+	})
+	outbox.Subscribe(d, "webhooks", func(tx *gorm.DB, m outbox.Meta, e outbox.PlanCompleted) error {
+		return enqueueWebhookDeliveries(tx, m, e.UserID, e)
+	})
+	outbox.Subscribe(d, "webhooks", func(tx *gorm.DB, m outbox.Meta, e outbox.TodoCompleted) error {
+		return enqueueWebhookDeliveries(tx, m, e.UserID, e)
+	})
+
+	return d
+}
+
+// StartOutbox starts delivering domain events with the configured settings
+func StartOutbox() (stop func()) {
+	cfg := config.AppConfig.Outbox
+	if cfg.PollInterval > 0 {
+		domainEvents.PollInterval = cfg.PollInterval
+	}
+	if cfg.MaxAttempts > 0 {
+		domainEvents.MaxAttempts = cfg.MaxAttempts
+	}
+	return domainEvents.Start()
+}
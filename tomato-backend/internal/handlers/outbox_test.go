@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/outbox"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+)
+
+// deliverDomainEvents runs one round of the outbox dispatcher, as its
+// goroutine would after the request
+func deliverDomainEvents(t *testing.T) {
+	if _, err := domainEvents.ProcessPending(); err != nil {
+		t.Fatalf("Failed to deliver domain events: %v", err)
+	}
+}
+
+func outboxEvents(t *testing.T, eventType string) []models.OutboxEvent {
+	var events []models.OutboxEvent
+	if err := database.DB.Where("type = ?", eventType).Order("created_at").Find(&events).Error; err != nil {
+		t.Fatalf("Failed to load outbox events: %v", err)
+	}
+	return events
+}
+
+func TestSessionWritesDomainEvents(t *testing.T) {
+	router, user, token, cleanup := setupAchievementTests(t)
+	defer cleanup()
+
+	plan := testutil.CreateTestStudyPlan(database.DB, user.ID, nil, "讀書", 50)
+	today := time.Now().Format("2006-01-02")
+
+	for i := 0; i < 3; i++ {
+		w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+			"date": today, "minutes": 25, "plan_id": plan.ID.String(),
+		})
+		testutil.AssertStatusCode(t, w, 201)
+	}
+
+	sessions := outboxEvents(t, outbox.TypeSessionCreated)
+	if len(sessions) != 3 {
+		t.Fatalf("Expected 3 session events, got %d", len(sessions))
+	}
+	var created outbox.SessionCreated
+	json.Unmarshal(sessions[0].Payload, &created)
+	if created.UserID != user.ID || created.Minutes != 25 || created.PlanID == nil || *created.PlanID != plan.ID {
+		t.Errorf("Expected the session in the payload, got %+v", created)
+	}
+
+	// The plan reached its target with the second session only
+	completed := outboxEvents(t, outbox.TypePlanCompleted)
+	if len(completed) != 1 {
+		t.Fatalf("Expected one plan completion, got %d", len(completed))
+	}
+
+	deliverDomainEvents(t)
+	if !earnedAchievements(t, user.ID)["first_focus"] {
+		t.Error("Expected first_focus to be awarded through the outbox")
+	}
+
+	var pending int64
+	database.DB.Model(&models.OutboxEvent{}).Where("processed_at IS NULL").Count(&pending)
+	if pending != 0 {
+		t.Errorf("Expected every event delivered, got %d pending", pending)
+	}
+}
+
+func TestPlanCompletedOnlyOnTransition(t *testing.T) {
+	router, user, token, cleanup := setupAchievementTests(t)
+	defer cleanup()
+
+	plan := testutil.CreateTestStudyPlan(database.DB, user.ID, nil, "計畫", 0)
+	for _, completed := range []bool{true, true, false, true} {
+		w := testutil.MakeAuthenticatedRequest(t, router, "PATCH", "/plans/"+plan.ID.String()+"/complete", token, map[string]interface{}{"completed": completed})
+		testutil.AssertStatusCode(t, w, 200)
+	}
+
+	if events := outboxEvents(t, outbox.TypePlanCompleted); len(events) != 2 {
+		t.Errorf("Expected 2 completions, got %d", len(events))
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/mailer"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// setPassword stores a new password for the user and bumps their token
+// version, which revokes every access and refresh token issued so far, and
+// signs out every login session. Personal access tokens, unused reset links
+// and stream tickets are invalidated too. Must be called inside a transaction.
+func setPassword(tx *gorm.DB, user *models.User, newPassword string) error {
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return resetCredentials(tx, user, hashedPassword)
+}
+
+// resetCredentials replaces the user's password hash, which may be empty to
+// leave them without a password, and revokes everything that was issued
+// under the old one. Must be called inside a transaction.
+func resetCredentials(tx *gorm.DB, user *models.User, hashedPassword string) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "token_version").
+		First(user, user.ID).Error; err != nil {
+		return err
+	}
+
+	user.PasswordHash = hashedPassword
+	user.TokenVersion++
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password_hash": user.PasswordHash,
+		"token_version": user.TokenVersion,
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := revokeUserSessions(tx, user.ID); err != nil {
+		return err
+	}
+
+	if err := revokeAccessTokens(tx, user.ID); err != nil {
+		return err
+	}
+
+	return tx.Where("user_id = ? AND purpose IN ? AND used_at IS NULL", user.ID,
+		[]models.TokenPurpose{models.TokenPurposePasswordReset, models.TokenPurposeStreamTicket}).
+		Delete(&models.UserToken{}).Error
+}
+
+// sendPasswordResetEmail sends the password reset link for token to user
+func sendPasswordResetEmail(user *models.User, token string) error {
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppConfig.Account.FrontendURL, token)
+
+	return mailer.Default.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "重設您的密碼",
+		Body: fmt.Sprintf("%s 您好：\n\n請點擊以下連結重設密碼：\n%s\n\n連結將於 %s 後失效且只能使用一次。若您沒有申請重設密碼，請忽略此信。\n",
+			user.Name, link, config.AppConfig.Account.PasswordResetTTL),
+	})
+}
+
+// sendPasswordChangedEmail lets the user know their password was changed
+func sendPasswordChangedEmail(user *models.User) error {
+	return mailer.Default.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "您的密碼已變更",
+		Body: fmt.Sprintf("%s 您好：\n\n您的帳號密碼剛剛已變更，所有裝置皆已登出。若這不是您本人的操作，請立即重設密碼。\n",
+			user.Name),
+	})
+}
+
+// ForgotPassword emails a single-use password reset link. The response is the
+// same whether or not the email is registered, so it can't be used to probe
+// for accounts.
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	const message = "若此 Email 已註冊，重設密碼信將寄至您的信箱"
+
+	var user models.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.SuccessResponse(c, 200, nil, message)
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	// Silently drop repeated requests so the mailbox can't be flooded
+	if recentlyIssued(user.ID, models.TokenPurposePasswordReset) {
+		utils.SuccessResponse(c, 200, nil, message)
+		return
+	}
+
+	token, err := issueUserToken(database.DB, user.ID, models.TokenPurposePasswordReset, config.AppConfig.Account.PasswordResetTTL)
+	if err != nil {
+		utils.InternalErrorResponse(c, "重設密碼信產生失敗")
+		return
+	}
+
+	if err := sendPasswordResetEmail(&user, token); err != nil {
+		log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+	}
+
+	utils.SuccessResponse(c, 200, nil, message)
+}
+
+// ResetPassword sets a new password using the token from the reset email and
+// signs the user out everywhere
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, req.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		user.ID = userToken.UserID
+		return setPassword(tx, &user, req.NewPassword)
+	})
+	if err != nil {
+		if err == ErrInvalidToken {
+			utils.ErrorResponse(c, 400, "INVALID_TOKEN", "重設連結無效或已過期", nil)
+			return
+		}
+		utils.InternalErrorResponse(c, "密碼重設失敗")
+		return
+	}
+
+	database.DB.First(&user, user.ID)
+	if err := sendPasswordChangedEmail(&user); err != nil {
+		log.Printf("Failed to send password changed email to %s: %v", user.Email, err)
+	}
+
+	utils.SuccessResponse(c, 200, nil, "密碼已重設，請重新登入")
+}
+
+// ChangePassword changes the authenticated user's password after checking the
+// old one. Every existing token is revoked; fresh tokens are returned so the
+// current client stays signed in.
+func ChangePassword(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	if !utils.CheckPassword(req.OldPassword, user.PasswordHash) {
+		utils.ErrorResponse(c, 400, "INVALID_PASSWORD", "舊密碼錯誤", nil)
+		return
+	}
+	if req.NewPassword == req.OldPassword {
+		utils.ValidationErrorResponse(c, "新密碼不可與舊密碼相同")
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return setPassword(tx, &user, req.NewPassword)
+	}); err != nil {
+		utils.InternalErrorResponse(c, "密碼變更失敗")
+		return
+	}
+
+	database.DB.First(&user, user.ID)
+	if err := sendPasswordChangedEmail(&user); err != nil {
+		log.Printf("Failed to send password changed email to %s: %v", user.Email, err)
+	}
+
+	// The current device stays signed in under a new session with the same name
+	var current models.AuthSession
+	if sessionID, ok := middleware.GetSessionID(c); ok {
+		database.DB.Select("device_name").Where("id = ?", sessionID).First(&current)
+	}
+
+	token, refreshToken, err := startSession(c, &user, current.DeviceName)
+	if err != nil {
+		utils.InternalErrorResponse(c, "Token 生成失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+	}, "密碼已變更")
+}
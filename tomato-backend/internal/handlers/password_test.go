@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupPasswordTests(t *testing.T) (*gin.Engine, *recordingMailer, *models.User, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/auth/login", Login)
+	router.POST("/auth/refresh", RefreshToken)
+	router.POST("/auth/password/forgot", ForgotPassword)
+	router.POST("/auth/password/reset", ResetPassword)
+	router.GET("/users/me", middleware.AuthMiddleware(), GetMe)
+	router.PUT("/users/me/password", middleware.AuthMiddleware(), ChangePassword)
+
+	mail := captureMail(t)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, mail, user, cleanup
+}
+
+func TestResetPassword(t *testing.T) {
+	router, mail, user, cleanup := setupPasswordTests(t)
+	defer cleanup()
+
+	token, refreshToken, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Unknown emails get the same response but no mail
+	w := testutil.MakeRequest(t, router, "POST", "/auth/password/forgot", map[string]interface{}{"email": "nobody@example.com"}, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	if len(mail.messages) != 0 {
+		t.Fatalf("Expected no mail for unknown email, got %d", len(mail.messages))
+	}
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/password/forgot", map[string]interface{}{"email": user.Email}, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	resetToken := mail.lastToken(t, user.Email)
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "無效的 token",
+			requestBody:    map[string]interface{}{"token": "invalid", "new_password": "newpassword456"},
+			expectedStatus: 400,
+			expectedError:  "INVALID_TOKEN",
+		},
+		{
+			name:           "密碼太短",
+			requestBody:    map[string]interface{}{"token": resetToken, "new_password": "123"},
+			expectedStatus: 400,
+			expectedError:  "VALIDATION_ERROR",
+		},
+		{
+			name:           "成功重設密碼",
+			requestBody:    map[string]interface{}{"token": resetToken, "new_password": "newpassword456"},
+			expectedStatus: 200,
+		},
+		{
+			name:           "token 只能使用一次",
+			requestBody:    map[string]interface{}{"token": resetToken, "new_password": "anotherpassword789"},
+			expectedStatus: 400,
+			expectedError:  "INVALID_TOKEN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeRequest(t, router, "POST", "/auth/password/reset", tt.requestBody, nil)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedError != "" {
+				testutil.AssertError(t, w, tt.expectedError)
+			}
+		})
+	}
+
+	// Tokens issued before the reset are revoked
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", token, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/refresh", map[string]interface{}{"refresh_token": refreshToken}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/login", map[string]interface{}{"email": user.Email, "password": "password123"}, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/login", map[string]interface{}{"email": user.Email, "password": "newpassword456"}, nil)
+	testutil.AssertStatusCode(t, w, 200)
+}
+
+func TestChangePassword(t *testing.T) {
+	router, _, user, cleanup := setupPasswordTests(t)
+	defer cleanup()
+
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "舊密碼錯誤",
+			requestBody:    map[string]interface{}{"old_password": "wrongpassword", "new_password": "newpassword456"},
+			expectedStatus: 400,
+			expectedError:  "INVALID_PASSWORD",
+		},
+		{
+			name:           "新密碼與舊密碼相同",
+			requestBody:    map[string]interface{}{"old_password": "password123", "new_password": "password123"},
+			expectedStatus: 400,
+			expectedError:  "VALIDATION_ERROR",
+		},
+		{
+			name:           "成功變更密碼",
+			requestBody:    map[string]interface{}{"old_password": "password123", "new_password": "newpassword456"},
+			expectedStatus: 200,
+		},
+	}
+
+	var newToken string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "PUT", "/users/me/password", token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedError != "" {
+				testutil.AssertError(t, w, tt.expectedError)
+				return
+			}
+
+			var response utils.Response
+			testutil.ParseResponse(t, w, &response)
+			newToken, _ = response.Data.(map[string]interface{})["token"].(string)
+		})
+	}
+
+	// The old token is revoked, the one returned by the change keeps working
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", token, nil)
+	testutil.AssertStatusCode(t, w, 401)
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", newToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+}
+
+func TestChangePasswordNotStoredForIdempotency(t *testing.T) {
+	router, _, user, cleanup := setupPasswordTests(t)
+	defer cleanup()
+
+	router.PUT("/idempotent/password", middleware.AuthMiddleware(), middleware.Idempotency(), middleware.WithholdIdempotentResponse(), ChangePassword)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		"Idempotency-Key": "change-password",
+	}
+
+	w := testutil.MakeRequest(t, router, "PUT", "/idempotent/password", map[string]interface{}{
+		"old_password": "password123", "new_password": "newpassword456",
+	}, headers)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var record models.IdempotencyKey
+	if err := database.DB.Where("user_id = ? AND key = ?", user.ID, "change-password").First(&record).Error; err != nil {
+		t.Fatalf("Expected the key to be claimed: %v", err)
+	}
+	if !record.ResponseWithheld || len(record.ResponseBody) != 0 {
+		t.Errorf("Expected the response with the new tokens to be withheld, got %+v", record)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/outbox"
 	"github.com/yourusername/tomato-backend/internal/utils"
 	"gorm.io/gorm"
 )
@@ -124,6 +125,7 @@ func CreatePlan(c *gin.Context) {
 
 	// Load course relation
 	database.DB.Preload("Course").First(&plan, plan.ID)
+	publishUserEvent(userID, EventPlanCreated, plan)
 
 	utils.SuccessResponse(c, 201, plan, "計畫新增成功")
 }
@@ -233,11 +235,12 @@ func UpdatePlan(c *gin.Context) {
 
 	// Load course relation
 	database.DB.Preload("Course").First(&plan, plan.ID)
+	publishUserEvent(userID, EventPlanUpdated, plan)
 
 	utils.SuccessResponse(c, 200, plan, "計畫更新成功")
 }
 
-// DeletePlan deletes a study plan
+// DeletePlan moves a study plan to the trash
 func DeletePlan(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -265,8 +268,9 @@ func DeletePlan(c *gin.Context) {
 		utils.InternalErrorResponse(c, "計畫刪除失敗")
 		return
 	}
+	publishUserEvent(userID, EventPlanDeleted, gin.H{"id": plan.ID})
 
-	utils.SuccessResponse(c, 200, nil, "計畫刪除成功")
+	utils.SuccessResponse(c, 200, nil, "計畫已移至垃圾桶")
 }
 
 // TogglePlanComplete toggles plan completion status
@@ -299,14 +303,25 @@ func TogglePlanComplete(c *gin.Context) {
 		return
 	}
 
-	plan.Completed = req.Completed
+	wasCompleted := plan.Completed
+	plan.SetCompleted(req.Completed)
 
-	if err := database.DB.Save(&plan).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&plan).Error; err != nil {
+			return err
+		}
+		if plan.Completed && !wasCompleted {
+			return outbox.Publish(tx, outbox.PlanCompleted{PlanID: plan.ID, UserID: userID, CompletedAt: *plan.CompletedAt})
+		}
+		return nil
+	})
+	if err != nil {
 		utils.InternalErrorResponse(c, "更新計畫狀態失敗")
 		return
 	}
 
 	database.DB.Preload("Course").First(&plan, plan.ID)
+	publishUserEvent(userID, EventPlanUpdated, plan)
 
 	utils.SuccessResponse(c, 200, plan, "計畫狀態已更新")
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
@@ -25,10 +26,10 @@ func setupPlanTests(t *testing.T) (*gin.Engine, *models.User, *models.Course, st
 	// Create test user and course
 	school := testutil.CreateTestSchool(db, "測試大學")
 	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
-	course := testutil.CreateTestCourse(db, user.ID, "數學", "#3b82f6", 3)
+	course := testutil.CreateTestCourse(db, user.ID, "數學", "#3b82f6")
 
 	// Generate token
-	token, _ := utils.GenerateToken(user.ID.String(), user.Email)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
 
 	// Cleanup function
 	cleanup := func() {
@@ -104,7 +105,7 @@ func TestGetPlans(t *testing.T) {
 }
 
 func TestCreatePlan(t *testing.T) {
-	router, user, course, token, cleanup := setupPlanTests(t)
+	router, _, course, token, cleanup := setupPlanTests(t)
 	defer cleanup()
 
 	router.POST("/plans", middleware.AuthMiddleware(), CreatePlan)
@@ -513,7 +514,7 @@ func TestTogglePlanComplete(t *testing.T) {
 }
 
 func TestPlanCRUDFlow(t *testing.T) {
-	router, user, course, token, cleanup := setupPlanTests(t)
+	router, _, course, token, cleanup := setupPlanTests(t)
 	defer cleanup()
 
 	// Setup routes
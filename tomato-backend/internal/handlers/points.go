@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNegativePoints    = errors.New("points cannot go below zero")
+	ErrAlreadyReversed   = errors.New("point transaction already reversed")
+	ErrReverseOfReversal = errors.New("cannot reverse a reversal")
+)
+
+// PointDrift describes a user whose stored total_points differs from the sum
+// of their ledger entries
+type PointDrift struct {
+	UserID            uuid.UUID `json:"user_id"`
+	Email             string    `json:"email"`
+	StoredTotalPoints int       `json:"stored_total_points"`
+	LedgerTotalPoints int       `json:"ledger_total_points"`
+}
+
+// recordPoints appends a ledger entry and applies its delta to the user and,
+// once their email is verified and unless they are banned from the
+// leaderboards, their current school. Every change to
+// total_points must go through here. Must be called inside a transaction.
+func recordPoints(tx *gorm.DB, userID uuid.UUID, delta int, source models.PointSource, referenceID *uuid.UUID, reason string) (*models.PointTransaction, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "school_id", "total_points", "email_verified_at", "leaderboard_banned").
+		First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if user.TotalPoints+delta < 0 {
+		return nil, ErrNegativePoints
+	}
+
+	entry := &models.PointTransaction{
+		UserID:      userID,
+		SchoolID:    user.SchoolID,
+		Delta:       delta,
+		Source:      source,
+		ReferenceID: referenceID,
+		Reason:      reason,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("total_points", gorm.Expr("total_points + ?", delta)).Error; err != nil {
+		return nil, err
+	}
+
+	if user.IsEmailVerified() && !user.LeaderboardBanned {
+		if err := adjustSchoolMembership(tx, user.SchoolID, 0, delta); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// reversePoints appends an entry cancelling out the given transaction.
+// Must be called inside a transaction.
+func reversePoints(tx *gorm.DB, transactionID uuid.UUID, reason string) (*models.PointTransaction, error) {
+	var original models.PointTransaction
+	if err := tx.First(&original, transactionID).Error; err != nil {
+		return nil, err
+	}
+	if original.Source == models.PointSourceReversal {
+		return nil, ErrReverseOfReversal
+	}
+
+	var count int64
+	if err := tx.Model(&models.PointTransaction{}).
+		Where("source = ? AND reference_id = ?", models.PointSourceReversal, original.ID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyReversed
+	}
+
+	return recordPoints(tx, original.UserID, -original.Delta, models.PointSourceReversal, &original.ID, reason)
+}
+
+// GetMyPointHistory lists the authenticated user's ledger entries, newest first
+func GetMyPointHistory(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	// Pagination
+	limit := 50
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := utils.ParseInt(o); err == nil && val >= 0 {
+			offset = val
+		}
+	}
+
+	query := database.DB.Model(&models.PointTransaction{}).Where("user_id = ?", userID)
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	// Get total count
+	var total int64
+	query.Count(&total)
+
+	var transactions []models.PointTransaction
+	if err := query.Order("created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&transactions).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢積分紀錄失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"transactions": transactions,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	}, "")
+}
+
+// BackfillPointLedger creates ledger entries for focus sessions and admin
+// adjustments recorded before the ledger existed. Safe to run repeatedly.
+func BackfillPointLedger() (int64, error) {
+	var created int64
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`
+			INSERT INTO point_transactions (id, user_id, school_id, delta, source, reference_id, reason, created_at)
+			SELECT gen_random_uuid(), fs.user_id, u.school_id, fs.points_earned, ?, fs.id, '', fs.created_at
+			FROM focus_sessions fs
+			JOIN users u ON u.id = fs.user_id
+			WHERE fs.points_earned <> 0
+				AND NOT EXISTS (
+					SELECT 1 FROM point_transactions pt
+					WHERE pt.source = ? AND pt.reference_id = fs.id
+				)`, models.PointSourceSession, models.PointSourceSession)
+		if result.Error != nil {
+			return result.Error
+		}
+		created += result.RowsAffected
+
+		result = tx.Exec(`
+			INSERT INTO point_transactions (id, user_id, school_id, delta, source, reference_id, reason, created_at)
+			SELECT gen_random_uuid(), u.id, u.school_id, (al.details->>'delta')::int, ?, al.id, al.reason, al.created_at
+			FROM admin_audit_logs al
+			JOIN users u ON u.id = al.target_id
+			WHERE al.action = ? AND al.target_type = ?
+				AND NOT EXISTS (
+					SELECT 1 FROM point_transactions pt
+					WHERE pt.source = ? AND pt.reference_id = al.id
+				)`, models.PointSourceAdminAdjustment, AuditActionAdjustPoints, auditTargetUser, models.PointSourceAdminAdjustment)
+		if result.Error != nil {
+			return result.Error
+		}
+		created += result.RowsAffected
+
+		return nil
+	})
+
+	return created, err
+}
+
+// ReconcilePointLedger compares every user's total_points with the sum of
+// their ledger entries and returns the users that drifted. Unless dryRun is
+// set, total_points is reset to the ledger sum.
+func ReconcilePointLedger(dryRun bool) ([]PointDrift, error) {
+	var drifts []PointDrift
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var rows []PointDrift
+		if err := tx.Raw(`
+			SELECT
+				u.id AS user_id,
+				u.email AS email,
+				u.total_points AS stored_total_points,
+				(SELECT COALESCE(SUM(pt.delta), 0)
+					FROM point_transactions pt
+					WHERE pt.user_id = u.id) AS ledger_total_points
+			FROM users u
+			ORDER BY u.email
+			FOR UPDATE OF u`).Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if row.StoredTotalPoints == row.LedgerTotalPoints {
+				continue
+			}
+			drifts = append(drifts, row)
+
+			if dryRun {
+				continue
+			}
+			if err := tx.Model(&models.User{}).
+				Where("id = ?", row.UserID).
+				UpdateColumn("total_points", row.LedgerTotalPoints).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return drifts, err
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupPointTests(t *testing.T) (*gin.Engine, *models.School, *models.User, string, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
+	router.GET("/users/me/points", middleware.AuthMiddleware(), GetMyPointHistory)
+	router.POST("/admin/point-transactions/:id/reverse",
+		middleware.AuthMiddleware(), middleware.RequireRole(models.RoleAdmin), AdminReversePoints)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	adminUser := testutil.CreateTestUser(db, "admin@example.com", "password123", "管理員", nil)
+	db.Model(adminUser).Update("role", models.RoleAdmin)
+
+	// Generate tokens
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+	adminToken, _, _ := utils.GenerateSessionTokens(adminUser, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, school, user, token, adminToken, cleanup
+}
+
+func TestCreateSessionRecordsLedgerEntry(t *testing.T) {
+	router, school, user, token, _, cleanup := setupPointTests(t)
+	defer cleanup()
+
+	requestBody := map[string]interface{}{
+		"date":    time.Now().Format("2006-01-02"),
+		"minutes": 25,
+	}
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, requestBody)
+	testutil.AssertStatusCode(t, w, 201)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	sessionID := response.Data.(map[string]interface{})["id"].(string)
+	pointsEarned := int(response.Data.(map[string]interface{})["points_earned"].(float64))
+
+	var entries []models.PointTransaction
+	database.DB.Where("user_id = ?", user.ID).Find(&entries)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 ledger entry, got %d", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Source != models.PointSourceSession {
+		t.Errorf("Expected source session, got %s", entry.Source)
+	}
+	if entry.ReferenceID == nil || entry.ReferenceID.String() != sessionID {
+		t.Errorf("Expected reference to session %s, got %v", sessionID, entry.ReferenceID)
+	}
+	if entry.SchoolID == nil || *entry.SchoolID != school.ID {
+		t.Error("Expected ledger entry to record the user's school")
+	}
+	if entry.Delta != pointsEarned {
+		t.Errorf("Expected delta %d, got %d", pointsEarned, entry.Delta)
+	}
+
+	var userAfter models.User
+	database.DB.First(&userAfter, user.ID)
+	if userAfter.TotalPoints != pointsEarned {
+		t.Errorf("Expected total points %d, got %d", pointsEarned, userAfter.TotalPoints)
+	}
+
+	// Ledger entries can't be edited
+	if err := database.DB.Model(&entry).Update("delta", 1000).Error; err != models.ErrLedgerImmutable {
+		t.Errorf("Expected ErrLedgerImmutable, got %v", err)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me/points", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.ParseResponse(t, w, &response)
+	if total := response.Data.(map[string]interface{})["total"]; total != float64(1) {
+		t.Errorf("Expected 1 transaction in history, got %v", total)
+	}
+}
+
+func TestAdminReversePoints(t *testing.T) {
+	router, school, user, token, adminToken, cleanup := setupPointTests(t)
+	defer cleanup()
+
+	requestBody := map[string]interface{}{
+		"date":    time.Now().Format("2006-01-02"),
+		"minutes": 25,
+	}
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, requestBody)
+	testutil.AssertStatusCode(t, w, 201)
+
+	var entry models.PointTransaction
+	database.DB.Where("user_id = ?", user.ID).First(&entry)
+	path := fmt.Sprintf("/admin/point-transactions/%s/reverse", entry.ID)
+
+	tests := []struct {
+		name           string
+		token          string
+		requestBody    interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "一般用戶無法沖銷",
+			token:          token,
+			requestBody:    map[string]interface{}{"reason": "測試"},
+			expectedStatus: 403,
+		},
+		{
+			name:           "缺少原因",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{},
+			expectedStatus: 400,
+		},
+		{
+			name:           "成功沖銷",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{"reason": "重複提交"},
+			expectedStatus: 201,
+		},
+		{
+			name:           "重複沖銷",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{"reason": "重複提交"},
+			expectedStatus: 409,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", path, tt.token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+		})
+	}
+
+	var userAfter models.User
+	database.DB.First(&userAfter, user.ID)
+	if userAfter.TotalPoints != 0 {
+		t.Errorf("Expected total points 0 after reversal, got %d", userAfter.TotalPoints)
+	}
+
+	var schoolAfter models.School
+	database.DB.First(&schoolAfter, school.ID)
+	if schoolAfter.TotalPoints != 0 {
+		t.Errorf("Expected school points 0 after reversal, got %d", schoolAfter.TotalPoints)
+	}
+}
+
+func TestReconcilePointLedger(t *testing.T) {
+	_, _, user, _, _, cleanup := setupPointTests(t)
+	defer cleanup()
+
+	// A session from before the ledger existed
+	session := testutil.CreateTestFocusSession(database.DB, user.ID, nil, nil, 25)
+	database.DB.Model(user).Update("total_points", session.PointsEarned+100)
+
+	drifts, err := ReconcilePointLedger(true)
+	if err != nil {
+		t.Fatalf("ReconcilePointLedger failed: %v", err)
+	}
+	if len(drifts) != 1 || drifts[0].LedgerTotalPoints != 0 {
+		t.Fatalf("Expected 1 drifted user with empty ledger, got %+v", drifts)
+	}
+
+	created, err := BackfillPointLedger()
+	if err != nil {
+		t.Fatalf("BackfillPointLedger failed: %v", err)
+	}
+	if created != 1 {
+		t.Errorf("Expected 1 backfilled entry, got %d", created)
+	}
+
+	// Backfill is idempotent
+	if created, _ := BackfillPointLedger(); created != 0 {
+		t.Errorf("Expected second backfill to create nothing, got %d", created)
+	}
+
+	drifts, err = ReconcilePointLedger(false)
+	if err != nil {
+		t.Fatalf("ReconcilePointLedger failed: %v", err)
+	}
+	if len(drifts) != 1 || drifts[0].LedgerTotalPoints != session.PointsEarned {
+		t.Fatalf("Expected user to be corrected to %d, got %+v", session.PointsEarned, drifts)
+	}
+
+	var userAfter models.User
+	database.DB.First(&userAfter, user.ID)
+	if userAfter.TotalPoints != session.PointsEarned {
+		t.Errorf("Expected total points %d, got %d", session.PointsEarned, userAfter.TotalPoints)
+	}
+
+	if drifts, _ := ReconcilePointLedger(true); len(drifts) != 0 {
+		t.Errorf("Expected no drift after reconciliation, got %d", len(drifts))
+	}
+}
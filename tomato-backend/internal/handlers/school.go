@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSchoolNameTaken = errors.New("school name or alias already in use")
+	ErrSameSchool      = errors.New("cannot merge a school into itself")
+	ErrInvalidDomain   = errors.New("invalid email domain")
+	ErrDomainTaken     = errors.New("email domain already belongs to a school")
+)
+
+// SchoolDrift describes a school whose stored aggregates differ from the
+// values recomputed from its verified users
+type SchoolDrift struct {
+	SchoolID           uuid.UUID `json:"school_id"`
+	SchoolName         string    `json:"school_name"`
+	StoredStudentCount int       `json:"stored_student_count"`
+	ActualStudentCount int       `json:"actual_student_count"`
+	StoredTotalPoints  int       `json:"stored_total_points"`
+	ActualTotalPoints  int       `json:"actual_total_points"`
+}
+
+// adjustSchoolMembership changes a school's student count and total points by
+// the given deltas. Must be called inside the transaction that changes the
+// user's membership.
+func adjustSchoolMembership(tx *gorm.DB, schoolID *uuid.UUID, students int, points int) error {
+	if schoolID == nil || (students == 0 && points == 0) {
+		return nil
+	}
+
+	return tx.Model(&models.School{}).
+		Where("id = ?", schoolID).
+		UpdateColumns(map[string]interface{}{
+			"student_count": gorm.Expr("GREATEST(student_count + ?, 0)", students),
+			"total_points":  gorm.Expr("GREATEST(total_points + ?, 0)", points),
+		}).Error
+}
+
+// schoolPoints returns the points a verified user adds to their school's
+// total. Users banned from the leaderboards still count as students but add
+// no points.
+func schoolPoints(user *models.User) int {
+	if user.LeaderboardBanned {
+		return 0
+	}
+	return user.TotalPoints
+}
+
+// ReconcileSchools recomputes student_count and total_points for every school
+// from its verified users and returns the schools that drifted. Unless dryRun is set,
+// drifted schools are corrected. Run ReconcilePointLedger first so that user
+// totals are correct.
+func ReconcileSchools(dryRun bool) ([]SchoolDrift, error) {
+	var drifts []SchoolDrift
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var rows []SchoolDrift
+		if err := tx.Raw(`
+			SELECT
+				s.id AS school_id,
+				s.name AS school_name,
+				s.student_count AS stored_student_count,
+				s.total_points AS stored_total_points,
+				(SELECT COUNT(*)
+					FROM users u
+					WHERE u.school_id = s.id AND u.email_verified_at IS NOT NULL) AS actual_student_count,
+				(SELECT COALESCE(SUM(u.total_points), 0)
+					FROM users u
+					WHERE u.school_id = s.id AND u.email_verified_at IS NOT NULL
+						AND NOT u.leaderboard_banned) AS actual_total_points
+			FROM schools s
+			ORDER BY s.name
+			FOR UPDATE OF s`).Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if row.StoredStudentCount == row.ActualStudentCount && row.StoredTotalPoints == row.ActualTotalPoints {
+				continue
+			}
+			drifts = append(drifts, row)
+
+			if dryRun {
+				continue
+			}
+			if err := tx.Model(&models.School{}).
+				Where("id = ?", row.SchoolID).
+				UpdateColumns(map[string]interface{}{
+					"student_count": row.ActualStudentCount,
+					"total_points":  row.ActualTotalPoints,
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return drifts, err
+}
+
+// normalizeSchoolName lowercases and collapses whitespace so that spelling
+// variants like "National  Taiwan university" match
+func normalizeSchoolName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// FindSchool looks up a school by ID, canonical name or alias
+func FindSchool(db *gorm.DB, ref string) (*models.School, error) {
+	var school models.School
+
+	if id, err := uuid.Parse(ref); err == nil {
+		if err := db.First(&school, id).Error; err != nil {
+			return nil, err
+		}
+		return &school, nil
+	}
+
+	normalized := normalizeSchoolName(ref)
+	err := db.Where("LOWER(name) = ?", normalized).
+		Or("id IN (?)", db.Model(&models.SchoolAlias{}).Select("school_id").Where("normalized_name = ?", normalized)).
+		First(&school).Error
+	if err != nil {
+		return nil, err
+	}
+	return &school, nil
+}
+
+// findOrCreateSchool resolves a school name through canonical names and
+// aliases, creating a new school only when nothing matches
+func findOrCreateSchool(tx *gorm.DB, name string) (*models.School, error) {
+	school, err := FindSchool(tx, name)
+	if err == nil {
+		return school, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	school = &models.School{Name: strings.Join(strings.Fields(name), " ")}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(school).Error; err != nil {
+		return nil, err
+	}
+	// Another request may have created it concurrently
+	if err := tx.Where("name = ?", school.Name).First(school).Error; err != nil {
+		return nil, err
+	}
+	return school, nil
+}
+
+// SearchSchools searches the school directory by name or alias for autocomplete
+func SearchSchools(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 50 {
+			limit = val
+		}
+	}
+
+	query := database.DB.Model(&models.School{})
+	if q != "" {
+		pattern := "%" + escapeLike(normalizeSchoolName(q)) + "%"
+		query = query.Where("LOWER(name) LIKE ?", pattern).
+			Or("id IN (?)", database.DB.Model(&models.SchoolAlias{}).Select("school_id").Where("normalized_name LIKE ?", pattern))
+	}
+
+	var schools []models.School
+	if err := query.Preload("Aliases").
+		Order("student_count DESC, name").
+		Limit(limit).
+		Find(&schools).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢學校失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, schools, "")
+}
+
+// AddSchoolAlias registers an alternative name for a school
+func AddSchoolAlias(db *gorm.DB, schoolID uuid.UUID, name string) (*models.SchoolAlias, error) {
+	alias := &models.SchoolAlias{
+		SchoolID:       schoolID,
+		Name:           strings.Join(strings.Fields(name), " "),
+		NormalizedName: normalizeSchoolName(name),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := FindSchool(tx, alias.Name); err == nil {
+			return ErrSchoolNameTaken
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if err := tx.First(&models.School{}, schoolID).Error; err != nil {
+			return err
+		}
+		return tx.Create(alias).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alias, nil
+}
+
+// normalizeDomain lowercases an email domain and strips a leading "@"
+func normalizeDomain(domain string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(domain)), "@.")
+}
+
+// AddSchoolDomain registers an email domain for a school. Subdomains match
+// too, so "ntu.edu.tw" also covers "g.ntu.edu.tw".
+func AddSchoolDomain(db *gorm.DB, schoolID uuid.UUID, domain string) (*models.SchoolDomain, error) {
+	domain = normalizeDomain(domain)
+	if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ /") {
+		return nil, ErrInvalidDomain
+	}
+
+	schoolDomain := &models.SchoolDomain{SchoolID: schoolID, Domain: domain}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.SchoolDomain{}).Where("domain = ?", domain).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDomainTaken
+		}
+
+		if err := tx.First(&models.School{}, schoolID).Error; err != nil {
+			return err
+		}
+		return tx.Create(schoolDomain).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schoolDomain, nil
+}
+
+// findSchoolByEmail returns the school owning the email's domain, preferring
+// the most specific registered domain
+func findSchoolByEmail(db *gorm.DB, email string) (*models.School, error) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	// g.ntu.edu.tw -> [g.ntu.edu.tw ntu.edu.tw edu.tw tw]
+	var candidates []string
+	for domain := normalizeDomain(email[at+1:]); domain != ""; {
+		candidates = append(candidates, domain)
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+
+	var schoolDomain models.SchoolDomain
+	if err := db.Where("domain IN ?", candidates).
+		Order("LENGTH(domain) DESC").
+		Preload("School").
+		First(&schoolDomain).Error; err != nil {
+		return nil, err
+	}
+	return schoolDomain.School, nil
+}
+
+// MergeSchools merges source into target: users, aliases and domains are re-pointed,
+// points and student counts are combined, and the source name becomes an
+// alias of the target. Ledger entries stay untouched; the points each user
+// earned at the source are moved over with a pair of compensating entries.
+func MergeSchools(db *gorm.DB, sourceID, targetID uuid.UUID) (*models.School, error) {
+	if sourceID == targetID {
+		return nil, ErrSameSchool
+	}
+
+	var target models.School
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var source models.School
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&source, sourceID).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&target, targetID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.User{}).
+			Where("school_id = ?", sourceID).
+			Update("school_id", targetID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.SchoolAlias{}).
+			Where("school_id = ?", sourceID).
+			Update("school_id", targetID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.SchoolDomain{}).
+			Where("school_id = ?", sourceID).
+			Update("school_id", targetID).Error; err != nil {
+			return err
+		}
+
+		// Each pair nets to zero for the user, so total_points is unchanged
+		reason := fmt.Sprintf("學校合併：%s 併入 %s", source.Name, target.Name)
+		if err := tx.Exec(`
+			INSERT INTO point_transactions (id, user_id, school_id, delta, source, reason, created_at)
+			SELECT gen_random_uuid(), moved.user_id, pair.school_id, moved.delta * pair.sign, ?, ?, ?
+			FROM (
+				SELECT user_id, SUM(delta) AS delta
+				FROM point_transactions
+				WHERE school_id = ?
+				GROUP BY user_id
+				HAVING SUM(delta) <> 0
+			) moved
+			CROSS JOIN (VALUES (?::uuid, -1), (?::uuid, 1)) AS pair(school_id, sign)`,
+			models.PointSourceSchoolMerge, reason, time.Now(), sourceID, sourceID, targetID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.SchoolAlias{
+			SchoolID:       targetID,
+			Name:           source.Name,
+			NormalizedName: normalizeSchoolName(source.Name),
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := adjustSchoolMembership(tx, &targetID, source.StudentCount, source.TotalPoints); err != nil {
+			return err
+		}
+
+		return tx.Delete(&source).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Preload("Aliases").First(&target, targetID).Error; err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// escapeLike escapes LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
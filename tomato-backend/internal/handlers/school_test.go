@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupSchoolTests(t *testing.T) (*gin.Engine, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/schools", SearchSchools)
+	router.POST("/auth/register", Register)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, cleanup
+}
+
+func TestSearchSchools(t *testing.T) {
+	router, cleanup := setupSchoolTests(t)
+	defer cleanup()
+
+	ntu := testutil.CreateTestSchool(database.DB, "國立臺灣大學")
+	testutil.CreateTestSchool(database.DB, "國立清華大學")
+	testutil.CreateTestSchool(database.DB, "National Chengchi University")
+	if _, err := AddSchoolAlias(database.DB, ntu.ID, "台大"); err != nil {
+		t.Fatalf("AddSchoolAlias failed: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedCount int
+	}{
+		{name: "依名稱搜尋", query: "?q=大學", expectedCount: 2},
+		{name: "依別名搜尋", query: "?q=台大", expectedCount: 1},
+		{name: "不分大小寫", query: "?q=chengchi", expectedCount: 1},
+		{name: "限制筆數", query: "?limit=1", expectedCount: 1},
+		{name: "萬用字元被跳脫", query: "?q=%25", expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeRequest(t, router, "GET", "/schools"+tt.query, nil, nil)
+			testutil.AssertStatusCode(t, w, 200)
+
+			var response utils.Response
+			testutil.ParseResponse(t, w, &response)
+			schools, _ := response.Data.([]interface{})
+			if len(schools) != tt.expectedCount {
+				t.Errorf("Expected %d schools, got %d", tt.expectedCount, len(schools))
+			}
+		})
+	}
+}
+
+func TestRegisterResolvesSchoolAlias(t *testing.T) {
+	router, cleanup := setupSchoolTests(t)
+	defer cleanup()
+
+	ntu := testutil.CreateTestSchool(database.DB, "國立臺灣大學")
+	if _, err := AddSchoolAlias(database.DB, ntu.ID, "National Taiwan University"); err != nil {
+		t.Fatalf("AddSchoolAlias failed: %v", err)
+	}
+
+	requestBody := map[string]interface{}{
+		"email":       "student@example.com",
+		"password":    "tomato-focus-42",
+		"name":        "學生",
+		"school_name": "national  taiwan UNIVERSITY",
+	}
+	w := testutil.MakeRequest(t, router, "POST", "/auth/register", requestBody, nil)
+	testutil.AssertStatusCode(t, w, 201)
+
+	var user models.User
+	database.DB.Where("email = ?", "student@example.com").First(&user)
+	if user.SchoolID == nil || *user.SchoolID != ntu.ID {
+		t.Error("Expected user to join the canonical school through its alias")
+	}
+
+	var count int64
+	database.DB.Model(&models.School{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected no new school to be created, got %d schools", count)
+	}
+}
+
+func TestAddSchoolAliasConflict(t *testing.T) {
+	_, cleanup := setupSchoolTests(t)
+	defer cleanup()
+
+	ntu := testutil.CreateTestSchool(database.DB, "國立臺灣大學")
+	nthu := testutil.CreateTestSchool(database.DB, "國立清華大學")
+
+	if _, err := AddSchoolAlias(database.DB, ntu.ID, "台大"); err != nil {
+		t.Fatalf("AddSchoolAlias failed: %v", err)
+	}
+	if _, err := AddSchoolAlias(database.DB, nthu.ID, "台大"); err != ErrSchoolNameTaken {
+		t.Errorf("Expected ErrSchoolNameTaken for duplicate alias, got %v", err)
+	}
+	if _, err := AddSchoolAlias(database.DB, nthu.ID, "國立臺灣大學"); err != ErrSchoolNameTaken {
+		t.Errorf("Expected ErrSchoolNameTaken for alias equal to a school name, got %v", err)
+	}
+}
+
+func TestMergeSchools(t *testing.T) {
+	_, cleanup := setupSchoolTests(t)
+	defer cleanup()
+
+	target := testutil.CreateTestSchool(database.DB, "國立臺灣大學")
+	source := testutil.CreateTestSchool(database.DB, "台灣大學")
+	if _, err := AddSchoolAlias(database.DB, source.ID, "NTU"); err != nil {
+		t.Fatalf("AddSchoolAlias failed: %v", err)
+	}
+
+	testutil.CreateTestUser(database.DB, "a@example.com", "password123", "甲", &target.ID)
+	movedUser := testutil.CreateTestUser(database.DB, "b@example.com", "password123", "乙", &source.ID)
+	database.DB.Model(target).UpdateColumns(map[string]interface{}{"student_count": 1, "total_points": 100})
+	database.DB.Model(source).UpdateColumns(map[string]interface{}{"student_count": 1, "total_points": 250})
+	database.DB.Model(movedUser).Update("total_points", 250)
+	earned := &models.PointTransaction{UserID: movedUser.ID, SchoolID: &source.ID, Delta: 250, Source: models.PointSourceBonus}
+	database.DB.Create(earned)
+
+	if _, err := MergeSchools(database.DB, source.ID, source.ID); err != ErrSameSchool {
+		t.Errorf("Expected ErrSameSchool, got %v", err)
+	}
+
+	merged, err := MergeSchools(database.DB, source.ID, target.ID)
+	if err != nil {
+		t.Fatalf("MergeSchools failed: %v", err)
+	}
+
+	if merged.StudentCount != 2 || merged.TotalPoints != 350 {
+		t.Errorf("Expected 2 students and 350 points, got %d and %d", merged.StudentCount, merged.TotalPoints)
+	}
+
+	var user models.User
+	database.DB.First(&user, movedUser.ID)
+	if user.SchoolID == nil || *user.SchoolID != target.ID {
+		t.Error("Expected user to be re-pointed to the target school")
+	}
+
+	// The original ledger entry is kept and the points move over with a
+	// compensating pair that leaves the user's total unchanged
+	var entry models.PointTransaction
+	if err := database.DB.First(&entry, earned.ID).Error; err != nil || entry.Delta != 250 {
+		t.Errorf("Expected the original ledger entry to be kept, got %+v", entry)
+	}
+	var atTarget int
+	database.DB.Model(&models.PointTransaction{}).
+		Where("user_id = ? AND school_id = ? AND source = ?", movedUser.ID, target.ID, models.PointSourceSchoolMerge).
+		Select("COALESCE(SUM(delta), 0)").Scan(&atTarget)
+	if atTarget != 250 {
+		t.Errorf("Expected 250 points moved to the target school, got %d", atTarget)
+	}
+	drifts, err := ReconcilePointLedger(true)
+	if err != nil || len(drifts) != 0 {
+		t.Errorf("Expected the ledger to still match user totals, got %v (%v)", drifts, err)
+	}
+
+	var count int64
+	database.DB.Model(&models.School{}).Where("id = ?", source.ID).Count(&count)
+	if count != 0 {
+		t.Error("Source school should be deleted")
+	}
+
+	// Both the old name and the old alias now resolve to the target
+	for _, name := range []string{"台灣大學", "ntu"} {
+		school, err := FindSchool(database.DB, name)
+		if err != nil || school.ID != target.ID {
+			t.Errorf("Expected %q to resolve to the merged school", name)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Season statuses as reported to clients
+const (
+	SeasonStatusUpcoming  = "upcoming"
+	SeasonStatusActive    = "active"
+	SeasonStatusEnded     = "ended"
+	SeasonStatusFinalized = "finalized"
+)
+
+type CreateSeasonRequest struct {
+	Name     string `json:"name" binding:"required"`
+	StartsOn string `json:"starts_on" binding:"required"`
+	EndsOn   string `json:"ends_on" binding:"required"`
+}
+
+// SeasonResponse is a season with its status on the current date
+type SeasonResponse struct {
+	models.Season
+	Status string `json:"status"`
+}
+
+// civilDate returns t's calendar day in t's time zone as a UTC midnight, the
+// form dates are stored and parsed in
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// statsLocation returns the configured STATS_TIMEZONE that calendar days are
+// counted in
+func statsLocation() *time.Location {
+	loc, err := time.LoadLocation(config.AppConfig.Stats.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localDate returns t's calendar day in STATS_TIMEZONE, so that days roll
+// over at the same time whatever zone the server runs in
+func localDate(t time.Time) time.Time {
+	return civilDate(t.In(statsLocation()))
+}
+
+func newSeasonResponse(season models.Season, today time.Time) SeasonResponse {
+	status := SeasonStatusActive
+	switch {
+	case season.IsFinalized():
+		status = SeasonStatusFinalized
+	case today.Before(season.StartsOn):
+		status = SeasonStatusUpcoming
+	case today.After(season.EndsOn):
+		status = SeasonStatusEnded
+	}
+	return SeasonResponse{Season: season, Status: status}
+}
+
+// seasonBounds returns the first and last day of the automatic season of the
+// given kind that contains day. Weeks start on Monday.
+func seasonBounds(kind models.SeasonKind, day time.Time) (start, end time.Time) {
+	day = localDate(day)
+	switch kind {
+	case models.SeasonMonthly:
+		start = day.AddDate(0, 0, 1-day.Day())
+		return start, start.AddDate(0, 1, -1)
+	default:
+		start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 6)
+	}
+}
+
+func seasonName(kind models.SeasonKind, start time.Time) string {
+	if kind == models.SeasonMonthly {
+		return fmt.Sprintf("%d 年 %d 月", start.Year(), start.Month())
+	}
+	year, week := start.ISOWeek()
+	return fmt.Sprintf("%d 第 %d 週", year, week)
+}
+
+// automaticSeasonKinds returns the configured kinds of season that are
+// started at every boundary, ignoring unknown ones
+func automaticSeasonKinds() []models.SeasonKind {
+	var kinds []models.SeasonKind
+	seen := map[models.SeasonKind]bool{}
+	for _, k := range config.AppConfig.Seasons.Kinds {
+		kind := models.SeasonKind(strings.ToLower(strings.TrimSpace(k)))
+		if (kind != models.SeasonWeekly && kind != models.SeasonMonthly) || seen[kind] {
+			continue
+		}
+		seen[kind] = true
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// EnsureCurrentSeasons starts the automatic seasons containing now that don't
+// exist yet. This is the reset at a season boundary: the new season starts
+// from zero since it only counts sessions dated within it.
+func EnsureCurrentSeasons(now time.Time) error {
+	for _, kind := range automaticSeasonKinds() {
+		start, end := seasonBounds(kind, now)
+		// The partial unique index on kind and start date makes this safe to
+		// run concurrently
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Season{
+			Name:     seasonName(kind, start),
+			Kind:     kind,
+			StartsOn: start,
+			EndsOn:   end,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// computeSeasonStandings ranks schools by the points their verified,
+// unbanned students earned in focus sessions dated within the season.
+// Students count for the school they belong to now. Tied schools share a rank.
+func computeSeasonStandings(db *gorm.DB, season *models.Season) ([]models.SeasonStanding, error) {
+	var rows []struct {
+		SchoolID     uuid.UUID
+		SchoolName   string
+		Points       int
+		Participants int
+	}
+	if err := db.Raw(`
+		SELECT
+			s.id AS school_id,
+			s.name AS school_name,
+			SUM(fs.points_earned) AS points,
+			COUNT(DISTINCT fs.user_id) AS participants
+		FROM focus_sessions fs
+		JOIN users u ON u.id = fs.user_id
+		JOIN schools s ON s.id = u.school_id
+		WHERE fs.date BETWEEN ? AND ?
+			AND u.email_verified_at IS NOT NULL
+			AND u.leaderboard_banned = ?
+		GROUP BY s.id, s.name
+		HAVING SUM(fs.points_earned) > 0
+		ORDER BY points DESC, s.name`,
+		season.StartsOn.Format("2006-01-02"), season.EndsOn.Format("2006-01-02"), false).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	standings := make([]models.SeasonStanding, len(rows))
+	for i, row := range rows {
+		schoolID := row.SchoolID
+		rank := i + 1
+		if i > 0 && row.Points == standings[i-1].Points {
+			rank = standings[i-1].Rank
+		}
+		standings[i] = models.SeasonStanding{
+			SeasonID:     season.ID,
+			SchoolID:     &schoolID,
+			SchoolName:   row.SchoolName,
+			Rank:         rank,
+			Points:       row.Points,
+			Participants: row.Participants,
+		}
+	}
+	return standings, nil
+}
+
+// seasonStandings returns the archived standings of a finalized season and
+// live standings otherwise
+func seasonStandings(db *gorm.DB, season *models.Season) ([]models.SeasonStanding, error) {
+	if !season.IsFinalized() {
+		return computeSeasonStandings(db, season)
+	}
+
+	var standings []models.SeasonStanding
+	err := db.Where("season_id = ?", season.ID).Order("rank, school_name").Find(&standings).Error
+	return standings, err
+}
+
+// finalizeSeason archives the final standings of an ended season. Sessions
+// backdated into the season afterwards no longer change its result.
+func finalizeSeason(seasonID uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var season models.Season
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&season, seasonID).Error; err != nil {
+			return err
+		}
+		if season.IsFinalized() {
+			return nil
+		}
+
+		standings, err := computeSeasonStandings(tx, &season)
+		if err != nil {
+			return err
+		}
+		if len(standings) > 0 {
+			if err := tx.CreateInBatches(standings, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&season).Update("finalized_at", time.Now()).Error
+	})
+}
+
+// RotateSeasons finalizes every season that ended before now and starts the
+// automatic seasons containing now. It returns how many seasons were
+// finalized.
+func RotateSeasons(now time.Time) (int, error) {
+	var ended []uuid.UUID
+	if err := database.DB.Model(&models.Season{}).
+		Where("finalized_at IS NULL AND ends_on < ?", localDate(now).Format("2006-01-02")).
+		Order("ends_on").
+		Pluck("id", &ended).Error; err != nil {
+		return 0, err
+	}
+
+	finalized := 0
+	for _, id := range ended {
+		if err := finalizeSeason(id); err != nil {
+			return finalized, err
+		}
+		finalized++
+	}
+
+	return finalized, EnsureCurrentSeasons(now)
+}
+
+// respondWithStandings sends the season with its standings, limited to the
+// top entries, and the standing of the user's school wherever it ranks
+func respondWithStandings(c *gin.Context, season *models.Season) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 200 {
+			limit = val
+		}
+	}
+
+	standings, err := seasonStandings(database.DB, season)
+	if err != nil {
+		utils.InternalErrorResponse(c, "查詢賽季排名失敗")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "school_id").First(&user, userID).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢使用者失敗")
+		return
+	}
+
+	var mySchool *models.SeasonStanding
+	if user.SchoolID != nil {
+		for i := range standings {
+			if standings[i].SchoolID != nil && *standings[i].SchoolID == *user.SchoolID {
+				mySchool = &standings[i]
+				break
+			}
+		}
+	}
+
+	total := len(standings)
+	if len(standings) > limit {
+		standings = standings[:limit]
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"season":    newSeasonResponse(*season, localDate(time.Now())),
+		"standings": standings,
+		"total":     total,
+		"my_school": mySchool,
+	}, "")
+}
+
+// ListSeasons lists seasons, newest first, optionally filtered by kind and
+// status
+func ListSeasons(c *gin.Context) {
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if val, err := utils.ParseInt(o); err == nil && val >= 0 {
+			offset = val
+		}
+	}
+
+	query := database.DB.Model(&models.Season{})
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	today := localDate(time.Now())
+	date := today.Format("2006-01-02")
+	switch c.Query("status") {
+	case "":
+	case SeasonStatusUpcoming:
+		query = query.Where("finalized_at IS NULL AND starts_on > ?", date)
+	case SeasonStatusActive:
+		query = query.Where("finalized_at IS NULL AND starts_on <= ? AND ends_on >= ?", date, date)
+	case SeasonStatusEnded:
+		query = query.Where("finalized_at IS NULL AND ends_on < ?", date)
+	case SeasonStatusFinalized:
+		query = query.Where("finalized_at IS NOT NULL")
+	default:
+		utils.ValidationErrorResponse(c, "無效的賽季狀態")
+		return
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var seasons []models.Season
+	if err := query.Order("starts_on DESC, created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&seasons).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢賽季失敗")
+		return
+	}
+
+	response := make([]SeasonResponse, len(seasons))
+	for i, season := range seasons {
+		response[i] = newSeasonResponse(season, today)
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"seasons": response,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	}, "")
+}
+
+// GetCurrentSeason returns the running season of a kind (weekly by default)
+// with its live leaderboard
+func GetCurrentSeason(c *gin.Context) {
+	kind := models.SeasonKind(c.DefaultQuery("kind", string(models.SeasonWeekly)))
+	if kind != models.SeasonWeekly && kind != models.SeasonMonthly && kind != models.SeasonCustom {
+		utils.ValidationErrorResponse(c, "無效的賽季類型")
+		return
+	}
+
+	now := time.Now()
+	today := localDate(now).Format("2006-01-02")
+	find := func(season *models.Season) error {
+		return database.DB.
+			Where("kind = ? AND starts_on <= ? AND ends_on >= ?", kind, today, today).
+			Order("starts_on DESC").
+			First(season).Error
+	}
+
+	var season models.Season
+	err := find(&season)
+	if err == gorm.ErrRecordNotFound && kind != models.SeasonCustom {
+		// The boundary may have passed since maintenance last ran
+		if err := EnsureCurrentSeasons(now); err != nil {
+			log.Printf("Failed to start current seasons: %v", err)
+		}
+		err = find(&season)
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "目前沒有進行中的賽季")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢賽季失敗")
+		return
+	}
+
+	respondWithStandings(c, &season)
+}
+
+// GetSeason returns a season with its standings: live while it runs, the
+// archived final standings once it has been finalized
+func GetSeason(c *gin.Context) {
+	seasonID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的賽季 ID")
+		return
+	}
+
+	var season models.Season
+	if err := database.DB.First(&season, seasonID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "賽季不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢賽季失敗")
+		return
+	}
+
+	respondWithStandings(c, &season)
+}
+
+// AdminCreateSeason creates a custom season, e.g. for an exam-period
+// competition. Only admins may do this since seasons span schools.
+func AdminCreateSeason(c *gin.Context) {
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+	if actor.Role != models.RoleAdmin {
+		utils.ForbiddenResponse(c, "")
+		return
+	}
+
+	var req CreateSeasonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.ValidationErrorResponse(c, "賽季名稱不可為空")
+		return
+	}
+	startsOn, err := time.Parse("2006-01-02", req.StartsOn)
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的開始日期格式")
+		return
+	}
+	endsOn, err := time.Parse("2006-01-02", req.EndsOn)
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的結束日期格式")
+		return
+	}
+	if endsOn.Before(startsOn) {
+		utils.ValidationErrorResponse(c, "結束日期不可早於開始日期")
+		return
+	}
+	if endsOn.Before(localDate(time.Now())) {
+		utils.ValidationErrorResponse(c, "結束日期不可早於今天")
+		return
+	}
+
+	season := models.Season{
+		Name:     name,
+		Kind:     models.SeasonCustom,
+		StartsOn: startsOn,
+		EndsOn:   endsOn,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&season).Error; err != nil {
+			return err
+		}
+		_, err := writeAuditLog(tx, actor, AuditActionCreateSeason, auditTargetSeason, season.ID, "", gin.H{
+			"name":      season.Name,
+			"starts_on": req.StartsOn,
+			"ends_on":   req.EndsOn,
+		})
+		return err
+	})
+	if err != nil {
+		utils.InternalErrorResponse(c, "建立賽季失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, newSeasonResponse(season, localDate(time.Now())), "賽季已建立")
+}
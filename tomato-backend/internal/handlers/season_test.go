@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupSeasonTests(t *testing.T) (*gin.Engine, *models.User, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.AppConfig.Seasons.Kinds = []string{"weekly"}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/seasons", middleware.AuthMiddleware(), ListSeasons)
+	router.GET("/seasons/current", middleware.AuthMiddleware(), GetCurrentSeason)
+	router.GET("/seasons/:id", middleware.AuthMiddleware(), GetSeason)
+	router.POST("/admin/seasons", middleware.AuthMiddleware(), middleware.RequireRole(models.RoleSchoolAdmin, models.RoleAdmin), AdminCreateSeason)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, token, cleanup
+}
+
+// seedSeasonSession stores a focus session on date worth points
+func seedSeasonSession(t *testing.T, userID uuid.UUID, date time.Time, points int) {
+	if err := database.DB.Create(&models.FocusSession{
+		UserID:       userID,
+		Date:         civilDate(date),
+		Minutes:      25,
+		PointsEarned: points,
+	}).Error; err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+}
+
+func mustDate(t *testing.T, s string) time.Time {
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatalf("Invalid date %q: %v", s, err)
+	}
+	return date
+}
+
+func TestSeasonBounds(t *testing.T) {
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		kind          models.SeasonKind
+		day           string
+		expectedStart string
+		expectedEnd   string
+		expectedName  string
+	}{
+		{name: "週一", kind: models.SeasonWeekly, day: "2026-10-12", expectedStart: "2026-10-12", expectedEnd: "2026-10-18", expectedName: "2026 第 42 週"},
+		{name: "週日", kind: models.SeasonWeekly, day: "2026-10-18", expectedStart: "2026-10-12", expectedEnd: "2026-10-18", expectedName: "2026 第 42 週"},
+		{name: "跨年的週", kind: models.SeasonWeekly, day: "2027-01-01", expectedStart: "2026-12-28", expectedEnd: "2027-01-03", expectedName: "2026 第 53 週"},
+		{name: "月中", kind: models.SeasonMonthly, day: "2026-10-18", expectedStart: "2026-10-01", expectedEnd: "2026-10-31", expectedName: "2026 年 10 月"},
+		{name: "閏年二月", kind: models.SeasonMonthly, day: "2028-02-29", expectedStart: "2028-02-01", expectedEnd: "2028-02-29", expectedName: "2028 年 2 月"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := seasonBounds(tt.kind, mustDate(t, tt.day))
+			if got := start.Format("2006-01-02"); got != tt.expectedStart {
+				t.Errorf("Expected start %s, got %s", tt.expectedStart, got)
+			}
+			if got := end.Format("2006-01-02"); got != tt.expectedEnd {
+				t.Errorf("Expected end %s, got %s", tt.expectedEnd, got)
+			}
+			if got := seasonName(tt.kind, start); got != tt.expectedName {
+				t.Errorf("Expected name %q, got %q", tt.expectedName, got)
+			}
+		})
+	}
+}
+
+func TestSeasonBoundsUseStatsTimezone(t *testing.T) {
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.AppConfig.Stats.Timezone = "Asia/Taipei"
+
+	// Monday 07:30 in Taipei is still Sunday in UTC
+	now := time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC)
+	if got := localDate(now).Format("2006-01-02"); got != "2026-10-19" {
+		t.Errorf("Expected 2026-10-19, got %s", got)
+	}
+	if start, _ := seasonBounds(models.SeasonWeekly, now); start.Format("2006-01-02") != "2026-10-19" {
+		t.Errorf("Expected the week starting 2026-10-19, got %s", start.Format("2006-01-02"))
+	}
+}
+
+func TestComputeSeasonStandings(t *testing.T) {
+	_, user, _, cleanup := setupSeasonTests(t)
+	defer cleanup()
+
+	db := database.DB
+	other := testutil.CreateTestSchool(db, "其他大學")
+	small := testutil.CreateTestSchool(db, "小學校")
+
+	classmate := testutil.CreateTestUser(db, "classmate@example.com", "password123", "同學", user.SchoolID)
+	rival := testutil.CreateTestUser(db, "rival@example.com", "password123", "對手", &other.ID)
+	banned := testutil.CreateTestUser(db, "banned@example.com", "password123", "禁賽", &other.ID)
+	db.Model(banned).Update("leaderboard_banned", true)
+	unverified := testutil.CreateTestUser(db, "unverified@example.com", "password123", "未驗證", &small.ID)
+	db.Model(unverified).Update("email_verified_at", nil)
+
+	season := &models.Season{ID: uuid.New(), StartsOn: mustDate(t, "2026-03-02"), EndsOn: mustDate(t, "2026-03-08")}
+
+	seedSeasonSession(t, user.ID, mustDate(t, "2026-03-02"), 100)
+	seedSeasonSession(t, classmate.ID, mustDate(t, "2026-03-08"), 50)
+	seedSeasonSession(t, user.ID, mustDate(t, "2026-03-01"), 1000)
+	seedSeasonSession(t, user.ID, mustDate(t, "2026-03-09"), 1000)
+	seedSeasonSession(t, rival.ID, mustDate(t, "2026-03-05"), 120)
+	seedSeasonSession(t, banned.ID, mustDate(t, "2026-03-05"), 500)
+	seedSeasonSession(t, unverified.ID, mustDate(t, "2026-03-05"), 900)
+
+	standings, err := computeSeasonStandings(db, season)
+	if err != nil {
+		t.Fatalf("computeSeasonStandings failed: %v", err)
+	}
+	if len(standings) != 2 {
+		t.Fatalf("Expected 2 ranked schools, got %d", len(standings))
+	}
+
+	expected := []struct {
+		schoolID     uuid.UUID
+		rank         int
+		points       int
+		participants int
+	}{
+		{schoolID: *user.SchoolID, rank: 1, points: 150, participants: 2},
+		{schoolID: other.ID, rank: 2, points: 120, participants: 1},
+	}
+	for i, e := range expected {
+		s := standings[i]
+		if *s.SchoolID != e.schoolID || s.Rank != e.rank || s.Points != e.points || s.Participants != e.participants {
+			t.Errorf("Standing %d: expected %+v, got rank %d points %d participants %d", i, e, s.Rank, s.Points, s.Participants)
+		}
+	}
+
+	// Ties share a rank
+	seedSeasonSession(t, rival.ID, mustDate(t, "2026-03-06"), 30)
+	standings, _ = computeSeasonStandings(db, season)
+	if standings[0].Rank != 1 || standings[1].Rank != 1 {
+		t.Errorf("Expected tied schools to share rank 1, got %d and %d", standings[0].Rank, standings[1].Rank)
+	}
+}
+
+func TestRotateSeasonsArchivesStandings(t *testing.T) {
+	router, user, token, cleanup := setupSeasonTests(t)
+	defer cleanup()
+
+	now := time.Now()
+	lastWeek := now.AddDate(0, 0, -7)
+	if err := EnsureCurrentSeasons(lastWeek); err != nil {
+		t.Fatalf("EnsureCurrentSeasons failed: %v", err)
+	}
+	seedSeasonSession(t, user.ID, lastWeek, 200)
+
+	finalized, err := RotateSeasons(now)
+	if err != nil {
+		t.Fatalf("RotateSeasons failed: %v", err)
+	}
+	if finalized != 1 {
+		t.Fatalf("Expected 1 season finalized, got %d", finalized)
+	}
+
+	start, _ := seasonBounds(models.SeasonWeekly, lastWeek)
+	var season models.Season
+	database.DB.Where("kind = ? AND starts_on = ?", models.SeasonWeekly, start.Format("2006-01-02")).First(&season)
+	if !season.IsFinalized() {
+		t.Fatal("Expected last week's season to be finalized")
+	}
+
+	// The next season started from zero
+	var seasons int64
+	database.DB.Model(&models.Season{}).Count(&seasons)
+	if seasons != 2 {
+		t.Errorf("Expected the current season to be started, got %d seasons", seasons)
+	}
+
+	// Sessions backdated after the season ended don't change its result
+	seedSeasonSession(t, user.ID, lastWeek, 300)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/seasons/"+season.ID.String(), token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	data := response.Data.(map[string]interface{})
+	if status := data["season"].(map[string]interface{})["status"]; status != SeasonStatusFinalized {
+		t.Errorf("Expected status finalized, got %v", status)
+	}
+	standings := data["standings"].([]interface{})
+	if len(standings) != 1 || standings[0].(map[string]interface{})["points"] != float64(200) {
+		t.Errorf("Expected the archived 200 points, got %v", standings)
+	}
+
+	// Rotating again is a no-op
+	if finalized, err := RotateSeasons(now); err != nil || finalized != 0 {
+		t.Errorf("Expected nothing to finalize, got %d (%v)", finalized, err)
+	}
+}
+
+func TestGetCurrentSeason(t *testing.T) {
+	router, user, token, cleanup := setupSeasonTests(t)
+	defer cleanup()
+
+	seedSeasonSession(t, user.ID, time.Now(), 75)
+
+	// The current season is started on demand
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/seasons/current", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	data := response.Data.(map[string]interface{})
+	if status := data["season"].(map[string]interface{})["status"]; status != SeasonStatusActive {
+		t.Errorf("Expected status active, got %v", status)
+	}
+	mySchool, ok := data["my_school"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected the user's school standing, got %v", data["my_school"])
+	}
+	if mySchool["points"] != float64(75) || mySchool["rank"] != float64(1) {
+		t.Errorf("Expected rank 1 with 75 points, got %v", mySchool)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "未啟用的賽季類型", path: "/seasons/current?kind=monthly", expectedStatus: 404},
+		{name: "沒有自訂賽季", path: "/seasons/current?kind=custom", expectedStatus: 404},
+		{name: "無效的賽季類型", path: "/seasons/current?kind=yearly", expectedStatus: 400},
+		{name: "賽季列表", path: "/seasons?status=active", expectedStatus: 200},
+		{name: "無效的狀態", path: "/seasons?status=unknown", expectedStatus: 400},
+		{name: "不存在的賽季", path: "/seasons/" + uuid.New().String(), expectedStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "GET", tt.path, token, nil)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+		})
+	}
+}
+
+func TestAdminCreateSeason(t *testing.T) {
+	router, _, token, cleanup := setupSeasonTests(t)
+	defer cleanup()
+
+	admin := testutil.CreateTestUser(database.DB, "admin@example.com", "password123", "管理員", nil)
+	database.DB.Model(admin).Update("role", models.RoleAdmin)
+	adminToken, _, _ := utils.GenerateSessionTokens(admin, uuid.Nil)
+
+	today := time.Now().Format("2006-01-02")
+	nextMonth := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+
+	tests := []struct {
+		name           string
+		token          string
+		requestBody    map[string]interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "學生無法建立",
+			token:          token,
+			requestBody:    map[string]interface{}{"name": "期末衝刺", "starts_on": today, "ends_on": nextMonth},
+			expectedStatus: 403,
+		},
+		{
+			name:           "結束早於開始",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{"name": "期末衝刺", "starts_on": nextMonth, "ends_on": today},
+			expectedStatus: 400,
+		},
+		{
+			name:           "已結束的賽季",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{"name": "期末衝刺", "starts_on": yesterday, "ends_on": yesterday},
+			expectedStatus: 400,
+		},
+		{
+			name:           "無效的日期",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{"name": "期末衝刺", "starts_on": "2026/01/01", "ends_on": nextMonth},
+			expectedStatus: 400,
+		},
+		{
+			name:           "成功建立",
+			token:          adminToken,
+			requestBody:    map[string]interface{}{"name": "期末衝刺", "starts_on": today, "ends_on": nextMonth},
+			expectedStatus: 201,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/admin/seasons", tt.token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+		})
+	}
+
+	var logs int64
+	database.DB.Model(&models.AdminAuditLog{}).Where("action = ?", AuditActionCreateSeason).Count(&logs)
+	if logs != 1 {
+		t.Errorf("Expected 1 audit log entry, got %d", logs)
+	}
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/seasons/current?kind=custom", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/outbox"
+	"github.com/yourusername/tomato-backend/internal/stats"
 	"github.com/yourusername/tomato-backend/internal/utils"
 	"gorm.io/gorm"
 )
@@ -19,6 +21,17 @@ type CreateSessionRequest struct {
 	Date     string  `json:"date" binding:"required"` // YYYY-MM-DD
 	Minutes  int     `json:"minutes" binding:"required,min=1"`
 	Location string  `json:"location"`
+	// StartedAt is when the session began (RFC 3339); defaults to the
+	// session's length before now
+	StartedAt *time.Time `json:"started_at"`
+}
+
+// CreateSessionResponse is the created session with the user's level after
+// it, so the app can celebrate a level-up right away
+type CreateSessionResponse struct {
+	models.FocusSession
+	Level   utils.LevelInfo `json:"level"`
+	LevelUp *utils.LevelUp  `json:"level_up"`
 }
 
 // GetSessions retrieves focus sessions with pagination
@@ -59,7 +72,7 @@ func GetSessions(c *gin.Context) {
 
 	// Get sessions
 	var sessions []models.FocusSession
-	if err := query.Preload("Plan").Preload("Course").
+	if err := query.Preload("Plan", withTrashed).Preload("Course", withTrashed).
 		Order("created_at DESC").
 		Limit(limit).Offset(offset).
 		Find(&sessions).Error; err != nil {
@@ -96,15 +109,22 @@ func CreateSession(c *gin.Context) {
 		return
 	}
 
-	// Calculate points
-	basePoints := req.Minutes * config.AppConfig.Points.BasePointsPerMinute
-	// TODO: Add streak bonus calculation if needed
-	pointsEarned := basePoints
+	startedAt := time.Now().Add(-time.Duration(req.Minutes) * time.Minute)
+	if req.StartedAt != nil {
+		if req.StartedAt.After(time.Now().Add(sessionClockSkew)) {
+			utils.ValidationErrorResponse(c, "開始時間不可晚於現在")
+			return
+		}
+		startedAt = *req.StartedAt
+	}
+
+	pointsEarned := sessionPoints(req.Minutes)
 
 	session := models.FocusSession{
 		UserID:       userID,
 		Date:         date,
 		Minutes:      req.Minutes,
+		StartedAt:    &startedAt,
 		PointsEarned: pointsEarned,
 		Location:     req.Location,
 	}
@@ -116,6 +136,10 @@ func CreateSession(c *gin.Context) {
 			utils.ValidationErrorResponse(c, "無效的計畫 ID")
 			return
 		}
+		if !ownsRecord(&models.StudyPlan{}, planID, userID) {
+			utils.NotFoundResponse(c, "計畫不存在")
+			return
+		}
 		session.PlanID = &planID
 	}
 
@@ -126,73 +150,118 @@ func CreateSession(c *gin.Context) {
 			utils.ValidationErrorResponse(c, "無效的課程 ID")
 			return
 		}
+		if !ownsRecord(&models.Course{}, courseID, userID) {
+			utils.NotFoundResponse(c, "課程不存在")
+			return
+		}
 		session.CourseID = &courseID
 	}
 
-	// Start transaction
-	tx := database.DB.Begin()
-
-	// Create session
-	if err := tx.Create(&session).Error; err != nil {
-		tx.Rollback()
+	totalPoints, err := saveFocusSession(&session)
+	if err != nil {
 		utils.InternalErrorResponse(c, "專注紀錄創建失敗")
 		return
 	}
 
-	// Update user total points
-	if err := tx.Model(&models.User{}).
-		Where("id = ?", userID).
-		UpdateColumn("total_points", gorm.Expr("total_points + ?", pointsEarned)).
-		Error; err != nil {
-		tx.Rollback()
-		utils.InternalErrorResponse(c, "更新用戶積分失敗")
-		return
-	}
+	// Load relations
+	database.DB.Preload("Plan", withTrashed).Preload("Course", withTrashed).First(&session, session.ID)
 
-	// Update school total points if user has school
-	var user models.User
-	if err := tx.Select("school_id").Where("id = ?", userID).First(&user).Error; err == nil && user.SchoolID != nil {
-		if err := tx.Model(&models.School{}).
-			Where("id = ?", user.SchoolID).
-			UpdateColumn("total_points", gorm.Expr("total_points + ?", pointsEarned)).
-			Error; err != nil {
-			tx.Rollback()
-			utils.InternalErrorResponse(c, "更新學校積分失敗")
-			return
+	utils.SuccessResponse(c, 201, CreateSessionResponse{
+		FocusSession: session,
+		Level:        utils.LevelFor(totalPoints),
+		LevelUp:      utils.LevelUpBetween(totalPoints-pointsEarned, totalPoints),
+	}, "專注紀錄新增成功")
+}
+
+// ownsRecord reports whether the plan or course with the given ID exists and
+// belongs to the user
+func ownsRecord(model interface{}, id, userID uuid.UUID) bool {
+	var count int64
+	database.DB.Model(model).Where("id = ? AND user_id = ?", id, userID).Count(&count)
+	return count > 0
+}
+
+// sessionClockSkew is how far in the future a client's clock may put a
+// session's start
+const sessionClockSkew = 5 * time.Minute
+
+// sessionPoints returns the points a session of the given length earns
+func sessionPoints(minutes int) int {
+	basePoints := minutes * config.AppConfig.Points.BasePointsPerMinute
+	// TODO: Add streak bonus calculation if needed
+	return basePoints
+}
+
+// saveFocusSession stores a new session, credits its points, advances its
+// plan and writes the domain events in one transaction, then notifies the
+// user's event streams. It returns the user's point total afterwards.
+func saveFocusSession(session *models.FocusSession) (totalPoints int, err error) {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		if err := outbox.Publish(tx, outbox.SessionCreated{
+			SessionID:    session.ID,
+			UserID:       session.UserID,
+			PlanID:       session.PlanID,
+			CourseID:     session.CourseID,
+			Date:         session.Date,
+			StartedAt:    session.StartedAt,
+			Minutes:      session.Minutes,
+			PointsEarned: session.PointsEarned,
+		}); err != nil {
+			return err
 		}
-	}
 
-	// Update plan progress if plan_id provided
-	if session.PlanID != nil {
+		// Credit user and school points through the ledger
+		if _, err := recordPoints(tx, session.UserID, session.PointsEarned, models.PointSourceSession, &session.ID, ""); err != nil {
+			return err
+		}
+
+		// The user row is locked by recordPoints, so the total is exact
+		if err := tx.Model(&models.User{}).Where("id = ?", session.UserID).Select("total_points").Scan(&totalPoints).Error; err != nil {
+			return err
+		}
+
+		if session.PlanID == nil {
+			return nil
+		}
+
+		// Update plan progress
 		if err := tx.Model(&models.StudyPlan{}).
-			Where("id = ?", session.PlanID).
+			Where("id = ? AND user_id = ?", session.PlanID, session.UserID).
 			UpdateColumns(map[string]interface{}{
-				"completed_minutes": gorm.Expr("completed_minutes + ?", req.Minutes),
+				"completed_minutes": gorm.Expr("completed_minutes + ?", session.Minutes),
 				"pomodoro_count":    gorm.Expr("pomodoro_count + 1"),
 			}).Error; err != nil {
-			tx.Rollback()
-			utils.InternalErrorResponse(c, "更新計畫進度失敗")
-			return
+			return err
 		}
 
 		// Check if plan should be marked complete
 		var plan models.StudyPlan
-		if err := tx.Where("id = ?", session.PlanID).First(&plan).Error; err == nil {
+		if err := tx.Where("id = ? AND user_id = ?", session.PlanID, session.UserID).First(&plan).Error; err == nil {
+			wasCompleted := plan.Completed
 			plan.CheckAndMarkComplete()
 			tx.Save(&plan)
+			if plan.Completed && !wasCompleted {
+				return outbox.Publish(tx, outbox.PlanCompleted{PlanID: plan.ID, UserID: plan.UserID, CompletedAt: *plan.CompletedAt})
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		utils.InternalErrorResponse(c, "提交事務失敗")
-		return
+	publishUserEvent(session.UserID, EventSessionCreated, session)
+	publishPointsChanged(session.UserID, totalPoints, session.PointsEarned)
+	if session.PlanID != nil {
+		var plan models.StudyPlan
+		if database.DB.Preload("Course").First(&plan, session.PlanID).Error == nil {
+			publishUserEvent(session.UserID, EventPlanUpdated, plan)
+		}
 	}
-
-	// Load relations
-	database.DB.Preload("Plan").Preload("Course").First(&session, session.ID)
-
-	utils.SuccessResponse(c, 201, session, "專注紀錄新增成功")
+	return totalPoints, nil
 }
 
 // GetSessionStats retrieves statistics for a given period
@@ -203,130 +272,60 @@ func GetSessionStats(c *gin.Context) {
 		return
 	}
 
-	period := c.DefaultQuery("period", "month") // week, month, year, lifetime
-
-	var startDate time.Time
-	now := time.Now()
-
-	switch period {
-	case "week":
-		startDate = now.AddDate(0, 0, -7)
-	case "month":
-		startDate = now.AddDate(0, -1, 0)
-	case "year":
-		startDate = now.AddDate(-1, 0, 0)
-	case "lifetime":
-		startDate = time.Time{} // All time
-	default:
-		startDate = now.AddDate(0, -1, 0) // Default to month
+	// Hour-of-day and weekday statistics, and which day it is for the
+	// calendar periods and the current streak, use this time zone
+	loc, err := time.LoadLocation(c.DefaultQuery("tz", config.AppConfig.Stats.Timezone))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的時區，請使用 IANA 時區名稱，例如 Asia/Taipei")
+		return
 	}
-
-	query := database.DB.Where("user_id = ?", userID)
-	if !startDate.IsZero() {
-		query = query.Where("date >= ?", startDate.Format("2006-01-02"))
+	today := civilDate(time.Now().In(loc))
+
+	// An explicit start_date and end_date, or a period: week, month, year
+	// and lifetime reach back from today; this_week, last_week, this_month,
+	// last_month and this_year follow the calendar
+	period, msg := resolveStatsPeriod(c, today)
+	if msg != "" {
+		utils.ValidationErrorResponse(c, msg)
+		return
 	}
 
-	// Basic stats
-	type Stats struct {
-		TotalSessions int
-		TotalMinutes  int
-		TotalPoints   int
-		ActiveDays    int64
+	groupBy := c.DefaultQuery("group_by", stats.GroupDay)
+	if !stats.ValidGroup(groupBy) {
+		utils.ValidationErrorResponse(c, "group_by 必須為 day、week、month、course 或 location")
+		return
 	}
 
-	var stats Stats
-	query.Model(&models.FocusSession{}).Count(&stats.TotalSessions)
-	query.Model(&models.FocusSession{}).Select("COALESCE(SUM(minutes), 0)").Scan(&stats.TotalMinutes)
-	query.Model(&models.FocusSession{}).Select("COALESCE(SUM(points_earned), 0)").Scan(&stats.TotalPoints)
-	query.Model(&models.FocusSession{}).Distinct("date").Count(&stats.ActiveDays)
-
-	// Daily breakdown
-	var dailyData []struct {
-		Date     string `json:"date"`
-		Sessions int    `json:"sessions"`
-		Minutes  int    `json:"minutes"`
-		Points   int    `json:"points"`
-	}
-	query.Model(&models.FocusSession{}).
-		Select("date, COUNT(*) as sessions, SUM(minutes) as minutes, SUM(points_earned) as points").
-		Group("date").
-		Order("date").
-		Scan(&dailyData)
-
-	// Course breakdown
-	var courseData []struct {
-		CourseName string `json:"course_name"`
-		Minutes    int    `json:"minutes"`
-	}
-	database.DB.Table("focus_sessions").
-		Select("courses.name as course_name, SUM(focus_sessions.minutes) as minutes").
-		Joins("LEFT JOIN courses ON focus_sessions.course_id = courses.id").
-		Where("focus_sessions.user_id = ?", userID).
-		Where("focus_sessions.date >= ?", startDate.Format("2006-01-02")).
-		Where("courses.name IS NOT NULL").
-		Group("courses.name").
-		Order("minutes DESC").
-		Scan(&courseData)
-
-	// Calculate percentages
-	type CourseBreakdown struct {
-		CourseName string  `json:"course_name"`
-		Minutes    int     `json:"minutes"`
-		Percentage float64 `json:"percentage"`
-	}
-	var courseBreakdown []CourseBreakdown
-	for _, cd := range courseData {
-		percentage := 0.0
-		if stats.TotalMinutes > 0 {
-			percentage = float64(cd.Minutes) / float64(stats.TotalMinutes) * 100
-		}
-		courseBreakdown = append(courseBreakdown, CourseBreakdown{
-			CourseName: cd.CourseName,
-			Minutes:    cd.Minutes,
-			Percentage: percentage,
-		})
+	report, err := stats.NewRepository(database.DB).Report(stats.Query{
+		UserID:   userID,
+		Range:    period.Range,
+		Previous: period.Previous,
+		GroupBy:  groupBy,
+		Location: loc,
+		Today:    today,
+	})
+	if err != nil {
+		utils.InternalErrorResponse(c, "查詢統計資料失敗")
+		return
 	}
 
-	// Calculate current streak
-	currentStreak := calculateStreak(userID)
-
 	utils.SuccessResponse(c, 200, gin.H{
-		"period":             period,
-		"total_sessions":     stats.TotalSessions,
-		"total_minutes":      stats.TotalMinutes,
-		"total_points":       stats.TotalPoints,
-		"active_days":        stats.ActiveDays,
-		"current_streak":     currentStreak,
-		"daily_breakdown":    dailyData,
-		"course_breakdown":   courseBreakdown,
+		"period":                  period.Name,
+		"start_date":              formatStatsDate(period.Range.Start),
+		"end_date":                formatStatsDate(period.Range.End),
+		"group_by":                groupBy,
+		"total_sessions":          report.Totals.Sessions,
+		"total_minutes":           report.Totals.Minutes,
+		"total_points":            report.Totals.Points,
+		"active_days":             report.Totals.ActiveDays,
+		"current_streak":          report.CurrentStreak,
+		"longest_streak":          report.LongestStreak,
+		"average_session_minutes": report.AverageSessionMinutes,
+		"longest_session_minutes": report.LongestSessionMinutes,
+		"daily_breakdown":         report.Daily,
+		"course_breakdown":        report.Courses,
+		"breakdown":               report.Breakdown,
+		"heatmap":                 report.Heatmap,
+		"comparison":              report.Comparison,
 	}, "")
 }
-
-// calculateStreak calculates current consecutive days streak
-func calculateStreak(userID uuid.UUID) int {
-	var dates []string
-	database.DB.Model(&models.FocusSession{}).
-		Where("user_id = ?", userID).
-		Distinct("date").
-		Order("date DESC").
-		Pluck("date", &dates)
-
-	if len(dates) == 0 {
-		return 0
-	}
-
-	streak := 0
-	today := time.Now().Format("2006-01-02")
-
-	for i, dateStr := range dates {
-		expectedDate := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
-
-		if dateStr == expectedDate || (i == 0 && dateStr < today) {
-			streak++
-		} else {
-			break
-		}
-	}
-
-	return streak
-}
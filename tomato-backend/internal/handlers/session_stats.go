@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/stats"
+)
+
+// statsPeriod is the range of dates the statistics cover and the one they
+// are compared with. Range is open for lifetime and has no end for the
+// rolling periods; Previous is nil when there is nothing to compare with.
+type statsPeriod struct {
+	Name     string
+	Range    stats.Range
+	Previous *stats.Range
+}
+
+// rollingRange is the range from start on, compared with the same length of
+// time before it
+func rollingRange(name string, start, previousStart time.Time) statsPeriod {
+	return statsPeriod{
+		Name:     name,
+		Range:    stats.Range{Start: start},
+		Previous: &stats.Range{Start: previousStart, End: start.AddDate(0, 0, -1)},
+	}
+}
+
+// calendarRange is the range from start up to, but not including, next,
+// compared with the one starting at previous
+func calendarRange(name string, start, next, previous time.Time) statsPeriod {
+	return statsPeriod{
+		Name:     name,
+		Range:    stats.Range{Start: start, End: next.AddDate(0, 0, -1)},
+		Previous: &stats.Range{Start: previous, End: start.AddDate(0, 0, -1)},
+	}
+}
+
+// resolveStatsPeriod reads the range from start_date and end_date, or else
+// from period, relative to today. It returns a message for invalid input.
+func resolveStatsPeriod(c *gin.Context, today time.Time) (statsPeriod, string) {
+	startDate, endDate := c.Query("start_date"), c.Query("end_date")
+	if startDate != "" || endDate != "" {
+		if startDate == "" || endDate == "" {
+			return statsPeriod{}, "請同時提供 start_date 與 end_date"
+		}
+		start, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return statsPeriod{}, "無效的開始日期格式"
+		}
+		end, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return statsPeriod{}, "無效的結束日期格式"
+		}
+		if end.Before(start) {
+			return statsPeriod{}, "結束日期不可早於開始日期"
+		}
+		// Compared with as many days just before
+		days := int(end.Sub(start).Hours()/24) + 1
+		return calendarRange("custom", start, end.AddDate(0, 0, 1), start.AddDate(0, 0, -days)), ""
+	}
+
+	period := c.DefaultQuery("period", "month")
+	weekStart := today.AddDate(0, 0, -(int(today.Weekday())+6)%7) // Monday
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	yearStart := time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+
+	switch period {
+	case "week":
+		start := today.AddDate(0, 0, -7)
+		return rollingRange(period, start, start.AddDate(0, 0, -7)), ""
+	case "year":
+		start := today.AddDate(-1, 0, 0)
+		return rollingRange(period, start, start.AddDate(-1, 0, 0)), ""
+	case "lifetime":
+		return statsPeriod{Name: period}, ""
+	case "this_week":
+		return calendarRange(period, weekStart, weekStart.AddDate(0, 0, 7), weekStart.AddDate(0, 0, -7)), ""
+	case "last_week":
+		start := weekStart.AddDate(0, 0, -7)
+		return calendarRange(period, start, weekStart, start.AddDate(0, 0, -7)), ""
+	case "this_month":
+		return calendarRange(period, monthStart, monthStart.AddDate(0, 1, 0), monthStart.AddDate(0, -1, 0)), ""
+	case "last_month":
+		start := monthStart.AddDate(0, -1, 0)
+		return calendarRange(period, start, monthStart, start.AddDate(0, -1, 0)), ""
+	case "this_year":
+		return calendarRange(period, yearStart, yearStart.AddDate(1, 0, 0), yearStart.AddDate(-1, 0, 0)), ""
+	default:
+		// Anything else is the last month
+		start := today.AddDate(0, -1, 0)
+		return rollingRange(period, start, start.AddDate(0, -1, 0)), ""
+	}
+}
+
+// formatStatsDate formats one side of a range, or returns nil if it is open
+func formatStatsDate(date time.Time) *string {
+	if date.IsZero() {
+		return nil
+	}
+	formatted := date.Format("2006-01-02")
+	return &formatted
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+)
+
+// seedStartedSession stores a session that started at the given time, dated
+// on its day in that time's zone
+func seedStartedSession(t *testing.T, userID uuid.UUID, startedAt time.Time, minutes int) {
+	if err := database.DB.Create(&models.FocusSession{
+		UserID:       userID,
+		Date:         civilDate(startedAt),
+		StartedAt:    &startedAt,
+		Minutes:      minutes,
+		PointsEarned: minutes * 10,
+	}).Error; err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+}
+
+func TestSessionStatsHeatmapAndComparison(t *testing.T) {
+	router, user, _, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.GET("/sessions/stats", middleware.AuthMiddleware(), GetSessionStats)
+
+	taipei, _ := time.LoadLocation("Asia/Taipei")
+	day := func(daysAgo, hour, minute int) time.Time {
+		d := time.Now().In(taipei).AddDate(0, 0, -daysAgo)
+		return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, taipei)
+	}
+
+	// This week: yesterday morning and evening
+	morning := day(1, 9, 30)
+	seedStartedSession(t, user.ID, morning, 25)
+	seedStartedSession(t, user.ID, day(1, 21, 0), 50)
+	// The week before
+	seedStartedSession(t, user.ID, day(10, 14, 0), 50)
+	// A three-day streak a month ago
+	for daysAgo := 30; daysAgo >= 28; daysAgo-- {
+		seedStartedSession(t, user.ID, day(daysAgo, 8, 0), 25)
+	}
+
+	weekday := int(morning.Weekday()+6)%7 + 1
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		morningHour    int
+		eveningHour    int
+	}{
+		{
+			name:           "台北時間",
+			query:          "?period=week&tz=Asia/Taipei",
+			expectedStatus: 200,
+			morningHour:    9,
+			eveningHour:    21,
+		},
+		{
+			name:           "UTC",
+			query:          "?period=week&tz=UTC",
+			expectedStatus: 200,
+			morningHour:    1,
+			eveningHour:    13,
+		},
+		{
+			name:           "無效的時區",
+			query:          "?period=week&tz=Mars/Olympus",
+			expectedStatus: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats"+tt.query, token, nil)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedStatus != 200 {
+				testutil.AssertError(t, w, "VALIDATION_ERROR")
+				return
+			}
+
+			stats := testutil.GetResponseData(t, w).(map[string]interface{})
+			if stats["average_session_minutes"] != 37.5 || stats["longest_session_minutes"] != float64(50) {
+				t.Errorf("Expected average 37.5 and longest 50, got %v and %v", stats["average_session_minutes"], stats["longest_session_minutes"])
+			}
+			if stats["longest_streak"] != float64(3) {
+				t.Errorf("Expected the longest streak to be 3 days, got %v", stats["longest_streak"])
+			}
+
+			heatmap := stats["heatmap"].(map[string]interface{})
+			row := heatmap["minutes"].([]interface{})[weekday-1].([]interface{})
+			if row[tt.morningHour] != float64(25) || row[tt.eveningHour] != float64(50) {
+				t.Errorf("Expected 25 minutes at %d:00 and 50 at %d:00, got %v", tt.morningHour, tt.eveningHour, row)
+			}
+			day := heatmap["weekdays"].([]interface{})[weekday-1].(map[string]interface{})
+			if day["weekday"] != float64(weekday) || day["sessions"] != float64(2) || day["minutes"] != float64(75) {
+				t.Errorf("Expected 2 sessions and 75 minutes on weekday %d, got %v", weekday, day)
+			}
+			hour := heatmap["hours"].([]interface{})[tt.morningHour].(map[string]interface{})
+			if hour["sessions"] != float64(1) || hour["minutes"] != float64(25) {
+				t.Errorf("Expected one session at %d:00, got %v", tt.morningHour, hour)
+			}
+
+			comparison := stats["comparison"].(map[string]interface{})
+			previous := comparison["previous"].(map[string]interface{})
+			if previous["total_minutes"] != float64(50) || previous["total_sessions"] != float64(1) {
+				t.Errorf("Expected 50 minutes in the previous week, got %v", previous)
+			}
+			if comparison["minutes_change"] != float64(25) || comparison["minutes_change_percent"] != float64(50) {
+				t.Errorf("Expected 25 more minutes (+50%%), got %v", comparison)
+			}
+		})
+	}
+
+	// Lifetime has nothing to compare with
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats?period=lifetime", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	stats := testutil.GetResponseData(t, w).(map[string]interface{})
+	if stats["comparison"] != nil {
+		t.Errorf("Expected no comparison for lifetime, got %v", stats["comparison"])
+	}
+	if stats["longest_session_minutes"] != float64(50) {
+		t.Errorf("Expected the longest session to be 50 minutes, got %v", stats["longest_session_minutes"])
+	}
+}
+
+func TestSessionStatsFallBackToCreationTime(t *testing.T) {
+	router, user, _, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.GET("/sessions/stats", middleware.AuthMiddleware(), GetSessionStats)
+
+	// Sessions from before start times were tracked ended when saved
+	session := testutil.CreateTestFocusSession(database.DB, user.ID, nil, nil, 30)
+	database.DB.Model(session).Update("started_at", nil)
+	database.DB.First(session, session.ID)
+	started := session.CreatedAt.Add(-30 * time.Minute).UTC()
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats?period=week&tz=UTC", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	heatmap := testutil.GetResponseData(t, w).(map[string]interface{})["heatmap"].(map[string]interface{})
+	weekday := int(started.Weekday()+6)%7 + 1
+	row := heatmap["minutes"].([]interface{})[weekday-1].([]interface{})
+	if row[started.Hour()] != float64(30) {
+		t.Errorf("Expected 30 minutes at %d:00 UTC, got %v", started.Hour(), row)
+	}
+}
+
+func TestSessionStatsDateRangeAndGrouping(t *testing.T) {
+	router, user, course, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.GET("/sessions/stats", middleware.AuthMiddleware(), GetSessionStats)
+
+	seed := func(date string, withCourse bool, location string, minutes int) {
+		d, _ := time.Parse("2006-01-02", date)
+		session := models.FocusSession{UserID: user.ID, Date: d, Minutes: minutes, PointsEarned: minutes * 10, Location: location}
+		if withCourse {
+			session.CourseID = &course.ID
+		}
+		if err := database.DB.Create(&session).Error; err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	seed("2025-03-03", true, "圖書館", 25)
+	seed("2025-03-05", false, "", 50)
+	seed("2025-03-10", true, "圖書館", 25)
+	seed("2025-03-31", true, "宿舍", 100)
+	// Outside the range: one in the previous 31 days, one after
+	seed("2025-02-28", true, "宿舍", 40)
+	seed("2025-04-02", true, "宿舍", 60)
+
+	courseID := course.ID.String()
+	tests := []struct {
+		groupBy string
+		keys    []string
+		labels  []string
+		minutes []int
+	}{
+		{"day", []string{"2025-03-03", "2025-03-05", "2025-03-10", "2025-03-31"}, []string{"2025-03-03", "2025-03-05", "2025-03-10", "2025-03-31"}, []int{25, 50, 25, 100}},
+		{"week", []string{"2025-03-03", "2025-03-10", "2025-03-31"}, []string{"2025-W10", "2025-W11", "2025-W14"}, []int{75, 25, 100}},
+		{"month", []string{"2025-03"}, []string{"2025-03"}, []int{200}},
+		{"course", []string{courseID, ""}, []string{course.Name, "未分類"}, []int{150, 50}},
+		{"location", []string{"宿舍", "", "圖書館"}, []string{"宿舍", "未填寫", "圖書館"}, []int{100, 50, 50}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats?start_date=2025-03-01&end_date=2025-03-31&group_by="+tt.groupBy, token, nil)
+			testutil.AssertStatusCode(t, w, 200)
+
+			stats := testutil.GetResponseData(t, w).(map[string]interface{})
+			if stats["period"] != "custom" || stats["start_date"] != "2025-03-01" || stats["end_date"] != "2025-03-31" || stats["group_by"] != tt.groupBy {
+				t.Errorf("Expected the custom range grouped by %s, got %v", tt.groupBy, stats)
+			}
+			if stats["total_sessions"] != float64(4) || stats["total_minutes"] != float64(200) {
+				t.Errorf("Expected 4 sessions and 200 minutes, got %v and %v", stats["total_sessions"], stats["total_minutes"])
+			}
+
+			breakdown := stats["breakdown"].([]interface{})
+			if len(breakdown) != len(tt.keys) {
+				t.Fatalf("Expected %d groups, got %v", len(tt.keys), breakdown)
+			}
+			sum := 0.0
+			for i, entry := range breakdown {
+				group := entry.(map[string]interface{})
+				if group["key"] != tt.keys[i] || group["label"] != tt.labels[i] || group["minutes"] != float64(tt.minutes[i]) {
+					t.Errorf("Expected group %d to be %s (%s) with %d minutes, got %v", i, tt.keys[i], tt.labels[i], tt.minutes[i], group)
+				}
+				if group["points"] != float64(tt.minutes[i]*10) || group["percentage"] != float64(tt.minutes[i])/2 {
+					t.Errorf("Expected %d points and %v%%, got %v", tt.minutes[i]*10, float64(tt.minutes[i])/2, group)
+				}
+				sum += group["minutes"].(float64)
+			}
+			if sum != stats["total_minutes"] {
+				t.Errorf("Expected the groups to add up to %v minutes, got %v", stats["total_minutes"], sum)
+			}
+
+			// Compared with the 31 days before
+			comparison := stats["comparison"].(map[string]interface{})
+			if comparison["previous_start"] != "2025-01-29" || comparison["previous_end"] != "2025-02-28" {
+				t.Errorf("Expected the previous range to be 2025-01-29 to 2025-02-28, got %v", comparison)
+			}
+			if comparison["previous"].(map[string]interface{})["total_minutes"] != float64(40) {
+				t.Errorf("Expected 40 minutes in the previous range, got %v", comparison["previous"])
+			}
+		})
+	}
+}
+
+func TestSessionStatsCalendarPeriods(t *testing.T) {
+	router, _, _, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.GET("/sessions/stats", middleware.AuthMiddleware(), GetSessionStats)
+
+	today := civilDate(time.Now().UTC())
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	firstOfMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		period        string
+		start         time.Time
+		end           time.Time
+		previousStart time.Time
+	}{
+		{"this_week", monday, monday.AddDate(0, 0, 6), monday.AddDate(0, 0, -7)},
+		{"last_week", monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1), monday.AddDate(0, 0, -14)},
+		{"this_month", firstOfMonth, firstOfMonth.AddDate(0, 1, -1), firstOfMonth.AddDate(0, -1, 0)},
+		{"last_month", firstOfMonth.AddDate(0, -1, 0), firstOfMonth.AddDate(0, 0, -1), firstOfMonth.AddDate(0, -2, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats?tz=UTC&period="+tt.period, token, nil)
+			testutil.AssertStatusCode(t, w, 200)
+
+			stats := testutil.GetResponseData(t, w).(map[string]interface{})
+			if stats["start_date"] != tt.start.Format("2006-01-02") || stats["end_date"] != tt.end.Format("2006-01-02") {
+				t.Errorf("Expected %s to %s, got %v to %v", tt.start.Format("2006-01-02"), tt.end.Format("2006-01-02"), stats["start_date"], stats["end_date"])
+			}
+			comparison := stats["comparison"].(map[string]interface{})
+			if comparison["previous_start"] != tt.previousStart.Format("2006-01-02") || comparison["previous_end"] != tt.start.AddDate(0, 0, -1).Format("2006-01-02") {
+				t.Errorf("Expected the previous period to start on %s, got %v", tt.previousStart.Format("2006-01-02"), comparison)
+			}
+			if breakdown := stats["breakdown"].([]interface{}); len(breakdown) != 0 {
+				t.Errorf("Expected an empty breakdown, got %v", breakdown)
+			}
+		})
+	}
+
+	// Rolling periods have no end
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats?period=week", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	if stats := testutil.GetResponseData(t, w).(map[string]interface{}); stats["end_date"] != nil || stats["group_by"] != "day" {
+		t.Errorf("Expected an open range grouped by day, got %v", stats)
+	}
+
+	for name, query := range map[string]string{
+		"只有開始日期":   "?start_date=2025-03-01",
+		"日期格式錯誤":   "?start_date=2025/03/01&end_date=2025-03-31",
+		"結束早於開始":   "?start_date=2025-03-31&end_date=2025-03-01",
+		"不支援的分組方式": "?group_by=hour",
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats"+query, token, nil)
+			testutil.AssertStatusCode(t, w, 400)
+			testutil.AssertError(t, w, "VALIDATION_ERROR")
+		})
+	}
+}
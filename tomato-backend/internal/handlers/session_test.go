@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/yourusername/tomato-backend/internal/config"
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
@@ -31,11 +32,11 @@ func setupSessionTests(t *testing.T) (*gin.Engine, *models.User, *models.Course,
 	// Create test data
 	school := testutil.CreateTestSchool(db, "測試大學")
 	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
-	course := testutil.CreateTestCourse(db, user.ID, "數學", "#3b82f6", 3)
+	course := testutil.CreateTestCourse(db, user.ID, "數學", "#3b82f6")
 	plan := testutil.CreateTestStudyPlan(db, user.ID, &course.ID, "測試計畫", 120)
 
 	// Generate token
-	token, _ := utils.GenerateToken(user.ID.String(), user.Email)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
 
 	// Cleanup function
 	cleanup := func() {
@@ -279,8 +280,7 @@ func TestGetSessionStats(t *testing.T) {
 
 	router.GET("/sessions/stats", middleware.AuthMiddleware(), GetSessionStats)
 
-	// Create test sessions with different dates
-	today := time.Now()
+	// Create test sessions
 	testutil.CreateTestFocusSession(database.DB, user.ID, &plan.ID, &course.ID, 25)
 	testutil.CreateTestFocusSession(database.DB, user.ID, &plan.ID, &course.ID, 30)
 
@@ -376,7 +376,7 @@ func TestGetSessionStats(t *testing.T) {
 }
 
 func TestSessionTransactionRollback(t *testing.T) {
-	router, user, course, plan, token, cleanup := setupSessionTests(t)
+	router, user, _, plan, token, cleanup := setupSessionTests(t)
 	defer cleanup()
 
 	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
@@ -398,6 +398,9 @@ func TestSessionTransactionRollback(t *testing.T) {
 	}
 
 	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, requestBody)
+	if w.Code < 400 {
+		t.Errorf("Expected the session to be rejected, got %d", w.Code)
+	}
 
 	// Verify user points didn't change (transaction rolled back)
 	var userAfter models.User
@@ -416,6 +419,48 @@ func TestSessionTransactionRollback(t *testing.T) {
 	}
 }
 
+func TestCreateSessionRejectsOthersPlansAndCourses(t *testing.T) {
+	router, user, _, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
+
+	other := testutil.CreateTestUser(database.DB, "other@example.com", "password123", "其他用戶", user.SchoolID)
+	otherCourse := testutil.CreateTestCourse(database.DB, other.ID, "英文", "#ef4444")
+	otherPlan := testutil.CreateTestStudyPlan(database.DB, other.ID, &otherCourse.ID, "背單字", 25)
+
+	tests := []struct {
+		name        string
+		requestBody map[string]interface{}
+	}{
+		{name: "別人的計畫", requestBody: map[string]interface{}{"plan_id": otherPlan.ID.String()}},
+		{name: "別人的課程", requestBody: map[string]interface{}{"course_id": otherCourse.ID.String()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.requestBody["date"] = time.Now().Format("2006-01-02")
+			tt.requestBody["minutes"] = 25
+
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, 404)
+			testutil.AssertError(t, w, "NOT_FOUND")
+		})
+	}
+
+	// The other user's plan is untouched and no session was recorded
+	var plan models.StudyPlan
+	database.DB.First(&plan, otherPlan.ID)
+	if plan.CompletedMinutes != 0 || plan.Completed {
+		t.Errorf("Expected the other user's plan to be untouched, got %+v", plan)
+	}
+	var count int64
+	database.DB.Model(&models.FocusSession{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no sessions, got %d", count)
+	}
+}
+
 func TestPlanAutoCompletion(t *testing.T) {
 	router, user, course, _, token, cleanup := setupSessionTests(t)
 	defer cleanup()
@@ -537,3 +582,192 @@ func TestSessionFlow(t *testing.T) {
 
 	fmt.Println("✓ Complete session flow test passed")
 }
+
+func TestCreateSessionIdempotency(t *testing.T) {
+	router, user, course, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.POST("/sessions", middleware.AuthMiddleware(), middleware.Idempotency(), CreateSession)
+
+	requestBody := map[string]interface{}{
+		"course_id": course.ID.String(),
+		"date":      time.Now().Format("2006-01-02"),
+		"minutes":   25,
+	}
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		"Idempotency-Key": "retry-test-key",
+	}
+
+	// Same key sent three times should only award points once
+	var firstBody string
+	for i := 0; i < 3; i++ {
+		w := testutil.MakeRequest(t, router, "POST", "/sessions", requestBody, headers)
+		testutil.AssertStatusCode(t, w, 201)
+
+		if i == 0 {
+			firstBody = w.Body.String()
+			continue
+		}
+		if w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("Expected retried request to be replayed")
+		}
+		if w.Body.String() != firstBody {
+			t.Error("Replayed response should match the original response")
+		}
+	}
+
+	var sessionCount int64
+	database.DB.Model(&models.FocusSession{}).Where("user_id = ?", user.ID).Count(&sessionCount)
+	if sessionCount != 1 {
+		t.Errorf("Expected 1 session, got %d", sessionCount)
+	}
+
+	var userAfter models.User
+	database.DB.First(&userAfter, user.ID)
+	expectedPoints := 25 * config.AppConfig.Points.BasePointsPerMinute
+	if userAfter.TotalPoints != expectedPoints {
+		t.Errorf("Expected %d points, got %d", expectedPoints, userAfter.TotalPoints)
+	}
+
+	// Reusing the key with a different payload is rejected
+	requestBody["minutes"] = 50
+	w := testutil.MakeRequest(t, router, "POST", "/sessions", requestBody, headers)
+	testutil.AssertStatusCode(t, w, 422)
+	testutil.AssertError(t, w, "IDEMPOTENCY_KEY_REUSED")
+
+	// A different key creates a new session
+	headers["Idempotency-Key"] = "another-key"
+	w = testutil.MakeRequest(t, router, "POST", "/sessions", requestBody, headers)
+	testutil.AssertStatusCode(t, w, 201)
+	if w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("New key should not be replayed")
+	}
+}
+
+func TestIdempotencyLeaseTakeover(t *testing.T) {
+	router, user, course, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.POST("/sessions", middleware.AuthMiddleware(), middleware.Idempotency(), CreateSession)
+
+	requestBody := map[string]interface{}{
+		"course_id": course.ID.String(),
+		"date":      time.Now().Format("2006-01-02"),
+		"minutes":   25,
+	}
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		"Idempotency-Key": "crash-test-key",
+	}
+
+	w := testutil.MakeRequest(t, router, "POST", "/sessions", requestBody, headers)
+	testutil.AssertStatusCode(t, w, 201)
+
+	// Pretend the first request crashed: its session was rolled back and its
+	// claim was never completed
+	database.DB.Where("user_id = ?", user.ID).Delete(&models.FocusSession{})
+	claim := database.DB.Model(&models.IdempotencyKey{}).Where("user_id = ? AND key = ?", user.ID, "crash-test-key")
+	claim.Updates(map[string]interface{}{"status_code": 0, "response_body": nil, "locked_until": time.Now().Add(time.Minute)})
+
+	// Still leased
+	w = testutil.MakeRequest(t, router, "POST", "/sessions", requestBody, headers)
+	testutil.AssertStatusCode(t, w, 409)
+
+	// The lease ran out, so the retry takes over
+	database.DB.Model(&models.IdempotencyKey{}).Where("user_id = ? AND key = ?", user.ID, "crash-test-key").
+		Update("locked_until", time.Now().Add(-time.Second))
+	w = testutil.MakeRequest(t, router, "POST", "/sessions", requestBody, headers)
+	testutil.AssertStatusCode(t, w, 201)
+	if w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Expected the retry to run rather than be replayed")
+	}
+
+	var record models.IdempotencyKey
+	database.DB.Where("user_id = ? AND key = ?", user.ID, "crash-test-key").First(&record)
+	if record.StatusCode != 201 {
+		t.Errorf("Expected the retry to complete the key, got status %d", record.StatusCode)
+	}
+
+	var sessionCount int64
+	database.DB.Model(&models.FocusSession{}).Where("user_id = ?", user.ID).Count(&sessionCount)
+	if sessionCount != 1 {
+		t.Errorf("Expected 1 session, got %d", sessionCount)
+	}
+}
+
+func TestCreateSessionReportsLevelUp(t *testing.T) {
+	router, _, course, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
+	config.AppConfig.Points.BasePointsPerMinute = 10
+	config.AppConfig.Levels = config.LevelConfig{BasePoints: 500, Growth: 1.2, MaxLevel: 100}
+
+	createSession := func(minutes int) map[string]interface{} {
+		w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+			"course_id": course.ID.String(),
+			"date":      time.Now().Format("2006-01-02"),
+			"minutes":   minutes,
+		})
+		testutil.AssertStatusCode(t, w, 201)
+
+		var response utils.Response
+		testutil.ParseResponse(t, w, &response)
+		return response.Data.(map[string]interface{})
+	}
+
+	// 450 points: still level 1
+	data := createSession(45)
+	if data["id"] == nil || data["minutes"] != float64(45) {
+		t.Errorf("Expected the session in the response, got %v", data)
+	}
+	if data["level_up"] != nil {
+		t.Errorf("Expected no level-up, got %v", data["level_up"])
+	}
+	if level := data["level"].(map[string]interface{}); level["level"] != float64(1) || level["points_to_next_level"] != float64(50) {
+		t.Errorf("Expected level 1 with 50 points to go, got %v", level)
+	}
+
+	// 550 points: level 2
+	data = createSession(10)
+	levelUp, ok := data["level_up"].(map[string]interface{})
+	if !ok || levelUp["from"] != float64(1) || levelUp["to"] != float64(2) {
+		t.Errorf("Expected level-up from 1 to 2, got %v", data["level_up"])
+	}
+}
+
+func TestCreateSessionStartedAt(t *testing.T) {
+	router, _, _, _, token, cleanup := setupSessionTests(t)
+	defer cleanup()
+
+	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
+	today := time.Now().Format("2006-01-02")
+
+	// Without a start time the session is taken to have just ended
+	before := time.Now()
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+		"date": today, "minutes": 25,
+	})
+	testutil.AssertStatusCode(t, w, 201)
+	var session models.FocusSession
+	database.DB.Order("created_at DESC").First(&session)
+	if session.StartedAt == nil || session.StartedAt.Before(before.Add(-26*time.Minute)) || session.StartedAt.After(time.Now().Add(-25*time.Minute)) {
+		t.Errorf("Expected the session to start 25 minutes ago, got %v", session.StartedAt)
+	}
+
+	startedAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+		"date": today, "minutes": 50, "started_at": startedAt.Format(time.RFC3339),
+	})
+	testutil.AssertStatusCode(t, w, 201)
+	database.DB.Order("created_at DESC").First(&session)
+	if session.StartedAt == nil || !session.StartedAt.Equal(startedAt) {
+		t.Errorf("Expected the given start time %v, got %v", startedAt, session.StartedAt)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+		"date": today, "minutes": 25, "started_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	testutil.AssertStatusCode(t, w, 400)
+}
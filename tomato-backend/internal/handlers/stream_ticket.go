@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+// streamTicketTTL is how long a stream ticket can be redeemed
+const streamTicketTTL = 30 * time.Second
+
+// CreateStreamTicket issues a single-use ticket for opening a WebSocket
+// connection or an event stream. Browsers can't set headers on those, so the
+// ticket is passed as the ticket query parameter instead of the access token.
+func CreateStreamTicket(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	ticket, err := utils.GenerateRandomToken()
+	if err != nil {
+		utils.InternalErrorResponse(c, "產生連線票證失敗")
+		return
+	}
+
+	expiresAt := time.Now().Add(streamTicketTTL)
+	if err := database.DB.Create(&models.UserToken{
+		UserID:    userID,
+		Purpose:   models.TokenPurposeStreamTicket,
+		TokenHash: utils.HashToken(ticket),
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		utils.InternalErrorResponse(c, "產生連線票證失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	}, "")
+}
@@ -0,0 +1,676 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxGroupMembers caps group size so leaderboards stay personal
+	maxGroupMembers  = 50
+	inviteCodeLength = 8
+)
+
+var (
+	ErrAlreadyGroupMember = errors.New("already a member of the group")
+	ErrGroupFull          = errors.New("group is full")
+)
+
+type CreateGroupRequest struct {
+	Name              string `json:"name" binding:"required"`
+	Description       string `json:"description"`
+	WeeklyGoalMinutes *int   `json:"weekly_goal_minutes"`
+}
+
+type UpdateGroupRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	// WeeklyGoalMinutes sets the goal; 0 removes it
+	WeeklyGoalMinutes *int `json:"weekly_goal_minutes"`
+}
+
+type JoinGroupRequest struct {
+	InviteCode string `json:"invite_code" binding:"required"`
+}
+
+// GroupMemberResponse is a member as shown to the rest of the group. Emails
+// are not shared.
+type GroupMemberResponse struct {
+	UserID    uuid.UUID        `json:"user_id"`
+	Name      string           `json:"name"`
+	AvatarURL string           `json:"avatar_url"`
+	Role      models.GroupRole `json:"role"`
+	JoinedAt  time.Time        `json:"joined_at"`
+}
+
+// GroupProgress is the members' combined focus time this week against the
+// group goal
+type GroupProgress struct {
+	WeekStart   time.Time `json:"week_start"`
+	WeekEnd     time.Time `json:"week_end"`
+	Minutes     int       `json:"minutes"`
+	GoalMinutes *int      `json:"goal_minutes"`
+	// Progress is Minutes over GoalMinutes, capped at 1, or nil without a goal
+	Progress    *float64 `json:"progress"`
+	GoalReached bool     `json:"goal_reached"`
+}
+
+type GroupResponse struct {
+	models.StudyGroup
+	MemberCount int                   `json:"member_count"`
+	Members     []GroupMemberResponse `json:"members,omitempty"`
+	Progress    GroupProgress         `json:"progress"`
+}
+
+// GroupLeaderboardEntry is a member's focus in the leaderboard period
+type GroupLeaderboardEntry struct {
+	Rank      int       `json:"rank"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	AvatarURL string    `json:"avatar_url"`
+	Minutes   int       `json:"minutes"`
+	Sessions  int       `json:"sessions"`
+	Points    int       `json:"points"`
+}
+
+// GroupActivity is a focus session of a member
+type GroupActivity struct {
+	SessionID uuid.UUID `json:"session_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	AvatarURL string    `json:"avatar_url"`
+	Minutes   int       `json:"minutes"`
+	Date      time.Time `json:"date"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// validGroupGoal reports whether a weekly goal is within one week
+func validGroupGoal(minutes *int) bool {
+	return minutes == nil || (*minutes >= 0 && *minutes <= 7*24*60)
+}
+
+// loadGroupMembership loads the group in the id parameter and the current
+// user's membership in it. Groups the user is not in are reported as
+// missing.
+func loadGroupMembership(c *gin.Context) (*models.StudyGroup, *models.StudyGroupMember, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return nil, nil, false
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的群組 ID")
+		return nil, nil, false
+	}
+
+	var member models.StudyGroupMember
+	if err := database.DB.Preload("Group").
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		First(&member).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "群組不存在")
+			return nil, nil, false
+		}
+		utils.InternalErrorResponse(c, "查詢群組失敗")
+		return nil, nil, false
+	}
+
+	return member.Group, &member, true
+}
+
+// groupMembers lists the group's members, owner first
+func groupMembers(db *gorm.DB, groupID uuid.UUID) ([]GroupMemberResponse, error) {
+	var members []GroupMemberResponse
+	err := db.Table("study_group_members m").
+		Select("m.user_id, u.name, u.avatar_url, m.role, m.joined_at").
+		Joins("JOIN users u ON u.id = m.user_id").
+		Where("m.group_id = ?", groupID).
+		Order("m.role = 'owner' DESC, m.joined_at, m.user_id").
+		Scan(&members).Error
+	return members, err
+}
+
+// groupProgress sums the focus minutes of the group's current members in the
+// week containing now
+func groupProgress(db *gorm.DB, group *models.StudyGroup, now time.Time) (GroupProgress, error) {
+	start, end := seasonBounds(models.SeasonWeekly, now)
+	progress := GroupProgress{WeekStart: start, WeekEnd: end}
+
+	if err := db.Table("focus_sessions fs").
+		Joins("JOIN study_group_members m ON m.user_id = fs.user_id").
+		Where("m.group_id = ? AND fs.date BETWEEN ? AND ?", group.ID, start.Format("2006-01-02"), end.Format("2006-01-02")).
+		Select("COALESCE(SUM(fs.minutes), 0)").
+		Scan(&progress.Minutes).Error; err != nil {
+		return progress, err
+	}
+
+	if group.WeeklyGoalMinutes != nil && *group.WeeklyGoalMinutes > 0 {
+		goal := *group.WeeklyGoalMinutes
+		ratio := float64(progress.Minutes) / float64(goal)
+		if ratio > 1 {
+			ratio = 1
+		}
+		progress.GoalMinutes = &goal
+		progress.Progress = &ratio
+		progress.GoalReached = progress.Minutes >= goal
+	}
+	return progress, nil
+}
+
+// groupResponse builds the response for a group, with its members if
+// withMembers is set
+func groupResponse(db *gorm.DB, group *models.StudyGroup, withMembers bool) (*GroupResponse, error) {
+	response := &GroupResponse{StudyGroup: *group}
+
+	var count int64
+	if err := db.Model(&models.StudyGroupMember{}).Where("group_id = ?", group.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	response.MemberCount = int(count)
+
+	if withMembers {
+		members, err := groupMembers(db, group.ID)
+		if err != nil {
+			return nil, err
+		}
+		response.Members = members
+	}
+
+	progress, err := groupProgress(db, group, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	response.Progress = progress
+	return response, nil
+}
+
+// leaveGroup removes the user from the group. An owner who leaves hands the
+// group to the longest-standing member; the last member leaving deletes it.
+func leaveGroup(tx *gorm.DB, groupID, userID uuid.UUID) error {
+	var group models.StudyGroup
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&group, groupID).Error; err != nil {
+		return err
+	}
+
+	result := tx.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.StudyGroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if group.OwnerID != userID {
+		return nil
+	}
+
+	var successor models.StudyGroupMember
+	err := tx.Where("group_id = ?", groupID).Order("joined_at, user_id").First(&successor).Error
+	if err == gorm.ErrRecordNotFound {
+		return tx.Delete(&group).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&successor).Update("role", models.GroupRoleOwner).Error; err != nil {
+		return err
+	}
+	return tx.Model(&group).Update("owner_id", successor.UserID).Error
+}
+
+// leaveAllGroups removes the user from every group, handing over the groups
+// they own, e.g. before their account is deleted
+func leaveAllGroups(tx *gorm.DB, userID uuid.UUID) error {
+	var groupIDs []uuid.UUID
+	if err := tx.Model(&models.StudyGroupMember{}).Where("user_id = ?", userID).Pluck("group_id", &groupIDs).Error; err != nil {
+		return err
+	}
+	for _, groupID := range groupIDs {
+		if err := leaveGroup(tx, groupID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateGroup creates a study group with the current user as owner
+func CreateGroup(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.ValidationErrorResponse(c, "群組名稱不可為空")
+		return
+	}
+	if !validGroupGoal(req.WeeklyGoalMinutes) {
+		utils.ValidationErrorResponse(c, "每週目標需介於 0 到 10080 分鐘")
+		return
+	}
+	if req.WeeklyGoalMinutes != nil && *req.WeeklyGoalMinutes == 0 {
+		req.WeeklyGoalMinutes = nil
+	}
+
+	code, err := utils.GenerateCode(inviteCodeLength)
+	if err != nil {
+		utils.InternalErrorResponse(c, "建立群組失敗")
+		return
+	}
+
+	group := models.StudyGroup{
+		Name:              name,
+		Description:       strings.TrimSpace(req.Description),
+		OwnerID:           userID,
+		InviteCode:        code,
+		WeeklyGoalMinutes: req.WeeklyGoalMinutes,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.StudyGroupMember{
+			GroupID:  group.ID,
+			UserID:   userID,
+			Role:     models.GroupRoleOwner,
+			JoinedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		utils.InternalErrorResponse(c, "建立群組失敗")
+		return
+	}
+
+	response, err := groupResponse(database.DB, &group, true)
+	if err != nil {
+		utils.InternalErrorResponse(c, "查詢群組失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, response, "群組已建立")
+}
+
+// GetMyGroups lists the groups the current user is in with their weekly
+// progress
+func GetMyGroups(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var groups []models.StudyGroup
+	if err := database.DB.
+		Joins("JOIN study_group_members m ON m.group_id = study_groups.id").
+		Where("m.user_id = ?", userID).
+		Order("m.joined_at DESC").
+		Find(&groups).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢群組失敗")
+		return
+	}
+
+	response := make([]*GroupResponse, len(groups))
+	for i := range groups {
+		group, err := groupResponse(database.DB, &groups[i], false)
+		if err != nil {
+			utils.InternalErrorResponse(c, "查詢群組失敗")
+			return
+		}
+		response[i] = group
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{"groups": response}, "")
+}
+
+// GetGroup returns a group with its members and weekly progress
+func GetGroup(c *gin.Context) {
+	group, _, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	response, err := groupResponse(database.DB, group, true)
+	if err != nil {
+		utils.InternalErrorResponse(c, "查詢群組失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, response, "")
+}
+
+// UpdateGroup changes a group's name, description or weekly goal. Only the
+// owner may do this.
+func UpdateGroup(c *gin.Context) {
+	group, member, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != models.GroupRoleOwner {
+		utils.ForbiddenResponse(c, "只有群組擁有者可以修改群組")
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	if !validGroupGoal(req.WeeklyGoalMinutes) {
+		utils.ValidationErrorResponse(c, "每週目標需介於 0 到 10080 分鐘")
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updates["name"] = name
+	}
+	if req.Description != nil {
+		updates["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.WeeklyGoalMinutes != nil {
+		if *req.WeeklyGoalMinutes == 0 {
+			updates["weekly_goal_minutes"] = nil
+		} else {
+			updates["weekly_goal_minutes"] = *req.WeeklyGoalMinutes
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(group).Updates(updates).Error; err != nil {
+			utils.InternalErrorResponse(c, "更新群組失敗")
+			return
+		}
+		database.DB.First(group, group.ID)
+	}
+
+	response, err := groupResponse(database.DB, group, true)
+	if err != nil {
+		utils.InternalErrorResponse(c, "查詢群組失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, response, "群組已更新")
+}
+
+// DeleteGroup deletes a group for all its members. Only the owner may do
+// this.
+func DeleteGroup(c *gin.Context) {
+	group, member, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != models.GroupRoleOwner {
+		utils.ForbiddenResponse(c, "只有群組擁有者可以刪除群組")
+		return
+	}
+
+	if err := database.DB.Delete(group).Error; err != nil {
+		utils.InternalErrorResponse(c, "刪除群組失敗")
+		return
+	}
+	focusRooms.CloseRoom(group.ID.String())
+
+	utils.SuccessResponse(c, 200, nil, "群組已刪除")
+}
+
+// JoinGroup adds the current user to the group with the invite code
+func JoinGroup(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req JoinGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(req.InviteCode))
+
+	var group models.StudyGroup
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the group serializes joins so the size limit holds
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("invite_code = ?", code).
+			First(&group).Error; err != nil {
+			return err
+		}
+
+		var members []models.StudyGroupMember
+		if err := tx.Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
+			return err
+		}
+		for _, m := range members {
+			if m.UserID == userID {
+				return ErrAlreadyGroupMember
+			}
+		}
+		if len(members) >= maxGroupMembers {
+			return ErrGroupFull
+		}
+
+		return tx.Create(&models.StudyGroupMember{
+			GroupID:  group.ID,
+			UserID:   userID,
+			JoinedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		switch err {
+		case gorm.ErrRecordNotFound:
+			utils.NotFoundResponse(c, "邀請碼無效")
+		case ErrAlreadyGroupMember:
+			utils.ConflictResponse(c, "你已經是此群組的成員")
+		case ErrGroupFull:
+			utils.ConflictResponse(c, "群組人數已滿")
+		default:
+			utils.InternalErrorResponse(c, "加入群組失敗")
+		}
+		return
+	}
+
+	response, err := groupResponse(database.DB, &group, true)
+	if err != nil {
+		utils.InternalErrorResponse(c, "查詢群組失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, response, "已加入群組")
+}
+
+// LeaveGroup removes the current user from a group. An owner hands the
+// group over to the longest-standing member.
+func LeaveGroup(c *gin.Context) {
+	group, member, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return leaveGroup(tx, group.ID, member.UserID)
+	}); err != nil {
+		utils.InternalErrorResponse(c, "退出群組失敗")
+		return
+	}
+	focusRooms.Kick(group.ID.String(), member.UserID)
+
+	utils.SuccessResponse(c, 200, nil, "已退出群組")
+}
+
+// RemoveGroupMember removes another member from a group. Only the owner may
+// do this.
+func RemoveGroupMember(c *gin.Context) {
+	group, member, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != models.GroupRoleOwner {
+		utils.ForbiddenResponse(c, "只有群組擁有者可以移除成員")
+		return
+	}
+
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的用戶 ID")
+		return
+	}
+	if targetID == member.UserID {
+		utils.ValidationErrorResponse(c, "無法移除自己，請改用退出群組")
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return leaveGroup(tx, group.ID, targetID)
+	}); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "此用戶不是群組成員")
+			return
+		}
+		utils.InternalErrorResponse(c, "移除成員失敗")
+		return
+	}
+	focusRooms.Kick(group.ID.String(), targetID)
+
+	utils.SuccessResponse(c, 200, nil, "已移除成員")
+}
+
+// RegenerateInviteCode replaces the group's invite code, e.g. after it was
+// shared too widely. Only the owner may do this.
+func RegenerateInviteCode(c *gin.Context) {
+	group, member, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != models.GroupRoleOwner {
+		utils.ForbiddenResponse(c, "只有群組擁有者可以更換邀請碼")
+		return
+	}
+
+	code, err := utils.GenerateCode(inviteCodeLength)
+	if err != nil {
+		utils.InternalErrorResponse(c, "更換邀請碼失敗")
+		return
+	}
+	if err := database.DB.Model(group).Update("invite_code", code).Error; err != nil {
+		utils.InternalErrorResponse(c, "更換邀請碼失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{"invite_code": code}, "邀請碼已更換")
+}
+
+// GetGroupLeaderboard ranks the group's members by focus minutes this week,
+// this month or in total (period=week|month|all). Members banned from the
+// leaderboards are left out.
+func GetGroupLeaderboard(c *gin.Context) {
+	group, _, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	// Sessions outside the period are excluded in the join so that members
+	// without any still get listed
+	sessionFilter := "fs.user_id = m.user_id"
+	var args []interface{}
+	period := c.DefaultQuery("period", "week")
+	switch period {
+	case "week", "month":
+		kind := models.SeasonWeekly
+		if period == "month" {
+			kind = models.SeasonMonthly
+		}
+		start, end := seasonBounds(kind, time.Now())
+		sessionFilter += " AND fs.date BETWEEN ? AND ?"
+		args = append(args, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	case "all":
+	default:
+		utils.ValidationErrorResponse(c, "無效的期間，可用值為 week、month、all")
+		return
+	}
+
+	var entries []GroupLeaderboardEntry
+	if err := database.DB.Table("study_group_members m").
+		Select(`m.user_id, u.name, u.avatar_url,
+			COALESCE(SUM(fs.minutes), 0) AS minutes,
+			COUNT(fs.id) AS sessions,
+			COALESCE(SUM(fs.points_earned), 0) AS points`).
+		Joins("JOIN users u ON u.id = m.user_id").
+		Joins("LEFT JOIN focus_sessions fs ON "+sessionFilter, args...).
+		Where("m.group_id = ? AND u.leaderboard_banned = ? AND u.email_verified_at IS NOT NULL", group.ID, false).
+		Group("m.user_id, u.name, u.avatar_url").
+		Order("minutes DESC, u.name").
+		Scan(&entries).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢群組排行榜失敗")
+		return
+	}
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Minutes == entries[i-1].Minutes {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"period":      period,
+		"leaderboard": entries,
+	}, "")
+}
+
+// GetGroupActivity lists the latest focus sessions of the group's members,
+// newest first. Pass the created_at of the last entry as before to page.
+func GetGroupActivity(c *gin.Context) {
+	group, _, ok := loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+
+	query := database.DB.Table("focus_sessions fs").
+		Select("fs.id AS session_id, fs.user_id, u.name, u.avatar_url, fs.minutes, fs.date, fs.created_at").
+		Joins("JOIN study_group_members m ON m.user_id = fs.user_id AND m.group_id = ?", group.ID).
+		Joins("JOIN users u ON u.id = fs.user_id")
+	if before := c.Query("before"); before != "" {
+		t, err := time.Parse(time.RFC3339Nano, before)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "無效的時間格式，請使用 RFC 3339")
+			return
+		}
+		query = query.Where("fs.created_at < ?", t)
+	}
+
+	var activity []GroupActivity
+	if err := query.Order("fs.created_at DESC").Limit(limit).Scan(&activity).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢群組動態失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{"activity": activity}, "")
+}
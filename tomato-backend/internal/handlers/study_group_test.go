@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/focusroom"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+type groupFixture struct {
+	owner         *models.User
+	member        *models.User
+	outsider      *models.User
+	ownerToken    string
+	memberToken   string
+	outsiderToken string
+}
+
+func setupGroupTests(t *testing.T) (*gin.Engine, *groupFixture, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Removing members disconnects them from the group's focus room
+	focusRooms = focusroom.NewHub(recordRoomPomodoro)
+	stopFocusRooms := StartFocusRooms()
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	groups := router.Group("/groups")
+	groups.Use(middleware.AuthMiddleware())
+	groups.GET("", GetMyGroups)
+	groups.POST("", CreateGroup)
+	groups.POST("/join", JoinGroup)
+	groups.GET("/:id", GetGroup)
+	groups.PUT("/:id", UpdateGroup)
+	groups.DELETE("/:id", DeleteGroup)
+	groups.POST("/:id/leave", LeaveGroup)
+	groups.DELETE("/:id/members/:userId", RemoveGroupMember)
+	groups.POST("/:id/invite-code", RegenerateInviteCode)
+	groups.GET("/:id/leaderboard", GetGroupLeaderboard)
+	groups.GET("/:id/activity", GetGroupActivity)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	f := &groupFixture{}
+	f.owner = testutil.CreateTestUser(db, "owner@example.com", "password123", "組長", &school.ID)
+	f.member = testutil.CreateTestUser(db, "member@example.com", "password123", "組員", &school.ID)
+	f.outsider = testutil.CreateTestUser(db, "outsider@example.com", "password123", "路人", &school.ID)
+	f.ownerToken, _, _ = utils.GenerateSessionTokens(f.owner, uuid.Nil)
+	f.memberToken, _, _ = utils.GenerateSessionTokens(f.member, uuid.Nil)
+	f.outsiderToken, _, _ = utils.GenerateSessionTokens(f.outsider, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		stopFocusRooms()
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, f, cleanup
+}
+
+// createGroup creates a group as the owner and has the member join it
+func createGroup(t *testing.T, router *gin.Engine, f *groupFixture, body map[string]interface{}) map[string]interface{} {
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/groups", f.ownerToken, body)
+	testutil.AssertStatusCode(t, w, 201)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	group := response.Data.(map[string]interface{})
+
+	code := strings.ToLower(group["invite_code"].(string))
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/groups/join", f.memberToken, map[string]interface{}{"invite_code": code})
+	testutil.AssertStatusCode(t, w, 200)
+
+	return group
+}
+
+func TestGroupProgressAndLeaderboard(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "微積分讀書會", "weekly_goal_minutes": 120})
+	path := "/groups/" + group["id"].(string)
+
+	testutil.CreateTestFocusSession(database.DB, f.owner.ID, nil, nil, 50)
+	testutil.CreateTestFocusSession(database.DB, f.member.ID, nil, nil, 90)
+	seedSession(t, f.member.ID, nil, 40, 500)
+	testutil.CreateTestFocusSession(database.DB, f.outsider.ID, nil, nil, 300)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", path, f.memberToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	data := response.Data.(map[string]interface{})
+	if data["member_count"] != float64(2) {
+		t.Errorf("Expected 2 members, got %v", data["member_count"])
+	}
+	for _, m := range data["members"].([]interface{}) {
+		if _, ok := m.(map[string]interface{})["email"]; ok {
+			t.Error("Expected member emails not to be shared")
+		}
+	}
+	progress := data["progress"].(map[string]interface{})
+	if progress["minutes"] != float64(140) || progress["goal_reached"] != true || progress["progress"] != float64(1) {
+		t.Errorf("Expected 140 of 120 minutes reached, got %v", progress)
+	}
+
+	tests := []struct {
+		period          string
+		expectedStatus  int
+		expectedLeader  string
+		expectedMinutes float64
+	}{
+		{period: "week", expectedStatus: 200, expectedLeader: "組員", expectedMinutes: 90},
+		{period: "all", expectedStatus: 200, expectedLeader: "組員", expectedMinutes: 590},
+		{period: "year", expectedStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "GET", path+"/leaderboard?period="+tt.period, f.ownerToken, nil)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedStatus != 200 {
+				return
+			}
+
+			var response utils.Response
+			testutil.ParseResponse(t, w, &response)
+			entries := response.Data.(map[string]interface{})["leaderboard"].([]interface{})
+			if len(entries) != 2 {
+				t.Fatalf("Expected both members ranked, got %d", len(entries))
+			}
+			leader := entries[0].(map[string]interface{})
+			if leader["name"] != tt.expectedLeader || leader["minutes"] != tt.expectedMinutes || leader["rank"] != float64(1) {
+				t.Errorf("Expected %s first with %v minutes, got %v", tt.expectedLeader, tt.expectedMinutes, leader)
+			}
+		})
+	}
+
+	// Members banned from the leaderboards aren't ranked
+	database.DB.Model(f.member).Update("leaderboard_banned", true)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", path+"/leaderboard?period=all", f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.ParseResponse(t, w, &response)
+	entries := response.Data.(map[string]interface{})["leaderboard"].([]interface{})
+	if len(entries) != 1 || entries[0].(map[string]interface{})["name"] != "組長" {
+		t.Errorf("Expected only the owner ranked, got %v", entries)
+	}
+
+	// Neither are unverified members
+	database.DB.Model(f.member).Update("leaderboard_banned", false)
+	database.DB.Model(f.member).Update("email_verified_at", nil)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", path+"/leaderboard?period=all", f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.ParseResponse(t, w, &response)
+	entries = response.Data.(map[string]interface{})["leaderboard"].([]interface{})
+	if len(entries) != 1 || entries[0].(map[string]interface{})["name"] != "組長" {
+		t.Errorf("Expected only the verified owner ranked, got %v", entries)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", path+"/activity", f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.ParseResponse(t, w, &response)
+	if activity := response.Data.(map[string]interface{})["activity"].([]interface{}); len(activity) != 3 {
+		t.Errorf("Expected 3 member sessions in the activity feed, got %d", len(activity))
+	}
+
+	// Outsiders can't see the group
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", path+"/activity", f.outsiderToken, nil)
+	testutil.AssertStatusCode(t, w, 404)
+}
+
+func TestJoinGroup(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "讀書會"})
+	code := group["invite_code"].(string)
+
+	tests := []struct {
+		name           string
+		token          string
+		code           string
+		expectedStatus int
+	}{
+		{name: "已是成員", token: f.memberToken, code: code, expectedStatus: 409},
+		{name: "無效的邀請碼", token: f.outsiderToken, code: "ZZZZZZZZ", expectedStatus: 404},
+		{name: "成功加入", token: f.outsiderToken, code: " " + code + " ", expectedStatus: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/groups/join", tt.token, map[string]interface{}{"invite_code": tt.code})
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+		})
+	}
+
+	// A new invite code retires the old one
+	path := "/groups/" + group["id"].(string)
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", path+"/invite-code", f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	late := testutil.CreateTestUser(database.DB, "late@example.com", "password123", "遲到", nil)
+	lateToken, _, _ := utils.GenerateSessionTokens(late, uuid.Nil)
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/groups/join", lateToken, map[string]interface{}{"invite_code": code})
+	testutil.AssertStatusCode(t, w, 404)
+}
+
+func TestGroupOwnerOnlyActions(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "讀書會"})
+	path := "/groups/" + group["id"].(string)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		requestBody interface{}
+	}{
+		{name: "修改群組", method: "PUT", path: path, requestBody: map[string]interface{}{"name": "改名"}},
+		{name: "刪除群組", method: "DELETE", path: path},
+		{name: "移除成員", method: "DELETE", path: path + "/members/" + f.owner.ID.String()},
+		{name: "更換邀請碼", method: "POST", path: path + "/invite-code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeAuthenticatedRequest(t, router, tt.method, tt.path, f.memberToken, tt.requestBody)
+			testutil.AssertStatusCode(t, w, 403)
+		})
+	}
+
+	// The owner sets and clears the goal
+	w := testutil.MakeAuthenticatedRequest(t, router, "PUT", path, f.ownerToken, map[string]interface{}{"weekly_goal_minutes": 600})
+	testutil.AssertStatusCode(t, w, 200)
+	w = testutil.MakeAuthenticatedRequest(t, router, "PUT", path, f.ownerToken, map[string]interface{}{"weekly_goal_minutes": 0})
+	testutil.AssertStatusCode(t, w, 200)
+
+	var stored models.StudyGroup
+	database.DB.First(&stored, "id = ?", group["id"])
+	if stored.WeeklyGoalMinutes != nil {
+		t.Errorf("Expected the goal to be cleared, got %d", *stored.WeeklyGoalMinutes)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", path+"/members/"+f.member.ID.String(), f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", path, f.memberToken, nil)
+	testutil.AssertStatusCode(t, w, 404)
+}
+
+func TestOwnerLeavingHandsOverGroup(t *testing.T) {
+	router, f, cleanup := setupGroupTests(t)
+	defer cleanup()
+
+	group := createGroup(t, router, f, map[string]interface{}{"name": "讀書會"})
+	path := "/groups/" + group["id"].(string)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", path+"/leave", f.ownerToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var stored models.StudyGroup
+	database.DB.First(&stored, "id = ?", group["id"])
+	if stored.OwnerID != f.member.ID {
+		t.Fatalf("Expected the member to own the group, got %s", stored.OwnerID)
+	}
+
+	// The new owner's account is deleted and nobody is left
+	database.DB.Model(f.member).Update("deletion_scheduled_at", time.Now().Add(-time.Hour))
+	if deleted, err := purgeAccount(f.member.ID, time.Now()); err != nil || !deleted {
+		t.Fatalf("purgeAccount failed: %v", err)
+	}
+
+	var count int64
+	database.DB.Model(&models.StudyGroup{}).Where("id = ?", stored.ID).Count(&count)
+	if count != 0 {
+		t.Error("Expected the empty group to be deleted")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/outbox"
 	"github.com/yourusername/tomato-backend/internal/utils"
 	"gorm.io/gorm"
 )
@@ -117,6 +118,7 @@ func CreateTodo(c *gin.Context) {
 
 	// Load course relation
 	database.DB.Preload("Course").First(&todo, todo.ID)
+	publishUserEvent(userID, EventTodoCreated, todo)
 
 	utils.SuccessResponse(c, 201, todo, "待辦新增成功")
 }
@@ -214,11 +216,12 @@ func UpdateTodo(c *gin.Context) {
 
 	// Load course relation
 	database.DB.Preload("Course").First(&todo, todo.ID)
+	publishUserEvent(userID, EventTodoUpdated, todo)
 
 	utils.SuccessResponse(c, 200, todo, "待辦更新成功")
 }
 
-// DeleteTodo deletes a todo
+// DeleteTodo moves a todo to the trash
 func DeleteTodo(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -246,8 +249,9 @@ func DeleteTodo(c *gin.Context) {
 		utils.InternalErrorResponse(c, "待辦刪除失敗")
 		return
 	}
+	publishUserEvent(userID, EventTodoDeleted, gin.H{"id": todo.ID})
 
-	utils.SuccessResponse(c, 200, nil, "待辦刪除成功")
+	utils.SuccessResponse(c, 200, nil, "待辦已移至垃圾桶")
 }
 
 // ToggleTodoComplete toggles todo completion status
@@ -280,14 +284,25 @@ func ToggleTodoComplete(c *gin.Context) {
 		return
 	}
 
-	todo.Completed = req.Completed
+	wasCompleted := todo.Completed
+	todo.SetCompleted(req.Completed)
 
-	if err := database.DB.Save(&todo).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&todo).Error; err != nil {
+			return err
+		}
+		if todo.Completed && !wasCompleted {
+			return outbox.Publish(tx, outbox.TodoCompleted{TodoID: todo.ID, UserID: userID, CompletedAt: *todo.CompletedAt})
+		}
+		return nil
+	})
+	if err != nil {
 		utils.InternalErrorResponse(c, "更新待辦狀態失敗")
 		return
 	}
 
 	database.DB.Preload("Course").First(&todo, todo.ID)
+	publishUserEvent(userID, EventTodoUpdated, todo)
 
 	utils.SuccessResponse(c, 200, todo, "待辦狀態已更新")
 }
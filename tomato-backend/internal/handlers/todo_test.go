@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/yourusername/tomato-backend/internal/database"
 	"github.com/yourusername/tomato-backend/internal/middleware"
 	"github.com/yourusername/tomato-backend/internal/models"
@@ -25,10 +26,10 @@ func setupTodoTests(t *testing.T) (*gin.Engine, *models.User, *models.Course, st
 	// Create test user and course
 	school := testutil.CreateTestSchool(db, "測試大學")
 	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
-	course := testutil.CreateTestCourse(db, user.ID, "數學", "#3b82f6", 3)
+	course := testutil.CreateTestCourse(db, user.ID, "數學", "#3b82f6")
 
 	// Generate token
-	token, _ := utils.GenerateToken(user.ID.String(), user.Email)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
 
 	// Cleanup function
 	cleanup := func() {
@@ -123,7 +124,7 @@ func TestGetTodos(t *testing.T) {
 }
 
 func TestCreateTodo(t *testing.T) {
-	router, user, course, token, cleanup := setupTodoTests(t)
+	router, _, course, token, cleanup := setupTodoTests(t)
 	defer cleanup()
 
 	router.POST("/todos", middleware.AuthMiddleware(), CreateTodo)
@@ -570,7 +571,7 @@ func TestToggleTodoComplete(t *testing.T) {
 }
 
 func TestTodoCRUDFlow(t *testing.T) {
-	router, user, course, token, cleanup := setupTodoTests(t)
+	router, _, course, token, cleanup := setupTodoTests(t)
 	defer cleanup()
 
 	// Setup routes
@@ -647,7 +648,7 @@ func TestTodoCRUDFlow(t *testing.T) {
 }
 
 func TestTodoTypeValidation(t *testing.T) {
-	router, user, course, token, cleanup := setupTodoTests(t)
+	router, _, course, token, cleanup := setupTodoTests(t)
 	defer cleanup()
 
 	router.POST("/todos", middleware.AuthMiddleware(), CreateTodo)
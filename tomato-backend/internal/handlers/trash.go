@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// withTrashed includes soft-deleted rows, used when preloading relations of
+// historical records so a trashed course or plan is still shown
+func withTrashed(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// GetTrash lists soft-deleted courses, plans and todos of the authenticated user
+func GetTrash(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var courses []models.Course
+	if err := database.DB.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&courses).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢垃圾桶失敗")
+		return
+	}
+
+	var plans []models.StudyPlan
+	if err := database.DB.Unscoped().
+		Preload("Course", withTrashed).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&plans).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢垃圾桶失敗")
+		return
+	}
+
+	var todos []models.Todo
+	if err := database.DB.Unscoped().
+		Preload("Course", withTrashed).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&todos).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢垃圾桶失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"courses":        courses,
+		"plans":          plans,
+		"todos":          todos,
+		"retention_days": config.AppConfig.Trash.RetentionDays,
+	}, "")
+}
+
+// RestoreCourse restores a course from the trash
+func RestoreCourse(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	courseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的課程 ID")
+		return
+	}
+
+	var course models.Course
+	if err := database.DB.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", courseID, userID).
+		First(&course).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "垃圾桶中找不到此課程")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢課程失敗")
+		return
+	}
+
+	if err := database.DB.Unscoped().Model(&course).Update("deleted_at", nil).Error; err != nil {
+		utils.InternalErrorResponse(c, "課程還原失敗")
+		return
+	}
+
+	database.DB.First(&course, course.ID)
+
+	utils.SuccessResponse(c, 200, course, "課程已還原")
+}
+
+// RestorePlan restores a study plan from the trash
+func RestorePlan(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	planID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的計畫 ID")
+		return
+	}
+
+	var plan models.StudyPlan
+	if err := database.DB.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", planID, userID).
+		First(&plan).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "垃圾桶中找不到此計畫")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢計畫失敗")
+		return
+	}
+
+	if err := database.DB.Unscoped().Model(&plan).Update("deleted_at", nil).Error; err != nil {
+		utils.InternalErrorResponse(c, "計畫還原失敗")
+		return
+	}
+
+	database.DB.Preload("Course", withTrashed).First(&plan, plan.ID)
+	publishUserEvent(userID, EventPlanRestored, plan)
+
+	utils.SuccessResponse(c, 200, plan, "計畫已還原")
+}
+
+// RestoreTodo restores a todo from the trash
+func RestoreTodo(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	todoID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的待辦 ID")
+		return
+	}
+
+	var todo models.Todo
+	if err := database.DB.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", todoID, userID).
+		First(&todo).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "垃圾桶中找不到此待辦")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢待辦失敗")
+		return
+	}
+
+	if err := database.DB.Unscoped().Model(&todo).Update("deleted_at", nil).Error; err != nil {
+		utils.InternalErrorResponse(c, "待辦還原失敗")
+		return
+	}
+
+	database.DB.Preload("Course", withTrashed).First(&todo, todo.ID)
+	publishUserEvent(userID, EventTodoRestored, todo)
+
+	utils.SuccessResponse(c, 200, todo, "待辦已還原")
+}
+
+// PurgeTrash permanently deletes items that have been in the trash longer than
+// retentionDays and returns the number of purged rows
+func PurgeTrash(retentionDays int) (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	var purged int64
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Courses last: purging them sets course_id to NULL on remaining references
+		for _, model := range []interface{}{&models.Todo{}, &models.StudyPlan{}, &models.Course{}} {
+			result := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+		}
+		return nil
+	})
+
+	return purged, err
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupTrashTests(t *testing.T) (*gin.Engine, *models.User, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/trash", middleware.AuthMiddleware(), GetTrash)
+	router.DELETE("/courses/:id", middleware.AuthMiddleware(), DeleteCourse)
+	router.POST("/courses/:id/restore", middleware.AuthMiddleware(), RestoreCourse)
+	router.DELETE("/plans/:id", middleware.AuthMiddleware(), DeletePlan)
+	router.POST("/plans/:id/restore", middleware.AuthMiddleware(), RestorePlan)
+	router.DELETE("/todos/:id", middleware.AuthMiddleware(), DeleteTodo)
+	router.POST("/todos/:id/restore", middleware.AuthMiddleware(), RestoreTodo)
+
+	// Create test user
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// Generate token
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, token, cleanup
+}
+
+func TestTrashListAndRestore(t *testing.T) {
+	router, user, token, cleanup := setupTrashTests(t)
+	defer cleanup()
+
+	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
+	plan := testutil.CreateTestStudyPlan(database.DB, user.ID, &course.ID, "讀微積分", 60)
+	todo := testutil.CreateTestTodo(database.DB, user.ID, &course.ID, "作業一", models.TodoTypeHomework)
+
+	tests := []struct {
+		name string
+		path string
+		key  string
+	}{
+		{name: "課程", path: "/courses/" + course.ID.String(), key: "courses"},
+		{name: "計畫", path: "/plans/" + plan.ID.String(), key: "plans"},
+		{name: "待辦", path: "/todos/" + todo.ID.String(), key: "todos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Delete moves the item to the trash
+			w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", tt.path, token, nil)
+			testutil.AssertStatusCode(t, w, 200)
+
+			w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/trash", token, nil)
+			testutil.AssertStatusCode(t, w, 200)
+
+			var response utils.Response
+			testutil.ParseResponse(t, w, &response)
+			data := response.Data.(map[string]interface{})
+			items, ok := data[tt.key].([]interface{})
+			if !ok || len(items) != 1 {
+				t.Fatalf("Expected 1 item in trash %s, got %v", tt.key, data[tt.key])
+			}
+
+			// Restore brings it back
+			w = testutil.MakeAuthenticatedRequest(t, router, "POST", tt.path+"/restore", token, nil)
+			testutil.AssertStatusCode(t, w, 200)
+			testutil.AssertSuccess(t, w)
+
+			// Restoring again fails since it is no longer in the trash
+			w = testutil.MakeAuthenticatedRequest(t, router, "POST", tt.path+"/restore", token, nil)
+			testutil.AssertStatusCode(t, w, 404)
+			testutil.AssertError(t, w, "NOT_FOUND")
+		})
+	}
+}
+
+func TestRestoreKeepsTrashedCourse(t *testing.T) {
+	router, user, token, cleanup := setupTrashTests(t)
+	defer cleanup()
+
+	course := testutil.CreateTestCourse(database.DB, user.ID, "數學", "#3b82f6")
+	plan := testutil.CreateTestStudyPlan(database.DB, user.ID, &course.ID, "讀微積分", 60)
+	todo := testutil.CreateTestTodo(database.DB, user.ID, &course.ID, "作業一", models.TodoTypeHomework)
+
+	// The course stays in the trash while its plan and todo are restored
+	for _, path := range []string{"/plans/" + plan.ID.String(), "/todos/" + todo.ID.String(), "/courses/" + course.ID.String()} {
+		w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", path, token, nil)
+		testutil.AssertStatusCode(t, w, 200)
+	}
+
+	for _, path := range []string{"/plans/" + plan.ID.String(), "/todos/" + todo.ID.String()} {
+		w := testutil.MakeAuthenticatedRequest(t, router, "POST", path+"/restore", token, nil)
+		testutil.AssertStatusCode(t, w, 200)
+
+		data := testutil.GetResponseData(t, w).(map[string]interface{})
+		restored, ok := data["course"].(map[string]interface{})
+		if !ok || restored["name"] != "數學" {
+			t.Errorf("Expected %s to keep its trashed course, got %v", path, data["course"])
+		}
+	}
+}
+
+func TestTrashedCourseKeptInStats(t *testing.T) {
+	router, user, token, cleanup := setupTrashTests(t)
+	defer cleanup()
+
+	router.GET("/sessions", middleware.AuthMiddleware(), GetSessions)
+	router.GET("/sessions/stats", middleware.AuthMiddleware(), GetSessionStats)
+
+	course := testutil.CreateTestCourse(database.DB, user.ID, "線性代數", "#3b82f6")
+	session := testutil.CreateTestFocusSession(database.DB, user.ID, nil, &course.ID, 25)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "DELETE", fmt.Sprintf("/courses/%s", course.ID), token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	// Session still references the course
+	var stored models.FocusSession
+	database.DB.First(&stored, session.ID)
+	if stored.CourseID == nil || *stored.CourseID != course.ID {
+		t.Fatal("Session lost its course reference after course was trashed")
+	}
+
+	// Stats still show the course name
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions/stats?period=week", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var statsResponse utils.Response
+	testutil.ParseResponse(t, w, &statsResponse)
+	stats := statsResponse.Data.(map[string]interface{})
+	breakdown, ok := stats["course_breakdown"].([]interface{})
+	if !ok || len(breakdown) != 1 {
+		t.Fatalf("Expected 1 course in breakdown, got %v", stats["course_breakdown"])
+	}
+	if name := breakdown[0].(map[string]interface{})["course_name"]; name != "線性代數" {
+		t.Errorf("Expected course name 線性代數, got %v", name)
+	}
+
+	// Session list still preloads the trashed course
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/sessions", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var listResponse utils.Response
+	testutil.ParseResponse(t, w, &listResponse)
+	sessions := listResponse.Data.(map[string]interface{})["sessions"].([]interface{})
+	if len(sessions) != 1 || sessions[0].(map[string]interface{})["course"] == nil {
+		t.Error("Expected session to include its trashed course")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	_, user, _, cleanup := setupTrashTests(t)
+	defer cleanup()
+
+	oldCourse := testutil.CreateTestCourse(database.DB, user.ID, "舊課程", "#3b82f6")
+	recentCourse := testutil.CreateTestCourse(database.DB, user.ID, "新課程", "#3b82f6")
+
+	database.DB.Delete(oldCourse)
+	database.DB.Delete(recentCourse)
+	database.DB.Unscoped().Model(oldCourse).Update("deleted_at", time.Now().AddDate(0, 0, -31))
+
+	purged, err := PurgeTrash(30)
+	if err != nil {
+		t.Fatalf("PurgeTrash failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 purged item, got %d", purged)
+	}
+
+	var count int64
+	database.DB.Unscoped().Model(&models.Course{}).Where("id = ?", oldCourse.ID).Count(&count)
+	if count != 0 {
+		t.Error("Old trashed course should be permanently deleted")
+	}
+
+	database.DB.Unscoped().Model(&models.Course{}).Where("id = ?", recentCourse.ID).Count(&count)
+	if count != 1 {
+		t.Error("Recently trashed course should be kept")
+	}
+}
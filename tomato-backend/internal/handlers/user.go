@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UpdateMeRequest struct {
+	Name       string `json:"name"`
+	SchoolName string `json:"school_name"`
+	AvatarURL  string `json:"avatar_url"`
+}
+
+// UserProfileResponse is the user's own profile with their level
+type UserProfileResponse struct {
+	models.User
+	Level utils.LevelInfo `json:"level"`
+}
+
+func newUserProfileResponse(user models.User) UserProfileResponse {
+	return UserProfileResponse{
+		User:  user,
+		Level: utils.LevelFor(user.TotalPoints),
+	}
+}
+
+// GetMe retrieves the authenticated user's profile
+func GetMe(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Preload("School").First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, newUserProfileResponse(user), "")
+}
+
+// UpdateMe updates the authenticated user's profile. Changing school moves the
+// user's points and student count from the old school to the new one.
+func UpdateMe(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req UpdateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so total_points can't change while moving schools
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		if req.Name != "" {
+			user.Name = req.Name
+		}
+		if req.AvatarURL != "" {
+			user.AvatarURL = req.AvatarURL
+		}
+
+		if req.SchoolName != "" {
+			school, err := findOrCreateSchool(tx, req.SchoolName)
+			if err != nil {
+				return err
+			}
+
+			if user.SchoolID == nil || *user.SchoolID != school.ID {
+				// Unverified users aren't counted by either school yet
+				if user.IsEmailVerified() {
+					if err := adjustSchoolMembership(tx, user.SchoolID, -1, -schoolPoints(&user)); err != nil {
+						return err
+					}
+					if err := adjustSchoolMembership(tx, &school.ID, 1, schoolPoints(&user)); err != nil {
+						return err
+					}
+				}
+				user.SchoolID = &school.ID
+			}
+		}
+
+		// Save would overwrite total_points with a possibly stale value
+		return tx.Model(&user).Select("name", "avatar_url", "school_id").Updates(&user).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "用戶更新失敗")
+		return
+	}
+
+	database.DB.Preload("School").First(&user, user.ID)
+
+	utils.SuccessResponse(c, 200, newUserProfileResponse(user), "更新成功")
+}
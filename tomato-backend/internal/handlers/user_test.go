@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+func setupUserTests(t *testing.T) (*gin.Engine, *models.School, *models.User, string, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.GET("/users/me", middleware.AuthMiddleware(), GetMe)
+	router.PUT("/users/me", middleware.AuthMiddleware(), UpdateMe)
+
+	// Create test user
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+
+	// Generate token
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, school, user, token, cleanup
+}
+
+func TestGetMe(t *testing.T) {
+	router, _, user, token, cleanup := setupUserTests(t)
+	defer cleanup()
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.AssertSuccess(t, w)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	data := response.Data.(map[string]interface{})
+
+	if data["email"] != user.Email {
+		t.Errorf("Expected email %s, got %v", user.Email, data["email"])
+	}
+	if data["school"] == nil {
+		t.Error("Expected school to be preloaded")
+	}
+}
+
+func TestUpdateMeChangesSchool(t *testing.T) {
+	router, oldSchool, user, token, cleanup := setupUserTests(t)
+	defer cleanup()
+
+	database.DB.Model(user).Update("total_points", 300)
+	database.DB.Model(oldSchool).UpdateColumns(map[string]interface{}{"student_count": 1, "total_points": 300})
+
+	requestBody := map[string]interface{}{
+		"name":        "新名字",
+		"school_name": "新大學",
+	}
+	w := testutil.MakeAuthenticatedRequest(t, router, "PUT", "/users/me", token, requestBody)
+	testutil.AssertStatusCode(t, w, 200)
+	testutil.AssertSuccess(t, w)
+
+	var oldAfter, newAfter models.School
+	database.DB.First(&oldAfter, oldSchool.ID)
+	database.DB.Where("name = ?", "新大學").First(&newAfter)
+
+	if oldAfter.StudentCount != 0 || oldAfter.TotalPoints != 0 {
+		t.Errorf("Old school should have 0 students and 0 points, got %d and %d", oldAfter.StudentCount, oldAfter.TotalPoints)
+	}
+	if newAfter.StudentCount != 1 || newAfter.TotalPoints != 300 {
+		t.Errorf("New school should have 1 student and 300 points, got %d and %d", newAfter.StudentCount, newAfter.TotalPoints)
+	}
+
+	var userAfter models.User
+	database.DB.First(&userAfter, user.ID)
+	if userAfter.Name != "新名字" {
+		t.Errorf("Expected name 新名字, got %s", userAfter.Name)
+	}
+	if userAfter.TotalPoints != 300 {
+		t.Errorf("User points should be unchanged, got %d", userAfter.TotalPoints)
+	}
+
+	// Choosing the same school again is a no-op
+	w = testutil.MakeAuthenticatedRequest(t, router, "PUT", "/users/me", token, requestBody)
+	testutil.AssertStatusCode(t, w, 200)
+	database.DB.First(&newAfter, newAfter.ID)
+	if newAfter.StudentCount != 1 {
+		t.Errorf("Student count should stay 1, got %d", newAfter.StudentCount)
+	}
+}
+
+func TestReconcileSchools(t *testing.T) {
+	_, school, user, _, cleanup := setupUserTests(t)
+	defer cleanup()
+
+	database.DB.Model(user).Update("total_points", 250)
+	testutil.CreateTestSchool(database.DB, "空學校")
+
+	// Stored values are out of sync with users
+	database.DB.Model(school).UpdateColumns(map[string]interface{}{"student_count": 0, "total_points": 0})
+
+	drifts, err := ReconcileSchools(true)
+	if err != nil {
+		t.Fatalf("ReconcileSchools failed: %v", err)
+	}
+	if len(drifts) != 1 {
+		t.Fatalf("Expected 1 drifted school, got %d", len(drifts))
+	}
+	if drifts[0].ActualStudentCount != 1 || drifts[0].ActualTotalPoints != 250 {
+		t.Errorf("Unexpected drift: %+v", drifts[0])
+	}
+
+	// Dry run leaves data untouched
+	var afterDryRun models.School
+	database.DB.First(&afterDryRun, school.ID)
+	if afterDryRun.StudentCount != 0 {
+		t.Error("Dry run should not modify schools")
+	}
+
+	if _, err := ReconcileSchools(false); err != nil {
+		t.Fatalf("ReconcileSchools failed: %v", err)
+	}
+
+	var fixed models.School
+	database.DB.First(&fixed, school.ID)
+	if fixed.StudentCount != 1 || fixed.TotalPoints != 250 {
+		t.Errorf("Expected 1 student and 250 points, got %d and %d", fixed.StudentCount, fixed.TotalPoints)
+	}
+
+	drifts, _ = ReconcileSchools(true)
+	if len(drifts) != 0 {
+		t.Errorf("Expected no drift after reconciliation, got %d", len(drifts))
+	}
+}
+
+func TestLevelCurve(t *testing.T) {
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.AppConfig.Levels = config.LevelConfig{BasePoints: 500, Growth: 1.2, MaxLevel: 4}
+
+	tests := []struct {
+		points          int
+		level           int
+		levelPoints     int
+		nextLevelPoints int // 0 at the maximum level
+		progress        float64
+	}{
+		{points: 0, level: 1, levelPoints: 0, nextLevelPoints: 500, progress: 0},
+		{points: 250, level: 1, levelPoints: 0, nextLevelPoints: 500, progress: 0.5},
+		{points: 500, level: 2, levelPoints: 500, nextLevelPoints: 1100, progress: 0},
+		{points: 1099, level: 2, levelPoints: 500, nextLevelPoints: 1100, progress: 599.0 / 600},
+		{points: 1460, level: 3, levelPoints: 1100, nextLevelPoints: 1820, progress: 0.5},
+		{points: 1820, level: 4, levelPoints: 1820, progress: 1},
+		{points: 1000000, level: 4, levelPoints: 1820, progress: 1},
+	}
+
+	for _, tt := range tests {
+		info := utils.LevelFor(tt.points)
+		if info.Level != tt.level || info.LevelPoints != tt.levelPoints || info.Progress != tt.progress {
+			t.Errorf("%d points: expected level %d from %d at %.3f, got level %d from %d at %.3f",
+				tt.points, tt.level, tt.levelPoints, tt.progress, info.Level, info.LevelPoints, info.Progress)
+		}
+
+		if tt.nextLevelPoints == 0 {
+			if info.NextLevelPoints != nil {
+				t.Errorf("%d points: expected no next level, got %d", tt.points, *info.NextLevelPoints)
+			}
+		} else if info.NextLevelPoints == nil || *info.NextLevelPoints != tt.nextLevelPoints || info.PointsToNextLevel != tt.nextLevelPoints-tt.points {
+			t.Errorf("%d points: expected next level at %d, got %v", tt.points, tt.nextLevelPoints, info.NextLevelPoints)
+		}
+	}
+
+	if up := utils.LevelUpBetween(400, 1200); up == nil || up.From != 1 || up.To != 3 {
+		t.Errorf("Expected level-up from 1 to 3, got %+v", up)
+	}
+	if up := utils.LevelUpBetween(600, 1000); up != nil {
+		t.Errorf("Expected no level-up within level 2, got %+v", up)
+	}
+}
+
+func TestGetMeIncludesLevel(t *testing.T) {
+	router, _, user, token, cleanup := setupUserTests(t)
+	defer cleanup()
+
+	config.AppConfig.Levels = config.LevelConfig{BasePoints: 500, Growth: 1.2, MaxLevel: 100}
+	database.DB.Model(user).UpdateColumn("total_points", 600)
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/users/me", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	level := response.Data.(map[string]interface{})["level"].(map[string]interface{})
+
+	if level["level"] != float64(2) || level["next_level_points"] != float64(1100) || level["points_to_next_level"] != float64(500) {
+		t.Errorf("Expected level 2 with 500 points to go, got %v", level)
+	}
+}
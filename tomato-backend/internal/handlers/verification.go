@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/mailer"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// userTokenResendInterval limits how often a verification or password reset
+// email can be sent to the same user
+const userTokenResendInterval = time.Minute
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// issueUserToken creates a new single-use token for the user, invalidating
+// any unused token with the same purpose. Returns the plaintext token.
+func issueUserToken(tx *gorm.DB, userID uuid.UUID, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Delete(&models.UserToken{}).Error; err != nil {
+		return "", err
+	}
+
+	if err := tx.Create(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a token as used and returns it. Fails with
+// ErrInvalidToken if it is unknown, expired, already used or issued for a
+// different purpose. Must be called inside a transaction.
+func consumeUserToken(tx *gorm.DB, token string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	var userToken models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).
+		First(&userToken).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if !userToken.IsUsable() {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if err := tx.Model(&userToken).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	return &userToken, nil
+}
+
+// recentlyIssued reports whether a token with the given purpose was sent to
+// the user within userTokenResendInterval
+func recentlyIssued(userID uuid.UUID, purpose models.TokenPurpose) bool {
+	var recent int64
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, time.Now().Add(-userTokenResendInterval)).
+		Count(&recent)
+	return recent > 0
+}
+
+// sendVerificationEmail sends the verification link for token to user
+func sendVerificationEmail(user *models.User, token string) error {
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.AppConfig.Account.FrontendURL, token)
+
+	return mailer.Default.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "請驗證您的 Email",
+		Body: fmt.Sprintf("%s 您好：\n\n請點擊以下連結完成 Email 驗證：\n%s\n\n連結將於 %s 後失效。若您沒有註冊帳號，請忽略此信。\n",
+			user.Name, link, config.AppConfig.Account.EmailVerificationTTL),
+	})
+}
+
+// markEmailVerified records that the user owns their email, adding them and
+// the points they earned so far to their school. The user row must be locked.
+func markEmailVerified(tx *gorm.DB, user *models.User) error {
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := tx.Model(user).Update("email_verified_at", now).Error; err != nil {
+		return err
+	}
+
+	return adjustSchoolMembership(tx, user.SchoolID, 1, schoolPoints(user))
+}
+
+// VerifyEmail confirms a user's email address with the token from the
+// verification email. Once verified, the user counts towards their school.
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, req.Token, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userToken.UserID).Error; err != nil {
+			return err
+		}
+		return markEmailVerified(tx, &user)
+	})
+	if err != nil {
+		if err == ErrInvalidToken {
+			utils.ErrorResponse(c, 400, "INVALID_TOKEN", "驗證連結無效或已過期", nil)
+			return
+		}
+		utils.InternalErrorResponse(c, "Email 驗證失敗")
+		return
+	}
+
+	database.DB.Preload("School").First(&user, user.ID)
+
+	utils.SuccessResponse(c, 200, user, "Email 驗證成功")
+}
+
+// ResendVerificationEmail sends a new verification email to the
+// authenticated user, invalidating earlier links
+func ResendVerificationEmail(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用戶不存在")
+			return
+		}
+		utils.InternalErrorResponse(c, "查詢用戶失敗")
+		return
+	}
+
+	if user.IsEmailVerified() {
+		utils.ConflictResponse(c, "Email 已驗證")
+		return
+	}
+
+	if recentlyIssued(user.ID, models.TokenPurposeEmailVerification) {
+		utils.ErrorResponse(c, 429, "RATE_LIMIT_EXCEEDED", "請求過於頻繁，請稍後再試", nil)
+		return
+	}
+
+	token, err := issueUserToken(database.DB, user.ID, models.TokenPurposeEmailVerification, config.AppConfig.Account.EmailVerificationTTL)
+	if err != nil {
+		utils.InternalErrorResponse(c, "驗證信產生失敗")
+		return
+	}
+
+	if err := sendVerificationEmail(&user, token); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+		utils.InternalErrorResponse(c, "驗證信寄送失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, nil, "驗證信已寄出")
+}
+
+// CleanupExpiredUserTokens deletes tokens that expired more than a day ago
+func CleanupExpiredUserTokens() (int64, error) {
+	result := database.DB.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.UserToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/mailer"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// recordingMailer keeps sent messages in memory
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// lastToken extracts the token from the most recent message sent to email
+func (m *recordingMailer) lastToken(t *testing.T, email string) string {
+	t.Helper()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != email {
+			continue
+		}
+		if match := tokenPattern.FindStringSubmatch(m.messages[i].Body); match != nil {
+			return match[1]
+		}
+	}
+	t.Fatalf("No token sent to %s", email)
+	return ""
+}
+
+// captureMail replaces the default mailer for the duration of a test
+func captureMail(t *testing.T) *recordingMailer {
+	previous := mailer.Default
+	recorder := &recordingMailer{}
+	mailer.Default = recorder
+	t.Cleanup(func() { mailer.Default = previous })
+	return recorder
+}
+
+func setupVerificationTests(t *testing.T) (*gin.Engine, *recordingMailer, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/auth/register", Register)
+	router.POST("/auth/verify-email", VerifyEmail)
+	router.POST("/auth/verify-email/resend", middleware.AuthMiddleware(), ResendVerificationEmail)
+
+	mail := captureMail(t)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, mail, cleanup
+}
+
+func registerTestUser(t *testing.T, router *gin.Engine, email, schoolName string) (*models.User, string) {
+	requestBody := map[string]interface{}{
+		"email":       email,
+		"password":    "tomato-focus-42",
+		"name":        "學生",
+		"school_name": schoolName,
+	}
+	w := testutil.MakeRequest(t, router, "POST", "/auth/register", requestBody, nil)
+	testutil.AssertStatusCode(t, w, 201)
+
+	var response utils.Response
+	testutil.ParseResponse(t, w, &response)
+	token := response.Data.(map[string]interface{})["token"].(string)
+
+	var user models.User
+	database.DB.Where("email = ?", email).First(&user)
+	return &user, token
+}
+
+func TestVerifyEmail(t *testing.T) {
+	router, mail, cleanup := setupVerificationTests(t)
+	defer cleanup()
+
+	user, _ := registerTestUser(t, router, "student@example.com", "驗證大學")
+	if user.IsEmailVerified() {
+		t.Fatal("Newly registered user should not be verified")
+	}
+
+	// Points earned before verification
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := recordPoints(tx, user.ID, 100, models.PointSourceBonus, nil, "測試")
+		return err
+	})
+
+	var school models.School
+	database.DB.First(&school, user.SchoolID)
+	if school.StudentCount != 0 || school.TotalPoints != 0 {
+		t.Errorf("Unverified user should not count towards school, got %d students and %d points", school.StudentCount, school.TotalPoints)
+	}
+
+	token := mail.lastToken(t, user.Email)
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "無效的 token", token: "invalid", expectedStatus: 400},
+		{name: "成功驗證", token: token, expectedStatus: 200},
+		{name: "token 不可重複使用", token: token, expectedStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testutil.MakeRequest(t, router, "POST", "/auth/verify-email", map[string]interface{}{"token": tt.token}, nil)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedStatus == 400 {
+				testutil.AssertError(t, w, "INVALID_TOKEN")
+			}
+		})
+	}
+
+	database.DB.First(&school, user.SchoolID)
+	if school.StudentCount != 1 || school.TotalPoints != 100 {
+		t.Errorf("Verified user should join school totals, got %d students and %d points", school.StudentCount, school.TotalPoints)
+	}
+}
+
+func TestVerifyEmailExpiredToken(t *testing.T) {
+	router, mail, cleanup := setupVerificationTests(t)
+	defer cleanup()
+
+	user, _ := registerTestUser(t, router, "student@example.com", "驗證大學")
+	token := mail.lastToken(t, user.Email)
+
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ?", user.ID).
+		Update("expires_at", time.Now().Add(-time.Minute))
+
+	w := testutil.MakeRequest(t, router, "POST", "/auth/verify-email", map[string]interface{}{"token": token}, nil)
+	testutil.AssertStatusCode(t, w, 400)
+	testutil.AssertError(t, w, "INVALID_TOKEN")
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	router, mail, cleanup := setupVerificationTests(t)
+	defer cleanup()
+
+	user, authToken := registerTestUser(t, router, "student@example.com", "驗證大學")
+	firstToken := mail.lastToken(t, user.Email)
+
+	// Too soon after registration
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/auth/verify-email/resend", authToken, nil)
+	testutil.AssertStatusCode(t, w, 429)
+
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ?", user.ID).
+		Update("created_at", time.Now().Add(-2*userTokenResendInterval))
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/auth/verify-email/resend", authToken, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	secondToken := mail.lastToken(t, user.Email)
+	if secondToken == firstToken {
+		t.Fatal("Expected a new token to be sent")
+	}
+
+	// The earlier link no longer works
+	w = testutil.MakeRequest(t, router, "POST", "/auth/verify-email", map[string]interface{}{"token": firstToken}, nil)
+	testutil.AssertStatusCode(t, w, 400)
+
+	w = testutil.MakeRequest(t, router, "POST", "/auth/verify-email", map[string]interface{}{"token": secondToken}, nil)
+	testutil.AssertStatusCode(t, w, 200)
+
+	// Nothing to resend once verified
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/auth/verify-email/resend", authToken, nil)
+	testutil.AssertStatusCode(t, w, 409)
+}
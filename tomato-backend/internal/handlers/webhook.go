@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// webhookSecretPrefix makes webhook secrets recognizable, e.g. in secret
+// scanners
+const webhookSecretPrefix = "whsec_"
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Description string   `json:"description" binding:"max=255"`
+	Events      []string `json:"events" binding:"required,min=1"`
+}
+
+type UpdateWebhookRequest struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	Events      []string `json:"events"`
+	// Active disables the webhook when false; true re-enables it and resets
+	// its failure count
+	Active *bool `json:"active"`
+}
+
+// WebhookWithSecret is returned when a webhook is created or its secret is
+// rotated. The secret is not shown again.
+type WebhookWithSecret struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// validateWebhookURL checks that the URL is an absolute http(s) URL. Private
+// addresses are refused unless allowed; names are checked again when
+// connecting, after they are resolved.
+func validateWebhookURL(raw string) (string, string) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", "Webhook URL 必須是 http 或 https 網址"
+	}
+	if len(raw) > 2048 {
+		return "", "Webhook URL 過長"
+	}
+	if u.User != nil {
+		return "", "Webhook URL 不可包含帳號密碼"
+	}
+	if config.AppConfig.Server.Env == "production" && u.Scheme != "https" {
+		return "", "Webhook URL 必須使用 https"
+	}
+
+	if !config.AppConfig.Webhooks.AllowPrivateNetworks {
+		host := u.Hostname()
+		if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+			return "", "Webhook URL 不可指向內部網路"
+		}
+		if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+			return "", "Webhook URL 不可指向內部網路"
+		}
+	}
+
+	return raw, ""
+}
+
+// validateWebhookEvents checks the event filter and removes duplicates. "*"
+// subscribes to every event type, including ones added later.
+func validateWebhookEvents(events []string) ([]string, string) {
+	seen := map[string]bool{}
+	var valid []string
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if seen[event] {
+			continue
+		}
+		known := event == "*"
+		for _, t := range webhookEventTypes {
+			if event == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, "不支援的事件類型: " + event
+		}
+		seen[event] = true
+		valid = append(valid, event)
+	}
+	if len(valid) == 0 {
+		return nil, "請至少選擇一個事件類型"
+	}
+	return valid, ""
+}
+
+func generateWebhookSecret() (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + token, nil
+}
+
+// loadWebhook loads the current user's webhook in the id parameter. Other
+// users' webhooks are reported as missing.
+func loadWebhook(c *gin.Context) (*models.Webhook, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return nil, false
+	}
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ValidationErrorResponse(c, "無效的 Webhook ID")
+		return nil, false
+	}
+
+	var webhook models.Webhook
+	if err := database.DB.Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "Webhook 不存在")
+			return nil, false
+		}
+		utils.InternalErrorResponse(c, "查詢 Webhook 失敗")
+		return nil, false
+	}
+
+	return &webhook, true
+}
+
+// GetWebhooks lists the current user's webhooks
+func GetWebhooks(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var webhooks []models.Webhook
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&webhooks).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢 Webhook 失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{
+		"webhooks":    webhooks,
+		"event_types": webhookEventTypes,
+	}, "")
+}
+
+// CreateWebhook registers a webhook. The response includes the signing
+// secret, which is only shown this once.
+func CreateWebhook(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	webhookURL, msg := validateWebhookURL(req.URL)
+	if msg != "" {
+		utils.ValidationErrorResponse(c, msg)
+		return
+	}
+	events, msg := validateWebhookEvents(req.Events)
+	if msg != "" {
+		utils.ValidationErrorResponse(c, msg)
+		return
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.Webhook{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		utils.InternalErrorResponse(c, "建立 Webhook 失敗")
+		return
+	}
+	if limit := config.AppConfig.Webhooks.MaxPerUser; limit > 0 && int(count) >= limit {
+		utils.ConflictResponse(c, "Webhook 數量已達上限")
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		utils.InternalErrorResponse(c, "建立 Webhook 失敗")
+		return
+	}
+
+	webhook := models.Webhook{
+		UserID:      userID,
+		URL:         webhookURL,
+		Description: strings.TrimSpace(req.Description),
+		Events:      events,
+		Secret:      secret,
+	}
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		utils.InternalErrorResponse(c, "建立 Webhook 失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 201, WebhookWithSecret{Webhook: webhook, Secret: secret}, "Webhook 已建立，請妥善保存簽章密鑰")
+}
+
+// GetWebhook returns one of the current user's webhooks
+func GetWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, 200, webhook, "")
+}
+
+// UpdateWebhook changes a webhook's URL, description or events, or disables
+// and re-enables it
+func UpdateWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err.Error())
+		return
+	}
+
+	var columns []string
+	if req.URL != nil {
+		webhookURL, msg := validateWebhookURL(*req.URL)
+		if msg != "" {
+			utils.ValidationErrorResponse(c, msg)
+			return
+		}
+		webhook.URL = webhookURL
+		columns = append(columns, "URL")
+	}
+	if req.Description != nil {
+		webhook.Description = strings.TrimSpace(*req.Description)
+		columns = append(columns, "Description")
+	}
+	if req.Events != nil {
+		events, msg := validateWebhookEvents(req.Events)
+		if msg != "" {
+			utils.ValidationErrorResponse(c, msg)
+			return
+		}
+		webhook.Events = events
+		columns = append(columns, "Events")
+	}
+	if req.Active != nil {
+		if *req.Active && !webhook.IsActive() {
+			webhook.DisabledAt = nil
+			webhook.DisabledReason = ""
+			webhook.ConsecutiveFailures = 0
+			columns = append(columns, "DisabledAt", "DisabledReason", "ConsecutiveFailures")
+		} else if !*req.Active && webhook.IsActive() {
+			now := time.Now()
+			webhook.DisabledAt = &now
+			webhook.DisabledReason = "已由使用者停用"
+			columns = append(columns, "DisabledAt", "DisabledReason")
+		}
+	}
+
+	if len(columns) > 0 {
+		// Select so that cleared fields are written too
+		if err := database.DB.Model(webhook).Select(columns).Updates(webhook).Error; err != nil {
+			utils.InternalErrorResponse(c, "更新 Webhook 失敗")
+			return
+		}
+	}
+
+	utils.SuccessResponse(c, 200, webhook, "Webhook 已更新")
+}
+
+// DeleteWebhook deletes a webhook and its delivery history
+func DeleteWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(webhook).Error; err != nil {
+		utils.InternalErrorResponse(c, "刪除 Webhook 失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, nil, "Webhook 已刪除")
+}
+
+// RotateWebhookSecret replaces a webhook's signing secret. Deliveries sent
+// from now on, including retries, are signed with the new secret.
+func RotateWebhookSecret(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		utils.InternalErrorResponse(c, "更新簽章密鑰失敗")
+		return
+	}
+	if err := database.DB.Model(webhook).Update("secret", secret).Error; err != nil {
+		utils.InternalErrorResponse(c, "更新簽章密鑰失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, WebhookWithSecret{Webhook: *webhook, Secret: secret}, "簽章密鑰已更新，請妥善保存")
+}
+
+// PingWebhook queues a webhook.ping event so that users can check their
+// receiver. It is sent with the next deliveries.
+func PingWebhook(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	if !webhook.IsActive() {
+		utils.ConflictResponse(c, "Webhook 已停用，請先重新啟用")
+		return
+	}
+
+	now := webhookNow()
+	eventID := uuid.New()
+	body, err := json.Marshal(WebhookPayload{
+		ID:        eventID,
+		Type:      WebhookEventPing,
+		CreatedAt: now,
+		Data:      gin.H{"webhook_id": webhook.ID},
+	})
+	if err != nil {
+		utils.InternalErrorResponse(c, "傳送測試事件失敗")
+		return
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       eventID,
+		EventType:     WebhookEventPing,
+		Payload:       body,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: now,
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		utils.InternalErrorResponse(c, "傳送測試事件失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 202, delivery, "測試事件已排入傳送佇列")
+}
+
+// GetWebhookDeliveries lists a webhook's recent deliveries, newest first,
+// optionally only those with the given status
+func GetWebhookDeliveries(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		if val, err := utils.ParseInt(l); err == nil && val > 0 && val <= 100 {
+			limit = val
+		}
+	}
+
+	query := database.DB.Where("webhook_id = ?", webhook.ID)
+	if status := c.Query("status"); status != "" {
+		switch models.WebhookDeliveryStatus(status) {
+		case models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryFailed:
+			query = query.Where("status = ?", status)
+		default:
+			utils.ValidationErrorResponse(c, "無效的狀態，請使用 pending、succeeded 或 failed")
+			return
+		}
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		utils.InternalErrorResponse(c, "查詢傳送紀錄失敗")
+		return
+	}
+
+	utils.SuccessResponse(c, 200, gin.H{"deliveries": deliveries}, "")
+}
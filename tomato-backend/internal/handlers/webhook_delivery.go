@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Headers sent with every webhook request
+const (
+	WebhookSignatureHeader = "X-Tomato-Signature"
+	WebhookEventHeader     = "X-Tomato-Event"
+	WebhookDeliveryHeader  = "X-Tomato-Delivery"
+)
+
+// WebhookEventPing is sent when a user tests a webhook
+const WebhookEventPing = "webhook.ping"
+
+// webhookEventTypes are the domain events webhooks may subscribe to
+var webhookEventTypes = []string{
+	outbox.TypeSessionCreated,
+	outbox.TypePlanCompleted,
+	outbox.TypeTodoCompleted,
+}
+
+const (
+	// webhookRetryDelay is the wait before the first retry; it doubles with
+	// every further attempt up to webhookMaxRetryDelay
+	webhookRetryDelay    = 30 * time.Second
+	webhookMaxRetryDelay = 6 * time.Hour
+	webhookBatchSize     = 20
+	// webhookLeaseMargin is added to the time a batch may take to send, see
+	// webhookLease
+	webhookLeaseMargin = time.Minute
+	// webhookPollInterval is how often due deliveries are sent
+	webhookPollInterval = 5 * time.Second
+)
+
+// webhookNow returns the current time for delivery scheduling
+var webhookNow = time.Now
+
+// WebhookPayload is the JSON body sent to webhooks
+type WebhookPayload struct {
+	// ID identifies the event; a receiver may see it again after a retry
+	ID        uuid.UUID   `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// signWebhookPayload returns the signature header for a request body:
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">". Including
+// the time lets receivers reject replayed requests.
+func signWebhookPayload(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhookDeliveries queues the event for every active webhook of the
+// user that subscribes to its type. A redelivered outbox event is queued
+// only once per webhook.
+func enqueueWebhookDeliveries(tx *gorm.DB, meta outbox.Meta, userID uuid.UUID, data interface{}) error {
+	var webhooks []models.Webhook
+	if err := tx.Where("user_id = ? AND disabled_at IS NULL", userID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(WebhookPayload{ID: meta.ID, Type: meta.Type, CreatedAt: meta.CreatedAt, Data: data})
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(meta.Type) {
+			continue
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       meta.ID,
+			EventType:     meta.Type,
+			Payload:       body,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: webhookNow(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartWebhookSender sends due webhook deliveries in a background goroutine
+// until the returned stop function is called
+func StartWebhookSender() (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := DeliverWebhooks(); err != nil {
+					log.Printf("Failed to deliver webhooks: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// DeliverWebhooks sends every due delivery and returns how many were
+// attempted
+func DeliverWebhooks() (int, error) {
+	client := webhookClient()
+
+	total := 0
+	for {
+		batch, err := claimWebhookDeliveries()
+		if err != nil {
+			return total, err
+		}
+		for i := range batch {
+			sendWebhookDelivery(client, &batch[i])
+		}
+		total += len(batch)
+		if len(batch) < webhookBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// webhookLease hides a claimed batch from other senders while it is being
+// sent. Deliveries are sent one after another and each may take up to the
+// configured timeout, so the lease outlasts the slowest possible batch.
+func webhookLease() time.Duration {
+	return webhookBatchSize*config.AppConfig.Webhooks.Timeout + webhookLeaseMargin
+}
+
+// claimWebhookDeliveries locks a batch of due deliveries, skipping those
+// another instance holds, and leases them so that they are sent once
+func claimWebhookDeliveries() ([]models.WebhookDelivery, error) {
+	now := webhookNow()
+
+	var batch []models.WebhookDelivery
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(webhookBatchSize).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(batch))
+		for i, delivery := range batch {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(webhookLease())).Error
+	})
+	return batch, err
+}
+
+// sendWebhookDelivery makes one attempt and schedules a retry, gives up or
+// disables the webhook depending on the outcome
+func sendWebhookDelivery(client *http.Client, delivery *models.WebhookDelivery) {
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, delivery.WebhookID).Error; err != nil {
+		// A deleted webhook takes its deliveries with it
+		return
+	}
+	if !webhook.IsActive() {
+		database.DB.Model(delivery).Updates(map[string]interface{}{
+			"status":     models.WebhookDeliveryFailed,
+			"last_error": "webhook disabled",
+		})
+		return
+	}
+
+	now := webhookNow()
+	statusCode, duration, err := postWebhook(client, &webhook, delivery, now)
+
+	delivery.Attempts++
+	updates := map[string]interface{}{
+		"attempts":         delivery.Attempts,
+		"last_attempt_at":  now,
+		"last_status_code": statusCode,
+		"last_duration_ms": int(duration / time.Millisecond),
+		"last_error":       "",
+	}
+
+	if err == nil {
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+		database.DB.Model(&webhook).UpdateColumns(map[string]interface{}{
+			"consecutive_failures": 0,
+			"last_success_at":      now,
+		})
+	} else {
+		updates["last_error"] = err.Error()
+
+		disabled, ferr := recordWebhookFailure(&webhook, now)
+		if ferr != nil {
+			log.Printf("Failed to record failure of webhook %s: %v", webhook.ID, ferr)
+		}
+		if disabled || delivery.Attempts >= config.AppConfig.Webhooks.MaxAttempts {
+			updates["status"] = models.WebhookDeliveryFailed
+		} else {
+			updates["next_attempt_at"] = now.Add(webhookBackoff(delivery.Attempts))
+		}
+	}
+
+	if err := database.DB.Model(delivery).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// postWebhook sends the delivery's payload, signed with the webhook's
+// current secret. Anything but a 2xx answer is a failure.
+func postWebhook(client *http.Client, webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, time.Duration, error) {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Tomato-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(WebhookSignatureHeader, signWebhookPayload(webhook.Secret, now, delivery.Payload))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	duration := time.Since(start)
+	if err != nil {
+		return 0, duration, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, duration, fmt.Errorf("receiver answered HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, duration, nil
+}
+
+// recordWebhookFailure counts a failed attempt and disables the webhook once
+// too many failed in a row. It reports whether the webhook was disabled.
+func recordWebhookFailure(webhook *models.Webhook, now time.Time) (bool, error) {
+	limit := config.AppConfig.Webhooks.DisableAfterFailures
+	disabled := false
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(webhook, webhook.ID).Error; err != nil {
+			return err
+		}
+
+		webhook.ConsecutiveFailures++
+		updates := map[string]interface{}{"consecutive_failures": webhook.ConsecutiveFailures}
+		if limit > 0 && webhook.ConsecutiveFailures >= limit && webhook.IsActive() {
+			disabled = true
+			updates["disabled_at"] = now
+			updates["disabled_reason"] = fmt.Sprintf("連續 %d 次傳送失敗，已自動停用", webhook.ConsecutiveFailures)
+		}
+		if err := tx.Model(webhook).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		if !disabled {
+			return nil
+		}
+
+		// Nothing more will be sent to it
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", webhook.ID, models.WebhookDeliveryPending).
+			Updates(map[string]interface{}{
+				"status":     models.WebhookDeliveryFailed,
+				"last_error": "webhook disabled",
+			}).Error
+	})
+	if disabled && err == nil {
+		log.Printf("Disabled webhook %s after %d consecutive failures", webhook.ID, webhook.ConsecutiveFailures)
+	}
+	return disabled, err
+}
+
+// webhookBackoff is the wait after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryDelay
+	for i := 1; i < attempts && delay < webhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxRetryDelay {
+		delay = webhookMaxRetryDelay
+	}
+	return delay
+}
+
+var errPrivateAddress = errors.New("webhook address is not publicly routable")
+
+// nonPublicNetworks lists the special-purpose ranges (RFC 6890 and the IANA
+// registries) that are not reachable on the public internet
+var nonPublicNetworks = parseCIDRs(
+	// IPv4
+	"0.0.0.0/8",       // "this" network
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // carrier-grade NAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // private
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved and broadcast
+	// IPv6
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // NAT64
+	"64:ff9b:1::/48", // local-use NAT64
+	"100::/64",       // discard
+	"2001::/23",      // IETF protocol assignments
+	"2001:db8::/32",  // documentation
+	"2002::/16",      // 6to4
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// isPrivateIP reports whether ip is loopback, private, link-local or
+// otherwise not a public internet address. IPv4-mapped IPv6 addresses are
+// checked as the IPv4 address they carry.
+func isPrivateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// refusePrivateAddress stops connections to internal services. It runs after
+// DNS resolution, so it also catches names that resolve to private addresses.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// webhookClient returns the HTTP client webhooks are sent with. It doesn't
+// follow redirects and, unless allowed, refuses private addresses.
+func webhookClient() *http.Client {
+	cfg := config.AppConfig.Webhooks
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = refusePrivateAddress
+	}
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CleanupWebhookDeliveries deletes finished deliveries older than the
+// configured retention
+func CleanupWebhookDeliveries() (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -config.AppConfig.Webhooks.RetentionDays)
+	result := database.DB.
+		Where("status <> ? AND created_at < ?", models.WebhookDeliveryPending, cutoff).
+		Delete(&models.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/middleware"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/outbox"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"github.com/yourusername/tomato-backend/internal/utils"
+)
+
+// webhookReceiver is a local endpoint that records the requests it gets and
+// answers with the queued status codes, then 200
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []receivedWebhook
+	statuses []int
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	r := &webhookReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+func setupWebhookTests(t *testing.T) (*gin.Engine, *models.User, string, *time.Time, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Load config
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	// The receiver listens on localhost
+	config.AppConfig.Webhooks.AllowPrivateNetworks = true
+
+	now := time.Now()
+	webhookNow = func() time.Time { return now }
+
+	// Setup test router
+	router := testutil.SetupTestRouter()
+	router.POST("/sessions", middleware.AuthMiddleware(), CreateSession)
+	router.PATCH("/todos/:id/complete", middleware.AuthMiddleware(), ToggleTodoComplete)
+	webhooks := router.Group("/webhooks")
+	webhooks.Use(middleware.AuthMiddleware())
+	webhooks.GET("", GetWebhooks)
+	webhooks.POST("", CreateWebhook)
+	webhooks.GET("/:id", GetWebhook)
+	webhooks.PUT("/:id", UpdateWebhook)
+	webhooks.DELETE("/:id", DeleteWebhook)
+	webhooks.POST("/:id/secret", RotateWebhookSecret)
+	webhooks.POST("/:id/ping", PingWebhook)
+	webhooks.GET("/:id/deliveries", GetWebhookDeliveries)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	token, _, _ := utils.GenerateSessionTokens(user, uuid.Nil)
+
+	// Cleanup function
+	cleanup := func() {
+		webhookNow = time.Now
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return router, user, token, &now, cleanup
+}
+
+// createWebhook registers a webhook and returns its ID and secret
+func createWebhook(t *testing.T, router *gin.Engine, token, url string, events ...string) (string, string) {
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/webhooks", token, map[string]interface{}{
+		"url": url, "events": events,
+	})
+	testutil.AssertStatusCode(t, w, 201)
+
+	data := testutil.GetResponseData(t, w).(map[string]interface{})
+	return data["id"].(string), data["secret"].(string)
+}
+
+func sendWebhooks(t *testing.T) int {
+	n, err := DeliverWebhooks()
+	if err != nil {
+		t.Fatalf("Failed to deliver webhooks: %v", err)
+	}
+	return n
+}
+
+// verifyWebhookSignature checks the signature header the way a receiver
+// would
+func verifyWebhookSignature(t *testing.T, secret string, received receivedWebhook) {
+	var timestamp, signature string
+	for _, part := range strings.Split(received.header.Get(WebhookSignatureHeader), ",") {
+		if v, ok := strings.CutPrefix(part, "t="); ok {
+			timestamp = v
+		}
+		if v, ok := strings.CutPrefix(part, "v1="); ok {
+			signature = v
+		}
+	}
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Fatalf("Expected a timestamp in the signature, got %q", received.header.Get(WebhookSignatureHeader))
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(received.body)))
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		t.Errorf("Expected a valid signature, got %q", received.header.Get(WebhookSignatureHeader))
+	}
+}
+
+func TestWebhookDeliversSignedEvents(t *testing.T) {
+	router, user, token, _, cleanup := setupWebhookTests(t)
+	defer cleanup()
+
+	receiver := newWebhookReceiver(t)
+	webhookID, secret := createWebhook(t, router, token, receiver.URL+"/hook", outbox.TypeTodoCompleted)
+	if !strings.HasPrefix(secret, webhookSecretPrefix) {
+		t.Errorf("Expected a prefixed secret, got %q", secret)
+	}
+
+	// The secret is not shown again
+	w := testutil.MakeAuthenticatedRequest(t, router, "GET", "/webhooks/"+webhookID, token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	if strings.Contains(w.Body.String(), secret) {
+		t.Error("Expected the secret to be hidden")
+	}
+
+	// Only the subscribed event type is sent
+	w = testutil.MakeAuthenticatedRequest(t, router, "POST", "/sessions", token, map[string]interface{}{
+		"date": time.Now().Format("2006-01-02"), "minutes": 25,
+	})
+	testutil.AssertStatusCode(t, w, 201)
+	todo := testutil.CreateTestTodo(database.DB, user.ID, nil, "作業", models.TodoTypeHomework)
+	w = testutil.MakeAuthenticatedRequest(t, router, "PATCH", "/todos/"+todo.ID.String()+"/complete", token, map[string]interface{}{"completed": true})
+	testutil.AssertStatusCode(t, w, 200)
+
+	deliverDomainEvents(t)
+	if n := sendWebhooks(t); n != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", n)
+	}
+
+	received := receiver.received()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(received))
+	}
+	if got := received[0].header.Get(WebhookEventHeader); got != outbox.TypeTodoCompleted {
+		t.Errorf("Expected event header %s, got %q", outbox.TypeTodoCompleted, got)
+	}
+	verifyWebhookSignature(t, secret, received[0])
+
+	var payload struct {
+		ID   string               `json:"id"`
+		Type string               `json:"type"`
+		Data outbox.TodoCompleted `json:"data"`
+	}
+	if err := json.Unmarshal(received[0].body, &payload); err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+	if payload.Type != outbox.TypeTodoCompleted || payload.Data.TodoID != todo.ID || payload.Data.UserID != user.ID {
+		t.Errorf("Expected the completed todo in the payload, got %+v", payload)
+	}
+
+	// A redelivered outbox event is not sent twice
+	event := outboxEvents(t, outbox.TypeTodoCompleted)[0]
+	meta := outbox.Meta{ID: event.ID, Type: event.Type, CreatedAt: event.CreatedAt}
+	if err := enqueueWebhookDeliveries(database.DB, meta, user.ID, payload.Data); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	if n := sendWebhooks(t); n != 0 {
+		t.Errorf("Expected the redelivered event to be ignored, got %d deliveries", n)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/webhooks/"+webhookID+"/deliveries", token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	deliveries := testutil.GetResponseData(t, w).(map[string]interface{})["deliveries"].([]interface{})
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery listed, got %d", len(deliveries))
+	}
+	delivery := deliveries[0].(map[string]interface{})
+	if delivery["status"] != string(models.WebhookDeliverySucceeded) || delivery["last_status_code"] != float64(200) || delivery["attempts"] != float64(1) {
+		t.Errorf("Expected a successful delivery, got %v", delivery)
+	}
+	if got := received[0].header.Get(WebhookDeliveryHeader); got != delivery["id"] {
+		t.Errorf("Expected delivery header %v, got %q", delivery["id"], got)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	router, _, token, now, cleanup := setupWebhookTests(t)
+	defer cleanup()
+
+	receiver := newWebhookReceiver(t, 500, 503)
+	webhookID, _ := createWebhook(t, router, token, receiver.URL, "*")
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/webhooks/"+webhookID+"/ping", token, nil)
+	testutil.AssertStatusCode(t, w, 202)
+
+	sendWebhooks(t)
+	var delivery models.WebhookDelivery
+	database.DB.First(&delivery)
+	if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != 500 {
+		t.Fatalf("Expected one failed attempt, got %+v", delivery)
+	}
+	if wait := delivery.NextAttemptAt.Sub(*now); wait < webhookRetryDelay-time.Millisecond || wait > webhookRetryDelay {
+		t.Errorf("Expected a retry after %v, got %v", webhookRetryDelay, wait)
+	}
+
+	// Not due yet
+	if n := sendWebhooks(t); n != 0 {
+		t.Fatalf("Expected no retry before the delay, got %d", n)
+	}
+
+	// The delay doubles
+	*now = now.Add(webhookRetryDelay)
+	sendWebhooks(t)
+	database.DB.First(&delivery)
+	if wait := delivery.NextAttemptAt.Sub(*now); delivery.Attempts != 2 || wait < 2*webhookRetryDelay-time.Millisecond || wait > 2*webhookRetryDelay {
+		t.Errorf("Expected a second retry after %v, got %+v", 2*webhookRetryDelay, delivery)
+	}
+
+	*now = now.Add(2 * webhookRetryDelay)
+	sendWebhooks(t)
+	database.DB.First(&delivery)
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 3 || delivery.DeliveredAt == nil {
+		t.Errorf("Expected the delivery to succeed on the third attempt, got %+v", delivery)
+	}
+
+	var webhook models.Webhook
+	database.DB.First(&webhook)
+	if webhook.ConsecutiveFailures != 0 || webhook.LastSuccessAt == nil {
+		t.Errorf("Expected the failure count reset after a success, got %+v", webhook)
+	}
+	if len(receiver.received()) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(receiver.received()))
+	}
+}
+
+func TestWebhookDisabledAfterRepeatedFailures(t *testing.T) {
+	router, _, token, now, cleanup := setupWebhookTests(t)
+	defer cleanup()
+	config.AppConfig.Webhooks.DisableAfterFailures = 3
+
+	receiver := newWebhookReceiver(t, 500, 500, 500, 500)
+	webhookID, _ := createWebhook(t, router, token, receiver.URL, "*")
+
+	// Two deliveries fail in turn until the webhook gives out
+	for i := 0; i < 2; i++ {
+		w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/webhooks/"+webhookID+"/ping", token, nil)
+		testutil.AssertStatusCode(t, w, 202)
+	}
+	for i := 0; i < 3; i++ {
+		sendWebhooks(t)
+		*now = now.Add(webhookMaxRetryDelay)
+	}
+
+	var webhook models.Webhook
+	database.DB.First(&webhook)
+	if webhook.IsActive() || webhook.ConsecutiveFailures != 3 || webhook.DisabledReason == "" {
+		t.Fatalf("Expected the webhook disabled after 3 failures, got %+v", webhook)
+	}
+
+	var pending int64
+	database.DB.Model(&models.WebhookDelivery{}).Where("status = ?", models.WebhookDeliveryPending).Count(&pending)
+	if pending != 0 {
+		t.Errorf("Expected pending deliveries cancelled, got %d", pending)
+	}
+	if len(receiver.received()) != 3 {
+		t.Errorf("Expected nothing sent after disabling, got %d requests", len(receiver.received()))
+	}
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/webhooks/"+webhookID+"/ping", token, nil)
+	testutil.AssertStatusCode(t, w, 409)
+
+	// Re-enabling starts over
+	w = testutil.MakeAuthenticatedRequest(t, router, "PUT", "/webhooks/"+webhookID, token, map[string]interface{}{"active": true})
+	testutil.AssertStatusCode(t, w, 200)
+	database.DB.First(&webhook)
+	if !webhook.IsActive() || webhook.ConsecutiveFailures != 0 || webhook.DisabledReason != "" {
+		t.Errorf("Expected the webhook re-enabled, got %+v", webhook)
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	router, _, token, _, cleanup := setupWebhookTests(t)
+	defer cleanup()
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		allowPrivate   bool
+		expectedStatus int
+	}{
+		{
+			name:           "有效的 Webhook",
+			requestBody:    map[string]interface{}{"url": "https://example.com/hook", "events": []string{"session.created", "session.created"}},
+			expectedStatus: 201,
+		},
+		{
+			name:           "不支援的網址",
+			requestBody:    map[string]interface{}{"url": "ftp://example.com/hook", "events": []string{"*"}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "不支援的事件",
+			requestBody:    map[string]interface{}{"url": "https://example.com/hook", "events": []string{"user.deleted"}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "缺少事件",
+			requestBody:    map[string]interface{}{"url": "https://example.com/hook", "events": []string{}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "內部網路",
+			requestBody:    map[string]interface{}{"url": "http://127.0.0.1:8080/hook", "events": []string{"*"}},
+			expectedStatus: 400,
+		},
+		{
+			name:           "允許內部網路",
+			requestBody:    map[string]interface{}{"url": "http://127.0.0.1:8080/hook", "events": []string{"*"}},
+			allowPrivate:   true,
+			expectedStatus: 201,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.Webhooks.AllowPrivateNetworks = tt.allowPrivate
+
+			w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/webhooks", token, tt.requestBody)
+			testutil.AssertStatusCode(t, w, tt.expectedStatus)
+			if tt.expectedStatus == 400 {
+				testutil.AssertError(t, w, "VALIDATION_ERROR")
+			}
+		})
+	}
+
+	var webhook models.Webhook
+	database.DB.Where("url = ?", "https://example.com/hook").First(&webhook)
+	if len(webhook.Events) != 1 {
+		t.Errorf("Expected duplicate events removed, got %v", webhook.Events)
+	}
+
+	// Names resolving to private addresses are refused when connecting
+	config.AppConfig.Webhooks.AllowPrivateNetworks = false
+	receiver := newWebhookReceiver(t)
+	if _, err := webhookClient().Get(receiver.URL); err == nil {
+		t.Error("Expected the client to refuse a loopback address")
+	}
+}
+
+func TestWebhookLimitAndOwnership(t *testing.T) {
+	router, _, token, _, cleanup := setupWebhookTests(t)
+	defer cleanup()
+	config.AppConfig.Webhooks.MaxPerUser = 1
+
+	webhookID, _ := createWebhook(t, router, token, "https://example.com/hook", "*")
+
+	w := testutil.MakeAuthenticatedRequest(t, router, "POST", "/webhooks", token, map[string]interface{}{
+		"url": "https://example.com/other", "events": []string{"*"},
+	})
+	testutil.AssertStatusCode(t, w, 409)
+
+	school := testutil.CreateTestSchool(database.DB, "其他大學")
+	other := testutil.CreateTestUser(database.DB, "other@example.com", "password123", "其他用戶", &school.ID)
+	otherToken, _, _ := utils.GenerateSessionTokens(other, uuid.Nil)
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/webhooks/" + webhookID},
+		{"PUT", "/webhooks/" + webhookID},
+		{"DELETE", "/webhooks/" + webhookID},
+		{"GET", "/webhooks/" + webhookID + "/deliveries"},
+	} {
+		w := testutil.MakeAuthenticatedRequest(t, router, req.method, req.path, otherToken, map[string]interface{}{})
+		testutil.AssertStatusCode(t, w, 404)
+	}
+
+	w = testutil.MakeAuthenticatedRequest(t, router, "DELETE", "/webhooks/"+webhookID, token, nil)
+	testutil.AssertStatusCode(t, w, 200)
+	w = testutil.MakeAuthenticatedRequest(t, router, "GET", "/webhooks", token, nil)
+	if webhooks := testutil.GetResponseData(t, w).(map[string]interface{})["webhooks"].([]interface{}); len(webhooks) != 0 {
+		t.Errorf("Expected the webhook deleted, got %d", len(webhooks))
+	}
+}
+
+func TestWebhookSecretsNotStoredForIdempotency(t *testing.T) {
+	router, user, token, _, cleanup := setupWebhookTests(t)
+	defer cleanup()
+
+	router.POST("/idempotent/webhooks", middleware.AuthMiddleware(), middleware.Idempotency(), middleware.WithholdIdempotentResponse(), CreateWebhook)
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		"Idempotency-Key": "create-webhook",
+	}
+	body := map[string]interface{}{"url": "https://example.com/hook", "events": []string{outbox.TypeTodoCompleted}}
+
+	w := testutil.MakeRequest(t, router, "POST", "/idempotent/webhooks", body, headers)
+	testutil.AssertStatusCode(t, w, 201)
+	secret := testutil.GetResponseData(t, w).(map[string]interface{})["secret"].(string)
+
+	var record models.IdempotencyKey
+	if err := database.DB.Where("user_id = ? AND key = ?", user.ID, "create-webhook").First(&record).Error; err != nil {
+		t.Fatalf("Expected the key to be claimed: %v", err)
+	}
+	if !record.ResponseWithheld || strings.Contains(string(record.ResponseBody), secret) {
+		t.Errorf("Expected the response with the secret to be withheld, got %+v", record)
+	}
+
+	// A retry is neither replayed nor executed again
+	w = testutil.MakeRequest(t, router, "POST", "/idempotent/webhooks", body, headers)
+	testutil.AssertStatusCode(t, w, 409)
+	if strings.Contains(w.Body.String(), secret) {
+		t.Error("Expected the retry not to reveal the secret")
+	}
+
+	var count int64
+	database.DB.Model(&models.Webhook{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 webhook, got %d", count)
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		private bool
+	}{
+		{ip: "127.0.0.1", private: true},
+		{ip: "10.1.2.3", private: true},
+		{ip: "172.16.0.1", private: true},
+		{ip: "192.168.1.1", private: true},
+		{ip: "169.254.169.254", private: true},
+		{ip: "100.64.0.1", private: true},
+		{ip: "100.127.255.254", private: true},
+		{ip: "0.0.0.0", private: true},
+		{ip: "0.1.2.3", private: true},
+		{ip: "198.18.0.1", private: true},
+		{ip: "198.19.255.254", private: true},
+		{ip: "192.0.0.1", private: true},
+		{ip: "224.0.0.1", private: true},
+		{ip: "255.255.255.255", private: true},
+		{ip: "::1", private: true},
+		{ip: "::", private: true},
+		{ip: "fd00::1", private: true},
+		{ip: "fe80::1", private: true},
+		{ip: "::ffff:10.0.0.1", private: true},
+		{ip: "::ffff:100.64.0.1", private: true},
+		{ip: "64:ff9b::a00:1", private: true},
+		{ip: "8.8.8.8", private: false},
+		{ip: "100.128.0.1", private: false},
+		{ip: "198.20.0.1", private: false},
+		{ip: "::ffff:8.8.8.8", private: false},
+		{ip: "2606:4700::1111", private: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPrivateIP(net.ParseIP(tt.ip)); got != tt.private {
+				t.Errorf("isPrivateIP(%s) = %v, want %v", tt.ip, got, tt.private)
+			}
+		})
+	}
+}
+
+func TestWebhookLeaseCoversBatch(t *testing.T) {
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// A batch whose every delivery times out must still be under lease
+	for _, timeout := range []time.Duration{10 * time.Second, 30 * time.Second} {
+		config.AppConfig.Webhooks.Timeout = timeout
+		if lease, slowest := webhookLease(), webhookBatchSize*timeout; lease <= slowest {
+			t.Errorf("Expected a lease longer than %v with a %v timeout, got %v", slowest, timeout, lease)
+		}
+	}
+}
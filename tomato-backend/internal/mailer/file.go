@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileMailer writes each message as an .eml file into Dir, so that emails can
+// be opened in a mail client during local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), uuid.New().String()[:8])
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.From, msg), 0o644)
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/yourusername/tomato-backend/internal/config"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer used by handlers. It logs messages until Init is
+// called, so tests and tools never send real email by accident.
+var Default Mailer = &LogMailer{}
+
+// Init sets Default according to the mail configuration
+func Init(cfg config.MailConfig) error {
+	m, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Default = m
+	return nil
+}
+
+// New creates a mailer for the configured driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	case "file":
+		return &FileMailer{Dir: cfg.FileDir, From: cfg.From}, nil
+	case "log", "":
+		return &LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// LogMailer writes messages to the standard logger. For local development.
+type LogMailer struct{}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("[mail] to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// formatMessage renders msg as an RFC 5322 message
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", encodeHeader(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// encodeHeader encodes non-ASCII header values such as Chinese subjects
+func encodeHeader(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server using STARTTLS when the
+// server offers it
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	return smtp.SendMail(addr, auth, from.Address, []string{msg.To}, formatMessage(m.From, msg))
+}
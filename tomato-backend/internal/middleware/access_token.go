@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Scopes that can be granted to personal access tokens
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeStatsRead     = "stats:read"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	ScopePlansRead     = "plans:read"
+	ScopePlansWrite    = "plans:write"
+	ScopeTodosRead     = "todos:read"
+	ScopeTodosWrite    = "todos:write"
+	ScopeCoursesRead   = "courses:read"
+	ScopeCoursesWrite  = "courses:write"
+)
+
+// AccessTokenScopes lists every scope in the order they are documented
+var AccessTokenScopes = []string{
+	ScopeProfileRead,
+	ScopeStatsRead,
+	ScopeSessionsRead,
+	ScopeSessionsWrite,
+	ScopePlansRead,
+	ScopePlansWrite,
+	ScopeTodosRead,
+	ScopeTodosWrite,
+	ScopeCoursesRead,
+	ScopeCoursesWrite,
+}
+
+// accessTokenRoutes maps the routes personal access tokens may call, as
+// "METHOD /path" below /api/v1, to the scope each needs. Every other route,
+// e.g. changing the password or managing tokens, needs a login.
+var accessTokenRoutes = map[string]string{
+	"GET /users/me":              ScopeProfileRead,
+	"GET /users/me/points":       ScopeStatsRead,
+	"GET /users/me/achievements": ScopeStatsRead,
+	"GET /sessions/stats":        ScopeStatsRead,
+
+	"GET /sessions":  ScopeSessionsRead,
+	"POST /sessions": ScopeSessionsWrite,
+
+	"GET /plans":                ScopePlansRead,
+	"GET /plans/:id":            ScopePlansRead,
+	"POST /plans":               ScopePlansWrite,
+	"PUT /plans/:id":            ScopePlansWrite,
+	"DELETE /plans/:id":         ScopePlansWrite,
+	"PATCH /plans/:id/complete": ScopePlansWrite,
+
+	"GET /todos":                ScopeTodosRead,
+	"GET /todos/:id":            ScopeTodosRead,
+	"POST /todos":               ScopeTodosWrite,
+	"PUT /todos/:id":            ScopeTodosWrite,
+	"DELETE /todos/:id":         ScopeTodosWrite,
+	"PATCH /todos/:id/complete": ScopeTodosWrite,
+
+	"GET /courses":        ScopeCoursesRead,
+	"GET /courses/:id":    ScopeCoursesRead,
+	"POST /courses":       ScopeCoursesWrite,
+	"PUT /courses/:id":    ScopeCoursesWrite,
+	"DELETE /courses/:id": ScopeCoursesWrite,
+}
+
+// apiPrefix is stripped from route paths before they are looked up in
+// accessTokenRoutes
+const apiPrefix = "/api/v1"
+
+// accessTokenUsedInterval is how stale a token's last-used time may get
+// before a request updates it
+const accessTokenUsedInterval = time.Minute
+
+// authenticateAccessToken authenticates a request made with a personal
+// access token and checks that the token may call the route. It responds and
+// returns false otherwise.
+func authenticateAccessToken(c *gin.Context, token string) bool {
+	now := time.Now()
+
+	var pat models.PersonalAccessToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(token)).First(&pat).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.UnauthorizedResponse(c, "無效的存取權杖")
+		} else {
+			utils.InternalErrorResponse(c, "")
+		}
+		return false
+	}
+	if !pat.IsActive(now) {
+		utils.UnauthorizedResponse(c, "存取權杖已撤銷或過期")
+		return false
+	}
+
+	route := c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), apiPrefix)
+	scope, ok := accessTokenRoutes[route]
+	if !ok {
+		utils.ForbiddenResponse(c, "存取權杖無法使用此 API，請登入後再試")
+		return false
+	}
+	if !pat.HasScope(scope) {
+		utils.ForbiddenResponse(c, "存取權杖缺少 "+scope+" 權限")
+		return false
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "email", "role").First(&user, pat.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.UnauthorizedResponse(c, "無效的存取權杖")
+		} else {
+			utils.InternalErrorResponse(c, "")
+		}
+		return false
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > accessTokenUsedInterval {
+		database.DB.Model(&pat).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.ClientIP(),
+		})
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("user_email", user.Email)
+	c.Set("user_role", user.Role)
+	return true
+}
@@ -2,16 +2,37 @@ package middleware
 
 import (
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
 	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
 )
 
-// AuthMiddleware validates JWT token and sets user info in context
+// AuthMiddleware validates JWT token and sets user info in context.
+// Personal access tokens are accepted too, on the routes their scopes allow.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+
+		// Browsers can't set headers on WebSocket connections or EventSource
+		// streams, so those pass a single-use ticket from POST
+		// /auth/stream-ticket instead. Tokens never go in URLs, where they
+		// would end up in logs and browser history.
+		if authHeader == "" && isStreamRequest(c) {
+			if ticket := c.Query("ticket"); ticket != "" {
+				if !authenticateStreamTicket(c, ticket) {
+					c.Abort()
+					return
+				}
+				c.Next()
+				return
+			}
+		}
+
 		if authHeader == "" {
 			utils.UnauthorizedResponse(c, "缺少認證 token")
 			c.Abort()
@@ -27,6 +48,15 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := parts[1]
+		if strings.HasPrefix(token, models.AccessTokenPrefix) {
+			if !authenticateAccessToken(c, token) {
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		claims, err := utils.ValidateToken(token)
 		if err != nil {
 			utils.UnauthorizedResponse(c, "無效的 token")
@@ -34,14 +64,93 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Refresh tokens are only accepted by /auth/refresh
+		if claims.Type == utils.TokenTypeRefresh {
+			utils.UnauthorizedResponse(c, "無效的 token")
+			c.Abort()
+			return
+		}
+
+		// Tokens are revoked by bumping the user's token version, e.g. when
+		// the password changes
+		var user models.User
+		if err := database.DB.Select("id", "token_version").First(&user, claims.UserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				utils.UnauthorizedResponse(c, "無效的 token")
+			} else {
+				utils.InternalErrorResponse(c, "")
+			}
+			c.Abort()
+			return
+		}
+		if user.TokenVersion != claims.TokenVersion {
+			utils.UnauthorizedResponse(c, "token 已失效，請重新登入")
+			c.Abort()
+			return
+		}
+
+		// Tokens of a revoked or expired login session are rejected
+		if claims.SessionID != uuid.Nil {
+			if ok := touchSession(c, claims); !ok {
+				c.Abort()
+				return
+			}
+			c.Set("session_id", claims.SessionID)
+		}
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 
+		// Tokens issued before roles existed carry no role
+		role := models.UserRole(claims.Role)
+		if role == "" {
+			role = models.RoleStudent
+		}
+		c.Set("user_role", role)
+
 		c.Next()
 	}
 }
 
+// isStreamRequest reports whether the request opens a WebSocket connection
+// or an event stream
+func isStreamRequest(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("Upgrade"), "websocket") ||
+		strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// sessionSeenInterval is how stale a session's last-seen time may get before
+// a request updates it
+const sessionSeenInterval = time.Minute
+
+// touchSession checks that the token's login session is still active and
+// records that it was just used. It responds and returns false otherwise.
+func touchSession(c *gin.Context, claims *utils.Claims) bool {
+	now := time.Now()
+
+	var session models.AuthSession
+	err := database.DB.Select("id", "last_seen_at").
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.UserID, now).
+		First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.UnauthorizedResponse(c, "登入已失效，請重新登入")
+		} else {
+			utils.InternalErrorResponse(c, "")
+		}
+		return false
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionSeenInterval {
+		database.DB.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"ip_address":   c.ClientIP(),
+		})
+	}
+	return true
+}
+
 // GetUserID gets user ID from context
 func GetUserID(c *gin.Context) (uuid.UUID, bool) {
 	userID, exists := c.Get("user_id")
@@ -51,3 +160,41 @@ func GetUserID(c *gin.Context) (uuid.UUID, bool) {
 	id, ok := userID.(uuid.UUID)
 	return id, ok
 }
+
+// GetSessionID gets the login session of the token from context. Tokens
+// issued before sessions were tracked have none.
+func GetSessionID(c *gin.Context) (uuid.UUID, bool) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	id, ok := sessionID.(uuid.UUID)
+	return id, ok
+}
+
+// GetUserRole gets user role from context
+func GetUserRole(c *gin.Context) models.UserRole {
+	role, exists := c.Get("user_role")
+	if !exists {
+		return ""
+	}
+	r, _ := role.(models.UserRole)
+	return r
+}
+
+// RequireRole only lets through users with one of the given roles. Must be
+// used after AuthMiddleware.
+func RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := GetUserRole(c)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		utils.ForbiddenResponse(c, "")
+		c.Abort()
+	}
+}
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+
+	withholdResponseKey = "idempotency_withhold_response"
+)
+
+// responseRecorder captures the response body while still writing it to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// WithholdIdempotentResponse marks a route whose response carries a secret
+// shown only once. Idempotency still claims the key so retries are not
+// re-executed, but the response body is never stored and retries are rejected
+// instead of replayed.
+func WithholdIdempotentResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(withholdResponseKey, true)
+		c.Next()
+	}
+}
+
+// Idempotency makes mutating requests safe to retry. When a request carries an
+// Idempotency-Key header, its response is stored for config.Idempotency.TTL and
+// replayed for any retry with the same key. A request in progress holds its key
+// for config.Idempotency.Lease so that a crash does not block retries until the
+// TTL runs out. Must run after AuthMiddleware since keys are scoped per user.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.ValidationErrorResponse(c, "Idempotency-Key 長度不可超過 255 字元")
+			c.Abort()
+			return
+		}
+
+		userID, ok := GetUserID(c)
+		if !ok {
+			utils.UnauthorizedResponse(c, "")
+			c.Abort()
+			return
+		}
+
+		// Read body for hashing and restore it for the handler
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "無法讀取請求內容")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hashRequest(c.Request.Method, c.Request.URL.Path, body),
+			LockedUntil: now.Add(config.AppConfig.Idempotency.Lease),
+			ExpiresAt:   now.Add(config.AppConfig.Idempotency.TTL),
+		}
+
+		// Expired keys may be reused
+		database.DB.Where("user_id = ? AND key = ? AND expires_at <= ?", userID, key, now).
+			Delete(&models.IdempotencyKey{})
+
+		// Claim the key; a conflict means another request already owns it
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			utils.InternalErrorResponse(c, "冪等鍵儲存失敗")
+			c.Abort()
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			var existing models.IdempotencyKey
+			if err := database.DB.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+				utils.InternalErrorResponse(c, "查詢冪等鍵失敗")
+				c.Abort()
+				return
+			}
+
+			if existing.RequestHash != record.RequestHash {
+				utils.ErrorResponse(c, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key 已用於不同的請求", nil)
+				c.Abort()
+				return
+			}
+
+			if existing.IsCompleted() {
+				if existing.ResponseWithheld {
+					utils.ConflictResponse(c, "此請求已完成，回應含有僅顯示一次的機密資料，無法重播")
+					c.Abort()
+					return
+				}
+
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.ResponseBody)
+				c.Abort()
+				return
+			}
+
+			// Take over a claim whose lease ran out; its request was lost
+			takeover := database.DB.Model(&models.IdempotencyKey{}).
+				Where("id = ? AND status_code = 0 AND locked_until <= ?", existing.ID, now).
+				Update("locked_until", record.LockedUntil)
+			if takeover.Error != nil {
+				utils.InternalErrorResponse(c, "冪等鍵儲存失敗")
+				c.Abort()
+				return
+			}
+			if takeover.RowsAffected == 0 {
+				utils.ConflictResponse(c, "相同請求正在處理中，請稍後重試")
+				c.Abort()
+				return
+			}
+			record.ID = existing.ID
+		}
+
+		// Release the key if the handler fails or panics so the client can
+		// retry. Once the handler has succeeded the key is kept even if its
+		// response cannot be stored, since a retry would repeat the request.
+		handled := false
+		defer func() {
+			if !handled {
+				database.DB.Delete(&record)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		handled = true
+
+		updates := map[string]interface{}{
+			"status_code":   status,
+			"response_body": recorder.body.Bytes(),
+		}
+		if c.GetBool(withholdResponseKey) {
+			updates["response_body"] = nil
+			updates["response_withheld"] = true
+		}
+		if err := database.DB.Model(&record).Updates(updates).Error; err != nil {
+			log.Printf("Failed to store idempotent response for key %s: %v", key, err)
+		}
+	}
+}
+
+// CleanupExpiredIdempotencyKeys removes stored responses past their TTL
+func CleanupExpiredIdempotencyKeys() (int64, error) {
+	result := database.DB.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func hashRequest(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedQueryParams may carry credentials and are never written to the
+// request log
+var redactedQueryParams = []string{"ticket", "access_token"}
+
+// Logger logs requests in gin's default format, with credentials in the
+// query string redacted
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			redactQuery(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactQuery replaces the values of redactedQueryParams in a request path
+func redactQuery(path string) string {
+	u, err := url.Parse(path)
+	if err != nil || u.RawQuery == "" {
+		return path
+	}
+
+	query := u.Query()
+	redacted := false
+	for _, key := range redactedQueryParams {
+		if query.Has(key) {
+			query.Set(key, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return path
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
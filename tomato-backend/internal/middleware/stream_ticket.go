@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// authenticateStreamTicket authenticates a WebSocket or event stream request
+// with a stream ticket and uses it up. It responds and returns false if the
+// ticket is unknown, expired or already used.
+func authenticateStreamTicket(c *gin.Context, ticket string) bool {
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var userToken models.UserToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND purpose = ?", utils.HashToken(ticket), models.TokenPurposeStreamTicket).
+			First(&userToken).Error; err != nil {
+			return err
+		}
+		if !userToken.IsUsable() {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&userToken).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Select("id", "email", "role").First(&user, userToken.UserID).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.UnauthorizedResponse(c, "無效或已使用的連線票證")
+		} else {
+			utils.InternalErrorResponse(c, "")
+		}
+		return false
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("user_email", user.Email)
+	c.Set("user_role", user.Role)
+	return true
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them
+// apart from JWTs and makes leaked tokens easy to spot
+const AccessTokenPrefix = "tmt_"
+
+// PersonalAccessToken is a long-lived token a user creates for scripts and
+// devices. It can only do what its scopes allow. Only the SHA-256 hash of
+// the token is stored.
+type PersonalAccessToken struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	User      *User     `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash string    `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	// TokenPrefix is the start of the token, shown so users can tell their
+	// tokens apart
+	TokenPrefix string     `json:"token_prefix" gorm:"type:varchar(16);not null"`
+	Scopes      []string   `json:"scopes" gorm:"type:jsonb;serializer:json;not null"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty" gorm:"type:varchar(45)"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether the token is neither revoked nor expired
+func (t *PersonalAccessToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// HasScope reports whether the token was granted the scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
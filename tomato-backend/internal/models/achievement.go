@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserAchievement records that a user earned an achievement. Achievements
+// are defined in code and referenced by their code; each is awarded once.
+type UserAchievement struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_user_achievement"`
+	User      *User     `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Code      string    `json:"code" gorm:"type:varchar(50);not null;uniqueIndex:idx_user_achievement"`
+	AwardedAt time.Time `json:"awarded_at" gorm:"not null"`
+}
+
+func (a *UserAchievement) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminAuditLog records an action taken through the admin API. ActorID is
+// kept nullable so the log survives deletion of the acting admin.
+type AdminAuditLog struct {
+	ID         uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ActorID    *uuid.UUID      `json:"actor_id" gorm:"type:uuid;index"`
+	Actor      *User           `json:"actor,omitempty" gorm:"foreignKey:ActorID;constraint:OnDelete:SET NULL"`
+	Action     string          `json:"action" gorm:"type:varchar(50);not null;index"`
+	TargetType string          `json:"target_type" gorm:"type:varchar(20);not null"`
+	TargetID   uuid.UUID       `json:"target_id" gorm:"type:uuid;not null;index"`
+	Reason     string          `json:"reason"`
+	Details    json.RawMessage `json:"details,omitempty" gorm:"type:jsonb"`
+	CreatedAt  time.Time       `json:"created_at" gorm:"index"`
+}
+
+func (l *AdminAuditLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
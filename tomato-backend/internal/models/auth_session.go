@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuthSession is a device the user is logged in on. Every access and refresh
+// token carries the session ID, so revoking the session signs the device out.
+// Only the hash of the current refresh token is stored; refreshing replaces
+// it, and presenting an older refresh token revokes the session.
+type AuthSession struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID           uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	User             *User      `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	RefreshTokenHash string     `json:"-" gorm:"type:varchar(64);not null"`
+	DeviceName       string     `json:"device_name" gorm:"type:varchar(100)"`
+	UserAgent        string     `json:"user_agent" gorm:"type:varchar(500)"`
+	IPAddress        string     `json:"ip_address" gorm:"type:varchar(45)"`
+	LastSeenAt       time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null;index"`
+	RevokedAt        *time.Time `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func (s *AuthSession) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether the session is neither revoked nor expired
+func (s *AuthSession) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
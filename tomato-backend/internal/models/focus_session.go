@@ -17,6 +17,7 @@ type FocusSession struct {
 	Course       *Course    `json:"course,omitempty" gorm:"foreignKey:CourseID;constraint:OnDelete:SET NULL"`
 	Date         time.Time  `json:"date" gorm:"type:date;not null;index"`
 	Minutes      int        `json:"minutes" gorm:"not null"`
+	StartedAt    *time.Time `json:"started_at"` // nil for sessions recorded before start times were tracked
 	PointsEarned int        `json:"points_earned" gorm:"default:0"`
 	Location     string     `json:"location"`
 	CreatedAt    time.Time  `json:"created_at" gorm:"index"`
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey stores the response of a mutating request so that retries
+// carrying the same Idempotency-Key header are replayed instead of re-executed.
+// A StatusCode of 0 means the original request is still being processed; if it
+// has not finished by LockedUntil it is assumed lost and a retry may take over.
+// ResponseWithheld marks responses that carried a one-time secret and were
+// therefore not stored.
+type IdempotencyKey struct {
+	ID               uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID           uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_user_key"`
+	User             *User     `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Key              string    `json:"key" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_user_key"`
+	Method           string    `json:"method" gorm:"type:varchar(10);not null"`
+	Path             string    `json:"path" gorm:"not null"`
+	RequestHash      string    `json:"-" gorm:"type:varchar(64);not null"`
+	StatusCode       int       `json:"status_code" gorm:"default:0"`
+	ResponseBody     []byte    `json:"-" gorm:"type:bytea"`
+	ResponseWithheld bool      `json:"response_withheld" gorm:"not null;default:false"`
+	LockedUntil      time.Time `json:"locked_until" gorm:"not null"`
+	ExpiresAt        time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsCompleted reports whether the original request has finished and its
+// response was stored
+func (k *IdempotencyKey) IsCompleted() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one account or client IP.
+// Key is "account:<email>" or "ip:<address>".
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"type:varchar(320);primary_key"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at" gorm:"not null;index"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// IsLocked reports whether logins for this key are currently refused
+func (t *LoginThrottle) IsLocked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
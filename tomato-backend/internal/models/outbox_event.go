@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// it describes, so that it exists exactly when the change was committed. The
+// dispatcher delivers it to every subscriber of its type.
+type OutboxEvent struct {
+	ID      uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Type    string          `json:"type" gorm:"type:varchar(50);not null;index"`
+	Payload json.RawMessage `json:"payload" gorm:"type:jsonb;not null"`
+	// Attempts counts delivery rounds that left at least one subscriber failed
+	Attempts      int       `json:"attempts" gorm:"default:0"`
+	NextAttemptAt time.Time `json:"next_attempt_at" gorm:"not null;index"`
+	LastError     string    `json:"last_error,omitempty"`
+	// ProcessedAt is set once every subscriber has handled the event
+	ProcessedAt *time.Time `json:"processed_at" gorm:"index"`
+	// FailedAt is set when delivery was given up after too many attempts
+	FailedAt  *time.Time `json:"failed_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
+
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// OutboxDelivery records that a subscriber has handled an event, so that
+// retries only go to the subscribers that failed
+type OutboxDelivery struct {
+	EventID     uuid.UUID    `json:"event_id" gorm:"type:uuid;primary_key"`
+	Event       *OutboxEvent `json:"-" gorm:"foreignKey:EventID;constraint:OnDelete:CASCADE"`
+	Subscriber  string       `json:"subscriber" gorm:"type:varchar(50);primary_key"`
+	DeliveredAt time.Time    `json:"delivered_at"`
+}
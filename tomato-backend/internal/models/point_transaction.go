@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PointSource string
+
+const (
+	PointSourceSession         PointSource = "session"
+	PointSourceBonus           PointSource = "bonus"
+	PointSourceAdminAdjustment PointSource = "admin_adjustment"
+	PointSourceReversal        PointSource = "reversal"
+	PointSourceSchoolMerge     PointSource = "school_merge"
+)
+
+var ErrLedgerImmutable = errors.New("point transactions are append-only")
+
+// PointTransaction is one entry in the append-only points ledger. A user's
+// TotalPoints always equals the sum of their Delta values. ReferenceID points
+// at what caused the change: the focus session, the admin audit log entry, or
+// for reversals the transaction being reversed.
+type PointTransaction struct {
+	ID          uuid.UUID   `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID   `json:"user_id" gorm:"type:uuid;not null;index:idx_point_tx_user_created"`
+	User        *User       `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	SchoolID    *uuid.UUID  `json:"school_id" gorm:"type:uuid;index"`
+	School      *School     `json:"school,omitempty" gorm:"foreignKey:SchoolID;constraint:OnDelete:SET NULL"`
+	Delta       int         `json:"delta" gorm:"not null"`
+	Source      PointSource `json:"source" gorm:"type:varchar(20);not null;uniqueIndex:idx_point_tx_source_ref,where:reference_id IS NOT NULL"`
+	ReferenceID *uuid.UUID  `json:"reference_id" gorm:"type:uuid;uniqueIndex:idx_point_tx_source_ref,where:reference_id IS NOT NULL"`
+	Reason      string      `json:"reason,omitempty"`
+	CreatedAt   time.Time   `json:"created_at" gorm:"index:idx_point_tx_user_created"`
+}
+
+func (t *PointTransaction) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeUpdate rejects updates; corrections are made with a reversal entry
+func (t *PointTransaction) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SeasonKind is how a season's dates were chosen
+type SeasonKind string
+
+const (
+	// SeasonWeekly seasons run Monday to Sunday and are created automatically
+	SeasonWeekly SeasonKind = "weekly"
+	// SeasonMonthly seasons run for a calendar month and are created automatically
+	SeasonMonthly SeasonKind = "monthly"
+	// SeasonCustom seasons are created by admins for special competitions
+	SeasonCustom SeasonKind = "custom"
+)
+
+// Season is a time-boxed competition between schools. Scores are the points
+// of focus sessions dated within StartsOn and EndsOn, both inclusive. Once a
+// season has ended its final standings are archived and FinalizedAt is set.
+type Season struct {
+	ID   uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name string     `json:"name" gorm:"not null"`
+	Kind SeasonKind `json:"kind" gorm:"type:varchar(20);not null;uniqueIndex:idx_season_kind_start,where:kind <> 'custom'"`
+	// StartsOn and EndsOn are dates, like FocusSession.Date
+	StartsOn    time.Time  `json:"starts_on" gorm:"type:date;not null;uniqueIndex:idx_season_kind_start,where:kind <> 'custom'"`
+	EndsOn      time.Time  `json:"ends_on" gorm:"type:date;not null;index"`
+	FinalizedAt *time.Time `json:"finalized_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (s *Season) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsFinalized reports whether the season's standings have been archived
+func (s *Season) IsFinalized() bool {
+	return s.FinalizedAt != nil
+}
+
+// SeasonStanding is a school's archived final result in a season. The school
+// name is copied so standings survive the school being merged away.
+type SeasonStanding struct {
+	ID           uuid.UUID  `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SeasonID     uuid.UUID  `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_season_standing"`
+	Season       *Season    `json:"-" gorm:"foreignKey:SeasonID;constraint:OnDelete:CASCADE"`
+	SchoolID     *uuid.UUID `json:"school_id" gorm:"type:uuid;uniqueIndex:idx_season_standing"`
+	School       *School    `json:"-" gorm:"foreignKey:SchoolID;constraint:OnDelete:SET NULL"`
+	SchoolName   string     `json:"school_name" gorm:"not null"`
+	Rank         int        `json:"rank" gorm:"not null"`
+	Points       int        `json:"points" gorm:"not null"`
+	Participants int        `json:"participants" gorm:"not null"`
+}
+
+func (s *SeasonStanding) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GroupRole is a member's role in a study group
+type GroupRole string
+
+const (
+	GroupRoleOwner  GroupRole = "owner"
+	GroupRoleMember GroupRole = "member"
+)
+
+// StudyGroup is a group of students who study together. Anyone with the
+// invite code can join. The owner is also listed among the members.
+type StudyGroup struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	OwnerID     uuid.UUID `json:"owner_id" gorm:"type:uuid;not null;index"`
+	Owner       *User     `json:"-" gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
+	InviteCode  string    `json:"invite_code" gorm:"type:varchar(12);uniqueIndex;not null"`
+	// WeeklyGoalMinutes is how long the members aim to focus together each
+	// week, or nil without a goal
+	WeeklyGoalMinutes *int               `json:"weekly_goal_minutes"`
+	Members           []StudyGroupMember `json:"-" gorm:"foreignKey:GroupID"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+}
+
+func (g *StudyGroup) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return nil
+}
+
+// StudyGroupMember is a user's membership in a study group
+type StudyGroupMember struct {
+	ID       uuid.UUID   `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	GroupID  uuid.UUID   `json:"group_id" gorm:"type:uuid;not null;uniqueIndex:idx_group_member"`
+	Group    *StudyGroup `json:"-" gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE"`
+	UserID   uuid.UUID   `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_group_member;index"`
+	User     *User       `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Role     GroupRole   `json:"role" gorm:"type:varchar(20);not null;default:'member'"`
+	JoinedAt time.Time   `json:"joined_at" gorm:"not null"`
+}
+
+func (m *StudyGroupMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	if m.Role == "" {
+		m.Role = GroupRoleMember
+	}
+	return nil
+}
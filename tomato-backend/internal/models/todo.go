@@ -16,17 +16,19 @@ const (
 )
 
 type Todo struct {
-	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
-	User      *User      `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
-	CourseID  *uuid.UUID `json:"course_id" gorm:"type:uuid"`
-	Course    *Course    `json:"course,omitempty" gorm:"foreignKey:CourseID;constraint:OnDelete:SET NULL"`
-	Title     string     `json:"title" gorm:"not null"`
-	Date      time.Time  `json:"date" gorm:"type:date;not null;index"`
-	TodoType  TodoType   `json:"todo_type" gorm:"type:varchar(20);default:'memo';index"`
-	Completed bool       `json:"completed" gorm:"default:false;index"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
+	User        *User          `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	CourseID    *uuid.UUID     `json:"course_id" gorm:"type:uuid"`
+	Course      *Course        `json:"course,omitempty" gorm:"foreignKey:CourseID;constraint:OnDelete:SET NULL"`
+	Title       string         `json:"title" gorm:"not null"`
+	Date        time.Time      `json:"date" gorm:"type:date;not null;index"`
+	TodoType    TodoType       `json:"todo_type" gorm:"type:varchar(20);default:'memo';index"`
+	Completed   bool           `json:"completed" gorm:"default:false;index"`
+	CompletedAt *time.Time     `json:"completed_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 func (t *Todo) BeforeCreate(tx *gorm.DB) error {
@@ -35,3 +37,15 @@ func (t *Todo) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// SetCompleted marks the todo complete or incomplete, recording when it was
+// completed
+func (t *Todo) SetCompleted(completed bool) {
+	if completed && !t.Completed {
+		now := time.Now()
+		t.CompletedAt = &now
+	} else if !completed {
+		t.CompletedAt = nil
+	}
+	t.Completed = completed
+}
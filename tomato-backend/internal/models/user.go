@@ -7,34 +7,66 @@ import (
 	"gorm.io/gorm"
 )
 
+type UserRole string
+
+const (
+	RoleStudent     UserRole = "student"
+	RoleSchoolAdmin UserRole = "school_admin"
+	RoleAdmin       UserRole = "admin"
+)
+
+// IsValid reports whether r is a known role
+func (r UserRole) IsValid() bool {
+	switch r {
+	case RoleStudent, RoleSchoolAdmin, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Email       string     `json:"email" gorm:"uniqueIndex;not null"`
-	PasswordHash string    `json:"-" gorm:"not null"`
-	Name        string     `json:"name" gorm:"not null"`
-	SchoolID    *uuid.UUID `json:"school_id" gorm:"type:uuid"`
-	School      *School    `json:"school,omitempty" gorm:"foreignKey:SchoolID"`
-	TotalPoints int        `json:"total_points" gorm:"default:0;index"`
-	AvatarURL   string     `json:"avatar_url"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID                  uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Email               string     `json:"email" gorm:"uniqueIndex;not null"`
+	PasswordHash        string     `json:"-" gorm:"not null"`
+	Name                string     `json:"name" gorm:"not null"`
+	SchoolID            *uuid.UUID `json:"school_id" gorm:"type:uuid"`
+	School              *School    `json:"school,omitempty" gorm:"foreignKey:SchoolID"`
+	TotalPoints         int        `json:"total_points" gorm:"default:0;index"`
+	AvatarURL           string     `json:"avatar_url"`
+	Role                UserRole   `json:"role" gorm:"type:varchar(20);not null;default:'student';index"`
+	LeaderboardBanned   bool       `json:"leaderboard_banned" gorm:"default:false;index"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	TokenVersion        int        `json:"-" gorm:"not null;default:0"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" gorm:"index"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
+	if u.Role == "" {
+		u.Role = RoleStudent
+	}
 	return nil
 }
 
+// IsEmailVerified reports whether the user confirmed their email address.
+// Unverified users don't count towards school totals or leaderboards.
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 type School struct {
-	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Name         string    `json:"name" gorm:"uniqueIndex;not null"`
-	TotalPoints  int       `json:"total_points" gorm:"default:0;index:idx_schools_points"`
-	StudentCount int       `json:"student_count" gorm:"default:0"`
-	LogoURL      string    `json:"logo_url"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name         string        `json:"name" gorm:"uniqueIndex;not null"`
+	TotalPoints  int           `json:"total_points" gorm:"default:0;index:idx_schools_points"`
+	StudentCount int           `json:"student_count" gorm:"default:0"`
+	LogoURL      string        `json:"logo_url"`
+	Aliases      []SchoolAlias `json:"aliases,omitempty" gorm:"foreignKey:SchoolID"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
 }
 
 func (s *School) BeforeCreate(tx *gorm.DB) error {
@@ -43,3 +75,38 @@ func (s *School) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// SchoolAlias is an alternative name that resolves to a canonical school,
+// e.g. "台大" for "台灣大學"
+type SchoolAlias struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SchoolID       uuid.UUID `json:"school_id" gorm:"type:uuid;not null;index"`
+	School         *School   `json:"school,omitempty" gorm:"foreignKey:SchoolID;constraint:OnDelete:CASCADE"`
+	Name           string    `json:"name" gorm:"not null"`
+	NormalizedName string    `json:"-" gorm:"uniqueIndex;not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (a *SchoolAlias) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// SchoolDomain is an email domain belonging to a school, e.g. "ntu.edu.tw".
+// Users signing in through SSO with a matching email are assigned the school.
+type SchoolDomain struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SchoolID  uuid.UUID `json:"school_id" gorm:"type:uuid;not null;index"`
+	School    *School   `json:"school,omitempty" gorm:"foreignKey:SchoolID;constraint:OnDelete:CASCADE"`
+	Domain    string    `json:"domain" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (d *SchoolDomain) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider. A user may have several identities but each provider account
+// belongs to exactly one user.
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	User        *User      `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Provider    string     `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject     string     `json:"-" gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// OIDCLoginState remembers a login started with a provider until the user
+// comes back with an authorization code
+type OIDCLoginState struct {
+	State        string    `json:"-" gorm:"type:varchar(64);primary_key"`
+	Provider     string    `json:"provider" gorm:"type:varchar(50);not null"`
+	Nonce        string    `json:"-" gorm:"type:varchar(64);not null"`
+	CodeVerifier string    `json:"-" gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TokenPurpose string
+
+const (
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeStreamTicket      TokenPurpose = "stream_ticket"
+)
+
+// UserToken is a single-use token sent to a user by email, or handed out as a
+// short-lived ticket for opening a WebSocket connection or event stream. Only
+// the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID        uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID    `json:"user_id" gorm:"type:uuid;not null;index"`
+	User      *User        `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Purpose   TokenPurpose `json:"purpose" gorm:"type:varchar(30);not null"`
+	TokenHash string       `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time    `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time   `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (t *UserToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsUsable reports whether the token is unused and not yet expired
+func (t *UserToken) IsUsable() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Webhook is a URL a user registered to receive their domain events, e.g.
+// for a Discord or Notion bot. Payloads are signed with Secret.
+type Webhook struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	User        *User     `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	URL         string    `json:"url" gorm:"type:varchar(2048);not null"`
+	Description string    `json:"description" gorm:"type:varchar(255)"`
+	// Events lists the event types to deliver; "*" matches every type
+	Events []string `json:"events" gorm:"type:jsonb;serializer:json;not null"`
+	Secret string   `json:"-" gorm:"type:varchar(64);not null"`
+	// ConsecutiveFailures counts failed attempts since the last success; the
+	// webhook is disabled once it reaches the configured limit
+	ConsecutiveFailures int        `json:"consecutive_failures" gorm:"default:0"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether events are delivered to the webhook
+func (w *Webhook) IsActive() bool {
+	return w.DisabledAt == nil
+}
+
+// Subscribes reports whether the webhook wants events of the given type
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, t := range w.Events {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to one webhook, with the outcome of its
+// latest attempt. Failed attempts are retried with backoff.
+type WebhookDelivery struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	WebhookID uuid.UUID `json:"webhook_id" gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event;index:idx_webhook_delivery_recent,priority:1"`
+	Webhook   *Webhook  `json:"-" gorm:"foreignKey:WebhookID;constraint:OnDelete:CASCADE"`
+	// EventID is the outbox event, so that redelivered events are sent once
+	EventID   uuid.UUID             `json:"event_id" gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event"`
+	EventType string                `json:"event_type" gorm:"type:varchar(50);not null"`
+	Payload   json.RawMessage       `json:"payload" gorm:"type:jsonb;not null"`
+	Status    WebhookDeliveryStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending';index"`
+	Attempts  int                   `json:"attempts" gorm:"default:0"`
+	// NextAttemptAt is when a pending delivery is due
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"not null;index"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	// LastDurationMs is how long the receiver took to answer
+	LastDurationMs int        `json:"last_duration_ms,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index:idx_webhook_delivery_recent,priority:2"`
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+// Package oidc implements the OpenID Connect authorization code flow (with
+// PKCE) against the providers configured in config.OIDCConfig.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/tomato-backend/internal/config"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown OIDC provider")
+	ErrInvalidIDToken  = errors.New("invalid ID token")
+)
+
+// HTTPClient is used for all requests to providers
+var HTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+var providers = map[string]*Provider{}
+
+// Init registers the configured providers, replacing any registered before
+func Init(cfg config.OIDCConfig) {
+	registered := make(map[string]*Provider, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		registered[p.Name] = NewProvider(p)
+	}
+	providers = registered
+}
+
+// Get returns the provider registered under name
+func Get(name string) (*Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names lists the registered providers in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Discovery is the subset of the provider metadata document we use
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims we use
+type Claims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// Provider talks to a single OpenID Connect provider. Its metadata and
+// signing keys are fetched on first use and cached.
+type Provider struct {
+	Config config.OIDCProviderConfig
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]interface{}
+}
+
+func NewProvider(cfg config.OIDCProviderConfig) *Provider {
+	return &Provider{Config: cfg}
+}
+
+// metadata returns the provider's discovery document
+func (p *Provider) metadata(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d Discovery
+	if err := getJSON(ctx, p.Config.IssuerURL+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("fetch discovery document: %w", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.Config.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", d.Issuer, p.Config.IssuerURL)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// AuthCodeURL returns the URL to send the user to. The code verifier for
+// PKCE is derived into an S256 challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.Config.ClientID},
+		"redirect_uri":          {p.Config.RedirectURL},
+		"scope":                 {strings.Join(p.Config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	// Hint Google to only offer accounts of the allowed domain
+	if len(p.Config.AllowedDomains) == 1 {
+		params.Set("hd", p.Config.AllowedDomains[0])
+	}
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the verified
+// ID token claims
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.Config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("decode token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Config.IssuerURL),
+		jwt.WithAudience(p.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the
+// key set once if it is unknown (the provider may have rotated keys)
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwkSet
+	if err := getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	keys, err := set.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		// A provider with a single key may omit kid from tokens
+		if kid == "" && len(keys) == 1 {
+			for _, only := range keys {
+				return only, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
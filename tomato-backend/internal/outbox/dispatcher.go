@@ -0,0 +1,256 @@
+// Package outbox implements a transactional outbox. Handlers write domain
+// events with Publish inside the transaction that makes the change; a
+// Dispatcher later delivers them to the registered subscribers, retrying
+// failed subscribers with backoff. Delivery is at least once, so subscribers
+// must be idempotent.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event is a domain event that can be stored in the outbox
+type Event interface {
+	EventType() string
+}
+
+// Publish writes the event to the outbox. Call it with the transaction that
+// makes the change the event describes.
+func Publish(tx *gorm.DB, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.OutboxEvent{
+		Type:          event.EventType(),
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Meta identifies a stored event. Subscribers that pass events on can use
+// ID to recognize redeliveries.
+type Meta struct {
+	ID        uuid.UUID
+	Type      string
+	CreatedAt time.Time
+}
+
+type subscriber struct {
+	name   string
+	handle func(tx *gorm.DB, meta Meta, payload json.RawMessage) error
+}
+
+// Dispatcher delivers outbox events to subscribers. Its fields may only be
+// changed before Start.
+type Dispatcher struct {
+	// PollInterval is how often the outbox is checked for due events
+	PollInterval time.Duration
+	// MaxAttempts is how many delivery rounds an event gets before it is
+	// given up on
+	MaxAttempts int
+	// RetryDelay is the wait before the first retry; it doubles with every
+	// further attempt up to MaxRetryDelay
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Now returns the current time
+	Now func() time.Time
+
+	subscribers map[string][]subscriber
+}
+
+// NewDispatcher creates a dispatcher without subscribers
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		PollInterval:  time.Second,
+		MaxAttempts:   10,
+		RetryDelay:    10 * time.Second,
+		MaxRetryDelay: time.Hour,
+		Now:           time.Now,
+		subscribers:   map[string][]subscriber{},
+	}
+}
+
+// Subscribe registers handle for every event of type E. The name identifies
+// the subscriber in delivery records and must be unique per event type.
+// handle must make its changes with tx, which commits them together with the
+// delivery record; they are rolled back if handle fails.
+func Subscribe[E Event](d *Dispatcher, name string, handle func(*gorm.DB, Meta, E) error) {
+	var zero E
+	eventType := zero.EventType()
+
+	for _, s := range d.subscribers[eventType] {
+		if s.name == name {
+			panic(fmt.Sprintf("outbox: %s already subscribed to %s", name, eventType))
+		}
+	}
+
+	d.subscribers[eventType] = append(d.subscribers[eventType], subscriber{
+		name: name,
+		handle: func(tx *gorm.DB, meta Meta, payload json.RawMessage) error {
+			var event E
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return err
+			}
+			return handle(tx, meta, event)
+		},
+	})
+}
+
+// Start delivers events in a background goroutine until the returned stop
+// function is called
+func (d *Dispatcher) Start() (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(d.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := d.ProcessPending(); err != nil {
+					log.Printf("Failed to dispatch outbox events: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// ProcessPending delivers every event that is due and returns how many
+// events were handled
+func (d *Dispatcher) ProcessPending() (int, error) {
+	total := 0
+	for {
+		handled, err := d.processNext()
+		if err != nil || !handled {
+			return total, err
+		}
+		total++
+	}
+}
+
+// processNext locks the oldest due event, skipping those another instance
+// is delivering, and delivers it. Each event gets its own transaction, so
+// the lock is only held while that event's subscribers run. Reports false
+// when no event is due.
+func (d *Dispatcher) processNext() (bool, error) {
+	handled := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var event models.OutboxEvent
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("processed_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", d.Now()).
+			Order("created_at").
+			Limit(1).
+			Find(&event)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		handled = true
+		return d.dispatch(tx, &event)
+	})
+	return handled, err
+}
+
+// dispatch delivers the event to the subscribers that haven't handled it yet
+// and records the outcome
+func (d *Dispatcher) dispatch(tx *gorm.DB, event *models.OutboxEvent) error {
+	var delivered []string
+	if err := tx.Model(&models.OutboxDelivery{}).Where("event_id = ?", event.ID).Pluck("subscriber", &delivered).Error; err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(delivered))
+	for _, name := range delivered {
+		done[name] = true
+	}
+
+	meta := Meta{ID: event.ID, Type: event.Type, CreatedAt: event.CreatedAt}
+	var failures []string
+	for _, s := range d.subscribers[event.Type] {
+		if done[s.name] {
+			continue
+		}
+		// A savepoint per subscriber undoes the changes of one that fails
+		// without losing those of the others
+		if err := tx.Transaction(func(sp *gorm.DB) error {
+			return deliver(s, sp, meta, event.Payload)
+		}); err != nil {
+			failures = append(failures, s.name+": "+err.Error())
+			continue
+		}
+		if err := tx.Create(&models.OutboxDelivery{
+			EventID:     event.ID,
+			Subscriber:  s.name,
+			DeliveredAt: d.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	now := d.Now()
+	updates := map[string]interface{}{}
+	if len(failures) == 0 {
+		updates["processed_at"] = now
+		updates["last_error"] = ""
+	} else {
+		event.Attempts++
+		updates["attempts"] = event.Attempts
+		updates["last_error"] = strings.Join(failures, "; ")
+		if event.Attempts >= d.MaxAttempts {
+			updates["failed_at"] = now
+			log.Printf("Giving up on outbox event %s (%s) after %d attempts: %s", event.ID, event.Type, event.Attempts, updates["last_error"])
+		} else {
+			updates["next_attempt_at"] = now.Add(d.retryDelay(event.Attempts))
+		}
+	}
+	return tx.Model(event).Updates(updates).Error
+}
+
+// deliver calls the subscriber, turning a panic into an error so that one
+// broken subscriber can't take the dispatcher down
+func deliver(s subscriber, tx *gorm.DB, meta Meta, payload json.RawMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.handle(tx, meta, payload)
+}
+
+// retryDelay is the wait after the given number of failed attempts
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.RetryDelay
+	for i := 1; i < attempts && delay < d.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxRetryDelay {
+		delay = d.MaxRetryDelay
+	}
+	return delay
+}
+
+// Purge deletes events that were processed or given up on more than
+// retentionDays ago
+func Purge(retentionDays int) (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	result := database.DB.
+		Where("processed_at < ? OR failed_at < ?", cutoff, cutoff).
+		Delete(&models.OutboxEvent{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,212 @@
+package outbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/database"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"gorm.io/gorm"
+)
+
+func setupOutboxTests(t *testing.T) (*Dispatcher, *time.Time, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+	database.DB = db
+
+	// Ahead of the real clock that Publish stamps events with
+	now := time.Now().Add(time.Minute)
+	d := NewDispatcher()
+	d.Now = func() time.Time { return now }
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return d, &now, cleanup
+}
+
+func publish(t *testing.T, event Event) {
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return Publish(tx, event)
+	}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+}
+
+func process(t *testing.T, d *Dispatcher) int {
+	n, err := d.ProcessPending()
+	if err != nil {
+		t.Fatalf("ProcessPending failed: %v", err)
+	}
+	return n
+}
+
+func TestDispatcherDeliversCommittedEvents(t *testing.T) {
+	d, _, cleanup := setupOutboxTests(t)
+	defer cleanup()
+
+	var sessions []SessionCreated
+	var todos int
+	Subscribe(d, "sessions", func(_ *gorm.DB, _ Meta, e SessionCreated) error {
+		sessions = append(sessions, e)
+		return nil
+	})
+	Subscribe(d, "todos", func(_ *gorm.DB, _ Meta, e TodoCompleted) error {
+		todos++
+		return nil
+	})
+
+	userID := uuid.New()
+	publish(t, SessionCreated{SessionID: uuid.New(), UserID: userID, Minutes: 25})
+
+	// Events of a rolled back transaction never existed
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		Publish(tx, SessionCreated{SessionID: uuid.New(), UserID: userID, Minutes: 50})
+		return errors.New("rollback")
+	})
+
+	// Events nobody subscribes to are simply marked processed
+	publish(t, PlanCompleted{PlanID: uuid.New(), UserID: userID})
+
+	if n := process(t, d); n != 2 {
+		t.Fatalf("Expected 2 events handled, got %d", n)
+	}
+	if len(sessions) != 1 || sessions[0].UserID != userID || sessions[0].Minutes != 25 {
+		t.Errorf("Expected the committed session to be delivered, got %+v", sessions)
+	}
+	if todos != 0 {
+		t.Errorf("Expected no todo events, got %d", todos)
+	}
+
+	if n := process(t, d); n != 0 {
+		t.Errorf("Expected processed events not to be delivered again, got %d", n)
+	}
+
+	var pending int64
+	database.DB.Model(&models.OutboxEvent{}).Where("processed_at IS NULL").Count(&pending)
+	if pending != 0 {
+		t.Errorf("Expected every event processed, got %d pending", pending)
+	}
+}
+
+func TestDispatcherRetriesOnlyFailedSubscribers(t *testing.T) {
+	d, now, cleanup := setupOutboxTests(t)
+	defer cleanup()
+
+	reliable, flaky := 0, 0
+	Subscribe(d, "reliable", func(_ *gorm.DB, _ Meta, e TodoCompleted) error {
+		reliable++
+		return nil
+	})
+	Subscribe(d, "flaky", func(_ *gorm.DB, _ Meta, e TodoCompleted) error {
+		flaky++
+		if flaky < 3 {
+			return errors.New("service unavailable")
+		}
+		return nil
+	})
+
+	publish(t, TodoCompleted{TodoID: uuid.New(), UserID: uuid.New()})
+	process(t, d)
+
+	var event models.OutboxEvent
+	database.DB.First(&event)
+	if event.ProcessedAt != nil || event.Attempts != 1 || event.LastError != "flaky: service unavailable" {
+		t.Fatalf("Expected one failed attempt, got %+v", event)
+	}
+	if wait := event.NextAttemptAt.Sub(*now); wait < d.RetryDelay-time.Millisecond || wait > d.RetryDelay {
+		t.Errorf("Expected a retry after %v, got %v", d.RetryDelay, event.NextAttemptAt)
+	}
+
+	// Not due yet
+	if n := process(t, d); n != 0 {
+		t.Fatalf("Expected no retry before the delay, got %d", n)
+	}
+
+	// The delay doubles
+	*now = now.Add(d.RetryDelay)
+	process(t, d)
+	database.DB.First(&event)
+	if wait := event.NextAttemptAt.Sub(*now); event.Attempts != 2 || wait < 2*d.RetryDelay-time.Millisecond || wait > 2*d.RetryDelay {
+		t.Errorf("Expected a second retry after %v, got %+v", 2*d.RetryDelay, event)
+	}
+
+	*now = now.Add(2 * d.RetryDelay)
+	process(t, d)
+	database.DB.First(&event)
+	if event.ProcessedAt == nil || event.LastError != "" {
+		t.Errorf("Expected the event processed after the flaky subscriber recovered, got %+v", event)
+	}
+	if reliable != 1 || flaky != 3 {
+		t.Errorf("Expected 1 reliable and 3 flaky deliveries, got %d and %d", reliable, flaky)
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	d, now, cleanup := setupOutboxTests(t)
+	defer cleanup()
+	d.MaxAttempts = 2
+
+	Subscribe(d, "broken", func(_ *gorm.DB, _ Meta, e PlanCompleted) error {
+		panic("nil map")
+	})
+
+	publish(t, PlanCompleted{PlanID: uuid.New(), UserID: uuid.New()})
+	for i := 0; i < 3; i++ {
+		process(t, d)
+		*now = now.Add(d.MaxRetryDelay)
+	}
+
+	var event models.OutboxEvent
+	database.DB.First(&event)
+	if event.FailedAt == nil || event.Attempts != 2 || event.ProcessedAt != nil {
+		t.Errorf("Expected the event given up after 2 attempts, got %+v", event)
+	}
+	if event.LastError != "broken: panic: nil map" {
+		t.Errorf("Expected the panic to be recorded, got %q", event.LastError)
+	}
+}
+
+// Subscribers write with the delivery's transaction, so the changes of a
+// failing subscriber are rolled back
+func TestSubscriberChangesCommitWithDelivery(t *testing.T) {
+	d, now, cleanup := setupOutboxTests(t)
+	defer cleanup()
+
+	fail := true
+	Subscribe(d, "chained", func(tx *gorm.DB, _ Meta, e PlanCompleted) error {
+		if err := Publish(tx, TodoCompleted{TodoID: uuid.New(), UserID: e.UserID}); err != nil {
+			return err
+		}
+		if fail {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	publish(t, PlanCompleted{PlanID: uuid.New(), UserID: uuid.New()})
+	process(t, d)
+
+	var count int64
+	database.DB.Model(&models.OutboxEvent{}).Where("type = ?", TypeTodoCompleted).Count(&count)
+	if count != 0 {
+		t.Fatalf("Expected the failed subscriber's event to be rolled back, got %d", count)
+	}
+
+	// The retry succeeds and its event is committed with the delivery
+	fail = false
+	*now = now.Add(time.Hour)
+	process(t, d)
+
+	database.DB.Model(&models.OutboxEvent{}).Where("type = ?", TypeTodoCompleted).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the retried subscriber's event to be committed, got %d", count)
+	}
+}
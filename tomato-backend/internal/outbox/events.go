@@ -0,0 +1,48 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types stored in the outbox
+const (
+	TypeSessionCreated = "session.created"
+	TypePlanCompleted  = "plan.completed"
+	TypeTodoCompleted  = "todo.completed"
+)
+
+// SessionCreated is published when a focus session is recorded, whether
+// submitted by the user or finished in a focus room
+type SessionCreated struct {
+	SessionID    uuid.UUID  `json:"session_id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	PlanID       *uuid.UUID `json:"plan_id,omitempty"`
+	CourseID     *uuid.UUID `json:"course_id,omitempty"`
+	Date         time.Time  `json:"date"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	Minutes      int        `json:"minutes"`
+	PointsEarned int        `json:"points_earned"`
+}
+
+func (SessionCreated) EventType() string { return TypeSessionCreated }
+
+// PlanCompleted is published when a study plan becomes complete, either
+// marked by hand or by reaching its target minutes
+type PlanCompleted struct {
+	PlanID      uuid.UUID `json:"plan_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func (PlanCompleted) EventType() string { return TypePlanCompleted }
+
+// TodoCompleted is published when a todo is checked off
+type TodoCompleted struct {
+	TodoID      uuid.UUID `json:"todo_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func (TodoCompleted) EventType() string { return TypeTodoCompleted }
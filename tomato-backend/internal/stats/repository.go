@@ -0,0 +1,392 @@
+// Package stats reads focus statistics. A Repository answers a query with one
+// aggregated SQL statement per breakdown, all inside one read-only
+// transaction, so every figure comes from the same snapshot and the
+// breakdowns add up to the totals even while sessions are being recorded.
+package stats
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Ways the breakdown can be grouped
+const (
+	GroupDay      = "day"
+	GroupWeek     = "week"
+	GroupMonth    = "month"
+	GroupCourse   = "course"
+	GroupLocation = "location"
+)
+
+// groupColumns are the key and label each grouping selects. Weeks are ISO
+// weeks, keyed by their Monday.
+var groupColumns = map[string][2]string{
+	GroupDay:      {"to_char(focus_sessions.date, 'YYYY-MM-DD')", "to_char(focus_sessions.date, 'YYYY-MM-DD')"},
+	GroupWeek:     {"to_char(date_trunc('week', focus_sessions.date), 'YYYY-MM-DD')", `to_char(focus_sessions.date, 'IYYY-"W"IW')`},
+	GroupMonth:    {"to_char(focus_sessions.date, 'YYYY-MM')", "to_char(focus_sessions.date, 'YYYY-MM')"},
+	GroupCourse:   {"COALESCE(focus_sessions.course_id::text, '')", "COALESCE(courses.name, '')"},
+	GroupLocation: {"focus_sessions.location", "focus_sessions.location"},
+}
+
+// ValidGroup reports whether the breakdown can be grouped by groupBy
+func ValidGroup(groupBy string) bool {
+	_, ok := groupColumns[groupBy]
+	return ok
+}
+
+// sessionStartSQL is a session's start time. Sessions recorded before start
+// times were tracked are assumed to have ended when they were saved.
+const sessionStartSQL = "COALESCE(focus_sessions.started_at, focus_sessions.created_at - focus_sessions.minutes * INTERVAL '1 minute')"
+
+// Range is a range of dates, both inclusive. A zero Start or End leaves that
+// side open.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// where restricts query to the range's dates
+func (r Range) where(query *gorm.DB) *gorm.DB {
+	if !r.Start.IsZero() {
+		query = query.Where("focus_sessions.date >= ?", r.Start.Format("2006-01-02"))
+	}
+	if !r.End.IsZero() {
+		query = query.Where("focus_sessions.date <= ?", r.End.Format("2006-01-02"))
+	}
+	return query
+}
+
+// Query selects the statistics to report
+type Query struct {
+	UserID uuid.UUID
+	Range  Range
+	// Previous is the range Range is compared with; nil for no comparison
+	Previous *Range
+	// GroupBy groups Report.Breakdown
+	GroupBy string
+	// Location is the time zone of the heatmap
+	Location *time.Location
+	// Today is the date the current streak runs up to
+	Today time.Time
+}
+
+// Totals are the sums over a range of dates
+type Totals struct {
+	Sessions   int `json:"total_sessions"`
+	Minutes    int `json:"total_minutes"`
+	Points     int `json:"total_points"`
+	ActiveDays int `json:"active_days"`
+}
+
+// Day is the focus on one date
+type Day struct {
+	Date     string `json:"date"`
+	Sessions int    `json:"sessions"`
+	Minutes  int    `json:"minutes"`
+	Points   int    `json:"points"`
+}
+
+// Course is the focus on one course
+type Course struct {
+	CourseName string  `json:"course_name"`
+	Minutes    int     `json:"minutes"`
+	Percentage float64 `json:"percentage"`
+}
+
+// Group is one entry of the breakdown. Every grouping returns the same
+// fields; Key is empty for sessions without a course or location.
+type Group struct {
+	Key        string  `json:"key"`
+	Label      string  `json:"label"`
+	Sessions   int     `json:"sessions"`
+	Minutes    int     `json:"minutes"`
+	Points     int     `json:"points"`
+	Percentage float64 `json:"percentage"`
+}
+
+// WeekdayStats is the focus on one day of the week; Weekday runs from 1
+// (Monday) to 7 (Sunday)
+type WeekdayStats struct {
+	Weekday  int `json:"weekday"`
+	Sessions int `json:"sessions"`
+	Minutes  int `json:"minutes"`
+}
+
+// HourStats is the focus in sessions that started in one hour of the day
+type HourStats struct {
+	Hour     int `json:"hour"`
+	Sessions int `json:"sessions"`
+	Minutes  int `json:"minutes"`
+}
+
+// Heatmap shows when the user focuses. Minutes[d][h] is the minutes of
+// sessions that started on weekday d+1 (Monday first) in hour h, in the
+// query's time zone.
+type Heatmap struct {
+	Timezone string         `json:"timezone"`
+	Minutes  [7][24]int     `json:"minutes"`
+	Weekdays []WeekdayStats `json:"weekdays"`
+	Hours    []HourStats    `json:"hours"`
+}
+
+// Comparison compares a range with the previous one
+type Comparison struct {
+	PreviousStart string `json:"previous_start"`
+	PreviousEnd   string `json:"previous_end"`
+	Previous      Totals `json:"previous"`
+	MinutesChange int    `json:"minutes_change"`
+	// MinutesChangePercent is nil when the previous range had no focus
+	MinutesChangePercent *float64 `json:"minutes_change_percent"`
+}
+
+// Report is the statistics for a Query
+type Report struct {
+	Totals                Totals
+	AverageSessionMinutes float64
+	LongestSessionMinutes int
+	CurrentStreak         int
+	LongestStreak         int
+	// Daily and Courses are the day and course breakdowns in their older
+	// shape; Courses leaves out sessions without a course
+	Daily      []Day
+	Courses    []Course
+	Breakdown  []Group
+	Heatmap    *Heatmap
+	Comparison *Comparison
+}
+
+// readOnly reads every query of a report from one snapshot
+var readOnly = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
+// Repository reads statistics from the database
+type Repository struct {
+	db *gorm.DB
+}
+
+// NewRepository returns a repository that reads from db
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Report reads the statistics for q
+func (r *Repository) Report(q Query) (*Report, error) {
+	report := &Report{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := aggregate(tx, q.UserID, q.Range)
+		if err != nil {
+			return err
+		}
+		report.Totals = current.Totals
+		report.AverageSessionMinutes = math.Round(current.Average*10) / 10
+		report.LongestSessionMinutes = current.Longest
+
+		if report.CurrentStreak, report.LongestStreak, err = streaks(tx, q.UserID, q.Today); err != nil {
+			return err
+		}
+
+		// The legacy day and course breakdowns share their query with the
+		// requested grouping
+		groupings := map[string][]Group{}
+		for _, groupBy := range []string{GroupDay, GroupCourse, q.GroupBy} {
+			if _, ok := groupings[groupBy]; ok {
+				continue
+			}
+			if groupings[groupBy], err = groups(tx, q.UserID, q.Range, groupBy); err != nil {
+				return err
+			}
+		}
+		report.Breakdown = groupings[q.GroupBy]
+		report.Daily = []Day{}
+		for _, g := range groupings[GroupDay] {
+			report.Daily = append(report.Daily, Day{Date: g.Key, Sessions: g.Sessions, Minutes: g.Minutes, Points: g.Points})
+		}
+		report.Courses = []Course{}
+		for _, g := range groupings[GroupCourse] {
+			if g.Key != "" {
+				report.Courses = append(report.Courses, Course{CourseName: g.Label, Minutes: g.Minutes, Percentage: g.Percentage})
+			}
+		}
+
+		if report.Heatmap, err = heatmap(tx, q.UserID, q.Range, q.Location); err != nil {
+			return err
+		}
+
+		if q.Previous != nil {
+			previous, err := aggregate(tx, q.UserID, *q.Previous)
+			if err != nil {
+				return err
+			}
+			report.Comparison = compare(report.Totals.Minutes, previous.Totals, *q.Previous)
+		}
+		return nil
+	}, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Streaks returns the user's current streak, the consecutive days with a
+// session up to today (or yesterday, while today has none yet), and their
+// longest-ever streak
+func (r *Repository) Streaks(userID uuid.UUID, today time.Time) (current, longest int, err error) {
+	return streaks(r.db, userID, today)
+}
+
+// sums are the totals and session lengths over a range
+type sums struct {
+	Totals
+	Average float64
+	Longest int
+}
+
+// aggregate sums the user's sessions in the range
+func aggregate(tx *gorm.DB, userID uuid.UUID, r Range) (sums, error) {
+	var row struct {
+		Sessions   int
+		Minutes    int
+		Points     int
+		ActiveDays int
+		Average    float64
+		Longest    int
+	}
+	query := tx.Table("focus_sessions").
+		Select("COUNT(*) AS sessions, COALESCE(SUM(minutes), 0) AS minutes, "+
+			"COALESCE(SUM(points_earned), 0) AS points, COUNT(DISTINCT date) AS active_days, "+
+			"COALESCE(AVG(minutes), 0) AS average, COALESCE(MAX(minutes), 0) AS longest").
+		Where("focus_sessions.user_id = ?", userID)
+	if err := r.where(query).Scan(&row).Error; err != nil {
+		return sums{}, err
+	}
+	return sums{
+		Totals:  Totals{Sessions: row.Sessions, Minutes: row.Minutes, Points: row.Points, ActiveDays: row.ActiveDays},
+		Average: row.Average,
+		Longest: row.Longest,
+	}, nil
+}
+
+// streaks computes the current and longest streak in one pass. Sessions
+// dated after today are left out so they cannot extend a streak.
+func streaks(tx *gorm.DB, userID uuid.UUID, today time.Time) (current, longest int, err error) {
+	// Consecutive dates minus their row number are constant, so each group
+	// is one streak
+	var row struct {
+		Current int
+		Longest int
+	}
+	err = tx.Raw(`
+		SELECT COALESCE(MAX(days) FILTER (WHERE last_day >= ?), 0) AS current,
+			COALESCE(MAX(days), 0) AS longest
+		FROM (
+			SELECT COUNT(*) AS days, MAX(date) AS last_day FROM (
+				SELECT date, date - CAST(ROW_NUMBER() OVER (ORDER BY date) AS int) AS streak
+				FROM (SELECT DISTINCT date FROM focus_sessions WHERE user_id = ? AND date <= ?) AS active_days
+			) AS numbered
+			GROUP BY streak
+		) AS streaks`, today.AddDate(0, 0, -1).Format("2006-01-02"), userID, today.Format("2006-01-02")).Scan(&row).Error
+	return row.Current, row.Longest, err
+}
+
+// groups breaks the user's sessions in the range down by groupBy. Dates come
+// in order, courses and locations with the most minutes first.
+func groups(tx *gorm.DB, userID uuid.UUID, r Range, groupBy string) ([]Group, error) {
+	columns := groupColumns[groupBy]
+	query := tx.Table("focus_sessions").
+		Select(columns[0]+" AS key, "+columns[1]+" AS label, "+
+			"COUNT(*) AS sessions, SUM(focus_sessions.minutes) AS minutes, "+
+			"SUM(focus_sessions.points_earned) AS points").
+		Where("focus_sessions.user_id = ?", userID)
+	if groupBy == GroupCourse {
+		// Trashed courses are included so history keeps their names
+		query = query.Joins("LEFT JOIN courses ON focus_sessions.course_id = courses.id")
+	}
+	query = r.where(query).Group("key, label")
+	switch groupBy {
+	case GroupCourse, GroupLocation:
+		query = query.Order("minutes DESC, key")
+	default:
+		query = query.Order("key")
+	}
+
+	result := []Group{}
+	if err := query.Scan(&result).Error; err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, g := range result {
+		total += g.Minutes
+	}
+	for i := range result {
+		if result[i].Key == "" {
+			switch groupBy {
+			case GroupCourse:
+				result[i].Label = "未分類"
+			case GroupLocation:
+				result[i].Label = "未填寫"
+			}
+		}
+		if total > 0 {
+			result[i].Percentage = math.Round(float64(result[i].Minutes)/float64(total)*1000) / 10
+		}
+	}
+	return result, nil
+}
+
+// heatmap buckets the user's sessions in the range by the weekday and hour
+// they started in loc
+func heatmap(tx *gorm.DB, userID uuid.UUID, r Range, loc *time.Location) (*Heatmap, error) {
+	var cells []struct {
+		Weekday  int
+		Hour     int
+		Sessions int
+		Minutes  int
+	}
+	query := tx.Table("focus_sessions").
+		Select("EXTRACT(ISODOW FROM "+sessionStartSQL+" AT TIME ZONE ?)::int AS weekday, "+
+			"EXTRACT(HOUR FROM "+sessionStartSQL+" AT TIME ZONE ?)::int AS hour, "+
+			"COUNT(*) AS sessions, SUM(focus_sessions.minutes) AS minutes", loc.String(), loc.String()).
+		Where("focus_sessions.user_id = ?", userID)
+	if err := r.where(query).Group("weekday, hour").Scan(&cells).Error; err != nil {
+		return nil, err
+	}
+
+	result := &Heatmap{
+		Timezone: loc.String(),
+		Weekdays: make([]WeekdayStats, 7),
+		Hours:    make([]HourStats, 24),
+	}
+	for d := range result.Weekdays {
+		result.Weekdays[d].Weekday = d + 1
+	}
+	for h := range result.Hours {
+		result.Hours[h].Hour = h
+	}
+	for _, cell := range cells {
+		result.Minutes[cell.Weekday-1][cell.Hour] += cell.Minutes
+		result.Weekdays[cell.Weekday-1].Sessions += cell.Sessions
+		result.Weekdays[cell.Weekday-1].Minutes += cell.Minutes
+		result.Hours[cell.Hour].Sessions += cell.Sessions
+		result.Hours[cell.Hour].Minutes += cell.Minutes
+	}
+	return result, nil
+}
+
+// compare compares the minutes of a range with the previous one
+func compare(minutes int, previous Totals, r Range) *Comparison {
+	comparison := &Comparison{
+		PreviousStart: r.Start.Format("2006-01-02"),
+		PreviousEnd:   r.End.Format("2006-01-02"),
+		Previous:      previous,
+		MinutesChange: minutes - previous.Minutes,
+	}
+	if previous.Minutes > 0 {
+		percent := math.Round(float64(comparison.MinutesChange)/float64(previous.Minutes)*1000) / 10
+		comparison.MinutesChangePercent = &percent
+	}
+	return comparison
+}
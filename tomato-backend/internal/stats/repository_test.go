@@ -0,0 +1,300 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/models"
+	"github.com/yourusername/tomato-backend/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// seededStats holds the seeded dataset
+type seededStats struct {
+	userID  uuid.UUID
+	math    *models.Course
+	english *models.Course
+}
+
+func setupStatsTests(t *testing.T) (*Repository, *seededStats, func()) {
+	// Setup test database
+	db := testutil.SetupTestDB(t)
+	testutil.MigrateTestDB(t, db)
+
+	// Create test data
+	school := testutil.CreateTestSchool(db, "測試大學")
+	user := testutil.CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
+	other := testutil.CreateTestUser(db, "other@example.com", "password123", "其他用戶", &school.ID)
+	seeded := &seededStats{
+		userID:  user.ID,
+		math:    testutil.CreateTestCourse(db, user.ID, "數學", "bg-blue-400"),
+		english: testutil.CreateTestCourse(db, user.ID, "英文", "bg-red-400"),
+	}
+
+	seed := func(userID uuid.UUID, date string, course *models.Course, location string, hour, minutes int) {
+		d, _ := time.Parse("2006-01-02", date)
+		startedAt := d.Add(time.Duration(hour) * time.Hour)
+		session := models.FocusSession{
+			UserID:       userID,
+			Date:         d,
+			StartedAt:    &startedAt,
+			Minutes:      minutes,
+			PointsEarned: minutes * 10,
+			Location:     location,
+		}
+		if course != nil {
+			session.CourseID = &course.ID
+		}
+		if err := db.Create(&session).Error; err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	seed(user.ID, "2025-03-03", seeded.math, "圖書館", 9, 25)
+	seed(user.ID, "2025-03-03", seeded.math, "圖書館", 13, 50)
+	seed(user.ID, "2025-03-04", seeded.english, "宿舍", 9, 25)
+	seed(user.ID, "2025-03-05", nil, "", 21, 30)
+	seed(user.ID, "2025-03-10", seeded.english, "圖書館", 9, 45)
+	seed(user.ID, "2025-03-31", seeded.math, "宿舍", 9, 60)
+	seed(user.ID, "2025-04-01", nil, "圖書館", 9, 20)
+	// Someone else's focus never counts
+	seed(other.ID, "2025-03-03", nil, "圖書館", 9, 100)
+
+	// Trashed courses keep their name in the statistics
+	db.Delete(seeded.english)
+
+	// Cleanup function
+	cleanup := func() {
+		testutil.CleanupTestDB(t, db)
+		testutil.TeardownTestDB(db)
+	}
+
+	return NewRepository(db), seeded, cleanup
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+// groupTotals adds up a breakdown
+func groupTotals(groups []Group) (sessions, minutes, points int, percentage float64) {
+	for _, g := range groups {
+		sessions += g.Sessions
+		minutes += g.Minutes
+		points += g.Points
+		percentage += g.Percentage
+	}
+	return sessions, minutes, points, percentage
+}
+
+func TestReportAddsUp(t *testing.T) {
+	repo, seeded, cleanup := setupStatsTests(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		dates    Range
+		expected Totals
+	}{
+		{"三月", Range{Start: date("2025-03-01"), End: date("2025-03-31")}, Totals{Sessions: 6, Minutes: 235, Points: 2350, ActiveDays: 5}},
+		{"第一週", Range{Start: date("2025-03-03"), End: date("2025-03-09")}, Totals{Sessions: 4, Minutes: 130, Points: 1300, ActiveDays: 3}},
+		{"只有開始日期", Range{Start: date("2025-03-10")}, Totals{Sessions: 3, Minutes: 125, Points: 1250, ActiveDays: 3}},
+		{"全部", Range{}, Totals{Sessions: 7, Minutes: 255, Points: 2550, ActiveDays: 6}},
+		{"沒有紀錄", Range{Start: date("2024-01-01"), End: date("2024-01-31")}, Totals{}},
+	}
+
+	for _, tt := range tests {
+		for _, groupBy := range []string{GroupDay, GroupWeek, GroupMonth, GroupCourse, GroupLocation} {
+			t.Run(tt.name+"/"+groupBy, func(t *testing.T) {
+				report, err := repo.Report(Query{
+					UserID:   seeded.userID,
+					Range:    tt.dates,
+					GroupBy:  groupBy,
+					Location: time.UTC,
+					Today:    date("2025-04-01"),
+				})
+				if err != nil {
+					t.Fatalf("Failed to read the report: %v", err)
+				}
+				if report.Totals != tt.expected {
+					t.Errorf("Expected totals %+v, got %+v", tt.expected, report.Totals)
+				}
+
+				sessions, minutes, points, percentage := groupTotals(report.Breakdown)
+				if sessions != tt.expected.Sessions || minutes != tt.expected.Minutes || points != tt.expected.Points {
+					t.Errorf("Expected the breakdown to add up to %+v, got %d sessions, %d minutes and %d points", tt.expected, sessions, minutes, points)
+				}
+				if tt.expected.Minutes > 0 && math.Abs(percentage-100) > 0.5 {
+					t.Errorf("Expected the percentages to add up to 100, got %v", percentage)
+				}
+
+				dailySessions, dailyMinutes := 0, 0
+				for _, day := range report.Daily {
+					dailySessions += day.Sessions
+					dailyMinutes += day.Minutes
+				}
+				if len(report.Daily) != tt.expected.ActiveDays || dailySessions != tt.expected.Sessions || dailyMinutes != tt.expected.Minutes {
+					t.Errorf("Expected %d days adding up to %d minutes, got %+v", tt.expected.ActiveDays, tt.expected.Minutes, report.Daily)
+				}
+
+				heatmapSessions, heatmapMinutes := 0, 0
+				for _, day := range report.Heatmap.Weekdays {
+					heatmapSessions += day.Sessions
+					heatmapMinutes += day.Minutes
+				}
+				if heatmapSessions != tt.expected.Sessions || heatmapMinutes != tt.expected.Minutes {
+					t.Errorf("Expected the heatmap to add up to %d sessions and %d minutes, got %d and %d", tt.expected.Sessions, tt.expected.Minutes, heatmapSessions, heatmapMinutes)
+				}
+			})
+		}
+	}
+}
+
+func TestReportBreakdowns(t *testing.T) {
+	repo, seeded, cleanup := setupStatsTests(t)
+	defer cleanup()
+
+	march := Range{Start: date("2025-03-01"), End: date("2025-03-31")}
+	tests := []struct {
+		groupBy string
+		keys    []string
+		labels  []string
+		minutes []int
+	}{
+		{GroupDay, []string{"2025-03-03", "2025-03-04", "2025-03-05", "2025-03-10", "2025-03-31"}, []string{"2025-03-03", "2025-03-04", "2025-03-05", "2025-03-10", "2025-03-31"}, []int{75, 25, 30, 45, 60}},
+		{GroupWeek, []string{"2025-03-03", "2025-03-10", "2025-03-31"}, []string{"2025-W10", "2025-W11", "2025-W14"}, []int{130, 45, 60}},
+		{GroupMonth, []string{"2025-03"}, []string{"2025-03"}, []int{235}},
+		{GroupCourse, []string{seeded.math.ID.String(), seeded.english.ID.String(), ""}, []string{"數學", "英文", "未分類"}, []int{135, 70, 30}},
+		{GroupLocation, []string{"圖書館", "宿舍", ""}, []string{"圖書館", "宿舍", "未填寫"}, []int{120, 85, 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			report, err := repo.Report(Query{UserID: seeded.userID, Range: march, GroupBy: tt.groupBy, Location: time.UTC})
+			if err != nil {
+				t.Fatalf("Failed to read the report: %v", err)
+			}
+			if len(report.Breakdown) != len(tt.keys) {
+				t.Fatalf("Expected %d groups, got %+v", len(tt.keys), report.Breakdown)
+			}
+			for i, g := range report.Breakdown {
+				if g.Key != tt.keys[i] || g.Label != tt.labels[i] || g.Minutes != tt.minutes[i] {
+					t.Errorf("Expected group %d to be %s (%s) with %d minutes, got %+v", i, tt.keys[i], tt.labels[i], tt.minutes[i], g)
+				}
+			}
+		})
+	}
+
+	// The older course breakdown leaves out sessions without a course
+	report, err := repo.Report(Query{UserID: seeded.userID, Range: march, GroupBy: GroupDay, Location: time.UTC})
+	if err != nil {
+		t.Fatalf("Failed to read the report: %v", err)
+	}
+	if len(report.Courses) != 2 || report.Courses[0].CourseName != "數學" || report.Courses[0].Percentage != 57.4 {
+		t.Errorf("Expected 數學 first with 57.4%% of the minutes, got %+v", report.Courses)
+	}
+	if report.Heatmap.Minutes[0][9] != 130 || report.Heatmap.Minutes[0][13] != 50 || report.Heatmap.Minutes[2][21] != 30 {
+		t.Errorf("Expected 130 minutes on Mondays at 9:00, 50 at 13:00 and 30 on Wednesdays at 21:00, got %v", report.Heatmap.Minutes)
+	}
+	if report.AverageSessionMinutes != 39.2 || report.LongestSessionMinutes != 60 {
+		t.Errorf("Expected an average of 39.2 and longest of 60 minutes, got %v and %v", report.AverageSessionMinutes, report.LongestSessionMinutes)
+	}
+}
+
+func TestReportComparison(t *testing.T) {
+	repo, seeded, cleanup := setupStatsTests(t)
+	defer cleanup()
+
+	report, err := repo.Report(Query{
+		UserID:   seeded.userID,
+		Range:    Range{Start: date("2025-03-10"), End: date("2025-04-01")},
+		Previous: &Range{Start: date("2025-03-03"), End: date("2025-03-09")},
+		GroupBy:  GroupDay,
+		Location: time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("Failed to read the report: %v", err)
+	}
+	comparison := report.Comparison
+	if comparison.PreviousStart != "2025-03-03" || comparison.PreviousEnd != "2025-03-09" || comparison.Previous.Minutes != 130 {
+		t.Errorf("Expected 130 minutes from 2025-03-03 to 2025-03-09, got %+v", comparison)
+	}
+	if comparison.MinutesChange != -5 || comparison.MinutesChangePercent == nil || *comparison.MinutesChangePercent != -3.8 {
+		t.Errorf("Expected 5 minutes less (-3.8%%), got %+v", comparison)
+	}
+
+	// Nothing to compare with
+	report, _ = repo.Report(Query{
+		UserID:   seeded.userID,
+		Range:    Range{Start: date("2025-03-01"), End: date("2025-03-31")},
+		Previous: &Range{Start: date("2025-01-29"), End: date("2025-02-28")},
+		GroupBy:  GroupDay,
+		Location: time.UTC,
+	})
+	if report.Comparison.MinutesChange != 235 || report.Comparison.MinutesChangePercent != nil {
+		t.Errorf("Expected no percentage without earlier focus, got %+v", report.Comparison)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	repo, seeded, cleanup := setupStatsTests(t)
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		today   string
+		current int
+	}{
+		{"今天有紀錄", "2025-04-01", 2},
+		{"今天還沒有紀錄", "2025-04-02", 2},
+		{"中斷", "2025-04-03", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest, err := repo.Streaks(seeded.userID, date(tt.today))
+			if err != nil {
+				t.Fatalf("Failed to read the streaks: %v", err)
+			}
+			if current != tt.current || longest != 3 {
+				t.Errorf("Expected a current streak of %d and longest of 3, got %d and %d", tt.current, current, longest)
+			}
+		})
+	}
+}
+
+// Sessions dated in the future do not extend the streak
+func TestStreaksIgnoreFutureSessions(t *testing.T) {
+	repo, seeded, cleanup := setupStatsTests(t)
+	defer cleanup()
+
+	for _, d := range []string{"2025-04-02", "2025-04-03", "2025-04-04", "2025-04-05"} {
+		session := models.FocusSession{UserID: seeded.userID, Date: date(d), Minutes: 25, PointsEarned: 250}
+		if err := repo.db.Create(&session).Error; err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	current, longest, err := repo.Streaks(seeded.userID, date("2025-04-01"))
+	if err != nil {
+		t.Fatalf("Failed to read the streaks: %v", err)
+	}
+	if current != 2 || longest != 3 {
+		t.Errorf("Expected a current streak of 2 and longest of 3, got %d and %d", current, longest)
+	}
+}
+
+// Reports are read in a read-only transaction
+func TestReportIsReadOnly(t *testing.T) {
+	repo, seeded, cleanup := setupStatsTests(t)
+	defer cleanup()
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Exec("DELETE FROM focus_sessions WHERE user_id = ?", seeded.userID).Error
+	}, readOnly)
+	if err == nil {
+		t.Error("Expected writes to fail in the read-only transaction")
+	}
+}
@@ -56,6 +56,26 @@ func MigrateTestDB(t *testing.T, db *gorm.DB) {
 		&models.StudyPlan{},
 		&models.FocusSession{},
 		&models.Todo{},
+		&models.SchoolAlias{},
+		&models.IdempotencyKey{},
+		&models.AdminAuditLog{},
+		&models.PointTransaction{},
+		&models.UserToken{},
+		&models.LoginThrottle{},
+		&models.SchoolDomain{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.AuthSession{},
+		&models.UserAchievement{},
+		&models.Season{},
+		&models.SeasonStanding{},
+		&models.StudyGroup{},
+		&models.StudyGroupMember{},
+		&models.OutboxEvent{},
+		&models.OutboxDelivery{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.PersonalAccessToken{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
@@ -66,16 +86,36 @@ func MigrateTestDB(t *testing.T, db *gorm.DB) {
 func CleanupTestDB(t *testing.T, db *gorm.DB) {
 	// Delete in reverse order to handle foreign keys
 	tables := []interface{}{
+		&models.PersonalAccessToken{},
+		&models.WebhookDelivery{},
+		&models.Webhook{},
+		&models.OutboxDelivery{},
+		&models.OutboxEvent{},
+		&models.StudyGroupMember{},
+		&models.StudyGroup{},
+		&models.SeasonStanding{},
+		&models.Season{},
+		&models.UserAchievement{},
+		&models.AuthSession{},
+		&models.OIDCLoginState{},
+		&models.UserIdentity{},
+		&models.LoginThrottle{},
+		&models.UserToken{},
+		&models.PointTransaction{},
+		&models.AdminAuditLog{},
+		&models.IdempotencyKey{},
 		&models.FocusSession{},
 		&models.Todo{},
 		&models.StudyPlan{},
 		&models.Course{},
 		&models.User{},
+		&models.SchoolDomain{},
+		&models.SchoolAlias{},
 		&models.School{},
 	}
 
 	for _, table := range tables {
-		if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(table).Error; err != nil {
+		if err := db.Unscoped().Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(table).Error; err != nil {
 			log.Printf("Warning: Failed to clean table %T: %v", table, err)
 		}
 	}
@@ -19,34 +19,32 @@ func CreateTestSchool(db *gorm.DB, name string) *models.School {
 	return school
 }
 
-// CreateTestUser creates a test user with hashed password
+// CreateTestUser creates a verified test user with hashed password
 func CreateTestUser(db *gorm.DB, email, password, name string, schoolID *uuid.UUID) *models.User {
 	hashedPassword, _ := utils.HashPassword(password)
+	verifiedAt := time.Now()
 	user := &models.User{
-		Email:       email,
-		Password:    hashedPassword,
-		Name:        name,
-		SchoolID:    schoolID,
-		TotalPoints: 0,
+		Email:           email,
+		PasswordHash:    hashedPassword,
+		Name:            name,
+		SchoolID:        schoolID,
+		TotalPoints:     0,
+		EmailVerifiedAt: &verifiedAt,
 	}
 	db.Create(user)
 	return user
 }
 
 // CreateTestCourse creates a test course for a user
-func CreateTestCourse(db *gorm.DB, userID uuid.UUID, name, color string, credits int) *models.Course {
+func CreateTestCourse(db *gorm.DB, userID uuid.UUID, name, color string) *models.Course {
 	course := &models.Course{
-		UserID:       userID,
-		Name:         name,
-		Color:        color,
-		Credits:      credits,
-		StartDate:    time.Now(),
-		EndDate:      time.Now().AddDate(0, 4, 0), // 4 months later
-		DayOfWeek:    1,                           // Monday
-		StartTime:    "09:00",
-		EndTime:      "11:00",
-		Location:     "測試教室",
-		ProfessorName: "測試教授",
+		UserID:    userID,
+		Name:      name,
+		Color:     color,
+		Day:       1, // Monday
+		StartTime: "09:00",
+		EndTime:   "11:00",
+		Location:  "測試教室",
 	}
 	db.Create(course)
 	return course
@@ -108,7 +106,7 @@ func CreateCompleteTestData(db *gorm.DB) (school *models.School, user *models.Us
 	user = CreateTestUser(db, "test@example.com", "password123", "測試用戶", &school.ID)
 
 	// Create course
-	course = CreateTestCourse(db, user.ID, "測試課程", "#3b82f6", 3)
+	course = CreateTestCourse(db, user.ID, "測試課程", "#3b82f6")
 
 	// Create study plan
 	plan = CreateTestStudyPlan(db, user.ID, &course.ID, "測試計畫", 120)
@@ -9,6 +9,8 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yourusername/tomato-backend/internal/models"
 	"github.com/yourusername/tomato-backend/internal/utils"
 )
 
@@ -102,7 +104,8 @@ func GetResponseData(t *testing.T, w *httptest.ResponseRecorder) interface{} {
 
 // GenerateTestToken generates a JWT token for testing
 func GenerateTestToken(t *testing.T, userID, email string) string {
-	token, err := utils.GenerateToken(userID, email)
+	user := &models.User{ID: uuid.MustParse(userID), Email: email, Role: models.RoleStudent}
+	token, _, err := utils.GenerateSessionTokens(user, uuid.Nil)
 	if err != nil {
 		t.Fatalf("Failed to generate test token: %v", err)
 	}
@@ -0,0 +1,208 @@
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCIdentity is the account the stub provider signs in as
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCStub is a minimal OpenID Connect provider for tests. It implements
+// discovery, JWKS, an authorization endpoint that immediately redirects back
+// with a code for Identity, and a token endpoint that checks PKCE.
+type OIDCStub struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	// Identity is used for the next authorization request
+	Identity OIDCIdentity
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]stubAuthorization
+}
+
+type stubAuthorization struct {
+	identity      OIDCIdentity
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// NewOIDCStub starts a stub provider that is shut down when the test ends
+func NewOIDCStub(t *testing.T) *OIDCStub {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	stub := &OIDCStub{
+		ClientID:     "tomato-test",
+		ClientSecret: "stub-secret",
+		key:          key,
+		codes:        map[string]stubAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/authorize", stub.authorize)
+	mux.HandleFunc("/token", stub.token)
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Server.Close)
+
+	return stub
+}
+
+// Issuer returns the issuer URL of the stub
+func (s *OIDCStub) Issuer() string {
+	return s.Server.URL
+}
+
+// Authorize follows an authorization URL as the user would and returns the
+// code and state the provider redirects back with
+func (s *OIDCStub) Authorize(t *testing.T, authorizationURL string) (code, state string) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(authorizationURL)
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected redirect from authorization endpoint, got %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid redirect location: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func (s *OIDCStub) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.Issuer(),
+		"authorization_endpoint": s.Issuer() + "/authorize",
+		"token_endpoint":         s.Issuer() + "/token",
+		"jwks_uri":               s.Issuer() + "/jwks",
+	})
+}
+
+func (s *OIDCStub) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *OIDCStub) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != s.ClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = stubAuthorization{
+		identity:      s.Identity,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *OIDCStub) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	auth, found := s.codes[r.PostFormValue("code")]
+	delete(s.codes, r.PostFormValue("code"))
+	s.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found ||
+		auth.redirectURI != r.PostFormValue("redirect_uri") ||
+		auth.codeChallenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.Issuer(),
+		"aud":            s.ClientID,
+		"sub":            auth.identity.Subject,
+		"email":          auth.identity.Email,
+		"email_verified": auth.identity.EmailVerified,
+		"name":           auth.identity.Name,
+		"nonce":          auth.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "stub-key"
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
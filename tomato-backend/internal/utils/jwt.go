@@ -7,68 +7,80 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/yourusername/tomato-backend/internal/config"
+	"github.com/yourusername/tomato-backend/internal/models"
+)
+
+// Token types carried in the typ claim. Tokens issued before types existed
+// carry none.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
 )
 
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
+	UserID       uuid.UUID `json:"user_id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	TokenVersion int       `json:"ver"`
+	// SessionID is the login session the token belongs to. Tokens issued
+	// before sessions were tracked have none.
+	SessionID uuid.UUID `json:"sid"`
+	Type      string    `json:"typ"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID uuid.UUID, email string) (string, error) {
-	expirationTime := time.Now().Add(config.AppConfig.JWT.Expiration)
-
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// GenerateSessionTokens generates an access and refresh token pair bound to
+// the login session sessionID
+func GenerateSessionTokens(user *models.User, sessionID uuid.UUID) (token, refreshToken string, err error) {
+	if token, err = signToken(user, sessionID, TokenTypeAccess, config.AppConfig.JWT.Expiration); err != nil {
+		return "", "", err
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWT.Secret))
-	if err != nil {
-		return "", err
+	if refreshToken, err = signToken(user, sessionID, TokenTypeRefresh, config.AppConfig.JWT.RefreshExpiration); err != nil {
+		return "", "", err
 	}
-
-	return tokenString, nil
+	return token, refreshToken, nil
 }
 
-// GenerateRefreshToken generates a refresh token with longer expiration
-func GenerateRefreshToken(userID uuid.UUID, email string) (string, error) {
-	expirationTime := time.Now().Add(config.AppConfig.JWT.RefreshExpiration)
+// signToken signs claims of the given token type for user that expire after
+// ttl. The token is only accepted while user.TokenVersion is unchanged.
+func signToken(user *models.User, sessionID uuid.UUID, tokenType string, ttl time.Duration) (string, error) {
+	now := time.Now()
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       user.ID,
+		Email:        user.Email,
+		Role:         string(user.Role),
+		TokenVersion: user.TokenVersion,
+		SessionID:    sessionID,
+		Type:         tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			// Tokens differ even when issued in the same second, so an old
+			// refresh token is never mistaken for the current one
+			ID: uuid.NewString(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWT.Secret))
+	keys, err := activeKeys()
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	return keys.sign(claims)
 }
 
-// ValidateToken validates a JWT token and returns the claims
+// ValidateToken validates a JWT token and returns the claims. Tokens signed
+// by any active verification key are accepted, as are HS256 tokens without a
+// key ID while JWT_SECRET is set.
 func ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
+	keys, err := activeKeys()
+	if err != nil {
+		return nil, err
+	}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(config.AppConfig.JWT.Secret), nil
-	})
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, jwt.WithValidMethods(keys.validMethods()))
 
 	if err != nil {
 		return nil, err
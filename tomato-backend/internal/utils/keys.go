@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/tomato-backend/internal/config"
+)
+
+// JWK is a public key in JSON Web Key format, as served from the JWKS
+// endpoint
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// verificationKey is a public key tokens may be signed with
+type verificationKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	jwk    JWK
+}
+
+// keySet holds the key new tokens are signed with and every key tokens are
+// accepted from
+type keySet struct {
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	signingKid    string
+	verification  map[string]*verificationKey
+	// secret verifies HS256 tokens, if configured
+	secret []byte
+}
+
+var (
+	keysMu     sync.Mutex
+	loadedKeys *keySet
+	loadedFrom string
+)
+
+// LoadSigningKeys reads the configured keys so that misconfiguration is
+// reported at startup rather than on the first login
+func LoadSigningKeys() error {
+	_, err := activeKeys()
+	return err
+}
+
+// activeKeys returns the key set for the current configuration, loading it
+// on first use or after the key settings changed
+func activeKeys() (*keySet, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	cfg := config.AppConfig.JWT
+	settings := strings.Join(append([]string{cfg.Secret, cfg.SigningKeyFile}, cfg.VerificationKeyFiles...), "\x00")
+	if loadedKeys != nil && loadedFrom == settings {
+		return loadedKeys, nil
+	}
+
+	keys, err := loadKeySet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	loadedKeys, loadedFrom = keys, settings
+	return keys, nil
+}
+
+func loadKeySet(cfg config.JWTConfig) (*keySet, error) {
+	keys := &keySet{verification: map[string]*verificationKey{}}
+	if cfg.Secret != "" {
+		keys.secret = []byte(cfg.Secret)
+	}
+
+	if cfg.SigningKeyFile == "" {
+		if keys.secret == nil {
+			return nil, errors.New("no JWT signing key configured")
+		}
+		keys.signingMethod = jwt.SigningMethodHS256
+		keys.signingKey = keys.secret
+		return keys, nil
+	}
+
+	private, err := readPrivateKey(cfg.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key type %T", cfg.SigningKeyFile, private)
+	}
+	current, err := newVerificationKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.SigningKeyFile, err)
+	}
+	keys.signingMethod = current.method
+	keys.signingKey = private
+	keys.signingKid = current.jwk.Kid
+	keys.verification[current.jwk.Kid] = current
+
+	for _, path := range cfg.VerificationKeyFiles {
+		public, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newVerificationKey(public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys.verification[key.jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// sign signs claims with the current signing key
+func (k *keySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signingMethod, claims)
+	if k.signingKid != "" {
+		token.Header["kid"] = k.signingKid
+	}
+	return token.SignedString(k.signingKey)
+}
+
+// keyFunc picks the verification key by the token's kid. Tokens without a
+// kid are legacy HS256 tokens.
+func (k *keySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && k.secret != nil {
+			return k.secret, nil
+		}
+		return nil, errors.New("token has no key ID")
+	}
+
+	key, ok := k.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// validMethods lists the algorithms tokens are accepted with
+func (k *keySet) validMethods() []string {
+	seen := map[string]bool{}
+	if k.secret != nil {
+		seen[jwt.SigningMethodHS256.Alg()] = true
+	}
+	for _, key := range k.verification {
+		seen[key.method.Alg()] = true
+	}
+
+	methods := make([]string, 0, len(seen))
+	for alg := range seen {
+		methods = append(methods, alg)
+	}
+	return methods
+}
+
+// PublicJWKS returns the public keys tokens are currently accepted from.
+// HS256 secrets are never published.
+func PublicJWKS() (*JWKSet, error) {
+	keys, err := activeKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range keys.verification {
+		set.Keys = append(set.Keys, key.jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set, nil
+}
+
+// newVerificationKey derives the signing method and JWK for a public key.
+// The key ID is the RFC 7638 thumbprint, so it never needs configuring.
+func newVerificationKey(public crypto.PublicKey) (*verificationKey, error) {
+	key := &verificationKey{public: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.method = jwt.SigningMethodRS256
+		key.jwk = JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.jwk = JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+		key.method = jwt.SigningMethodES256
+		key.jwk = JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+
+	key.jwk.Kid = thumbprint(key.jwk)
+	key.jwk.Use = "sig"
+	key.jwk.Alg = key.method.Alg()
+	return key, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint: the hash of the required
+// members in lexicographic order
+func thumbprint(k JWK) string {
+	var members interface{}
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	}
+
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// readPublicKey accepts a public key or, for convenience, the retired
+// private key itself
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	private, err := readPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, private)
+	}
+	return signer.Public(), nil
+}
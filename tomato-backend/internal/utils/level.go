@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/yourusername/tomato-backend/internal/config"
+)
+
+// LevelInfo describes where a points total sits on the leveling curve
+type LevelInfo struct {
+	Level int `json:"level"`
+	// LevelPoints is the total at which the current level was reached
+	LevelPoints int `json:"level_points"`
+	// NextLevelPoints is the total needed for the next level, or nil at the
+	// maximum level
+	NextLevelPoints   *int `json:"next_level_points"`
+	PointsToNextLevel int  `json:"points_to_next_level"`
+	// Progress is how far the user is through the current level, from 0 to 1
+	Progress float64 `json:"progress"`
+}
+
+// LevelUp is reported when points earned in one go raised the level
+type LevelUp struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// levelCurve returns the configured curve with nonsensical values replaced
+// by the nearest sensible ones
+func levelCurve() (base, growth float64, maxLevel int) {
+	cfg := config.AppConfig.Levels
+	base, growth, maxLevel = float64(cfg.BasePoints), cfg.Growth, cfg.MaxLevel
+	if base < 1 {
+		base = 1
+	}
+	if growth < 1 {
+		growth = 1
+	}
+	if maxLevel < 1 {
+		maxLevel = 1
+	}
+	return base, growth, maxLevel
+}
+
+// LevelFor places totalPoints on the leveling curve. Everyone starts at
+// level 1 with 0 points.
+func LevelFor(totalPoints int) LevelInfo {
+	base, growth, maxLevel := levelCurve()
+
+	level, reached, step := 1, 0.0, base
+	for level < maxLevel && reached+step <= float64(totalPoints) {
+		reached += step
+		step = math.Round(step * growth)
+		level++
+	}
+
+	info := LevelInfo{Level: level, LevelPoints: int(reached)}
+	if level == maxLevel {
+		info.Progress = 1
+		return info
+	}
+
+	next := int(math.Min(reached+step, math.MaxInt32))
+	info.NextLevelPoints = &next
+	info.PointsToNextLevel = next - totalPoints
+	info.Progress = float64(totalPoints-info.LevelPoints) / float64(next-info.LevelPoints)
+	return info
+}
+
+// LevelUpBetween reports the level-up when a total goes from before to
+// after, or nil if the level did not rise
+func LevelUpBetween(before, after int) *LevelUp {
+	from, to := LevelFor(before).Level, LevelFor(after).Level
+	if to <= from {
+		return nil
+	}
+	return &LevelUp{From: from, To: to}
+}
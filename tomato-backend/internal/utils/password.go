@@ -1,9 +1,38 @@
 package utils
 
 import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yourusername/tomato-backend/internal/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// maxPasswordBytes is the most bcrypt will hash
+const maxPasswordBytes = 72
+
+var ErrCommonPassword = errors.New("此密碼過於常見，請換一個")
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+func parseCommonPasswords(list string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
+
 // HashPassword generates bcrypt hash of the password
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -15,3 +44,55 @@ func CheckPassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// ValidatePassword checks a new password against the configured policy. The
+// returned error message is meant to be shown to the user.
+func ValidatePassword(password string) error {
+	policy := config.AppConfig.Password
+
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Errorf("密碼長度至少需 %d 個字元", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("密碼長度不可超過 %d 個位元組", maxPasswordBytes)
+	}
+
+	if classes := passwordClasses(password); classes < policy.MinClasses {
+		return fmt.Errorf("密碼需包含小寫字母、大寫字母、數字、符號中的至少 %d 種", policy.MinClasses)
+	}
+
+	if policy.BlockCommon {
+		if _, found := commonPasswords[strings.ToLower(password)]; found {
+			return ErrCommonPassword
+		}
+	}
+
+	return nil
+}
+
+// passwordClasses counts how many of lowercase, uppercase, digits and
+// symbols appear in password
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLetter(r):
+			// Letters without case, e.g. Chinese, count as lowercase
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}